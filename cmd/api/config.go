@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+
+	"github.com/cgriceld/crypto-trade-bot/internal/services/robot"
 )
 
 type config struct {
@@ -13,8 +15,13 @@ type config struct {
 	APIPrivate string
 	TgBotURL   string
 	TgChatID   int
+	AutoResume bool
+	SpoolFile  string
+	WarmUp     int
 }
 
+const defaultSpoolFile = "spool.jsonl"
+
 func configApp() (*config, error) {
 	c := &config{}
 
@@ -67,5 +74,30 @@ func configApp() (*config, error) {
 		return nil, err
 	}
 
+	// optional, markets running at shutdown are not started again by default
+	if val, err := getConf("AutoResume"); err == nil {
+		if resume, err := strconv.ParseBool(val); err == nil {
+			c.AutoResume = resume
+		} else {
+			return nil, fmt.Errorf("Fail to convert AutoResume")
+		}
+	}
+
+	// optional, writes failed while the database is unavailable
+	c.SpoolFile = defaultSpoolFile
+	if val, err := getConf("SpoolFile"); err == nil {
+		c.SpoolFile = val
+	}
+
+	// optional, number of candles strategies are prefilled with on start
+	c.WarmUp = robot.DefaultWarmUp
+	if val, err := getConf("WarmUp"); err == nil {
+		if n, err := strconv.Atoi(val); err == nil && n >= 0 {
+			c.WarmUp = n
+		} else {
+			return nil, fmt.Errorf("Fail to convert WarmUp")
+		}
+	}
+
 	return c, nil
 }
@@ -23,6 +23,38 @@ var (
 		APIPrivate: "123",
 		TgBotURL:   "123",
 		TgChatID:   123,
+		SpoolFile:  "spool.jsonl",
+		WarmUp:     200,
+	}
+	resume = &config{
+		port:       "123",
+		dsn:        "123",
+		APIPublic:  "123",
+		APIPrivate: "123",
+		TgBotURL:   "123",
+		TgChatID:   123,
+		AutoResume: true,
+		SpoolFile:  "spool.jsonl",
+		WarmUp:     200,
+	}
+	spool = &config{
+		port:       "123",
+		dsn:        "123",
+		APIPublic:  "123",
+		APIPrivate: "123",
+		TgBotURL:   "123",
+		TgChatID:   123,
+		SpoolFile:  "/var/lib/robot/spool.jsonl",
+		WarmUp:     200,
+	}
+	warmUp = &config{
+		port:       "123",
+		dsn:        "123",
+		APIPublic:  "123",
+		APIPrivate: "123",
+		TgBotURL:   "123",
+		TgChatID:   123,
+		SpoolFile:  "spool.jsonl",
 	}
 )
 
@@ -31,6 +63,11 @@ func TestConfig(t *testing.T) {
 		{"All Set", full, nil, map[string]string{}},
 		{"All Set", nil, errors.New("No config: port"), map[string]string{"port": ""}},
 		{"All Set", nil, errors.New("Fail to convert TgChatID"), map[string]string{"TgChatID": "fff"}},
+		{"Auto resume", resume, nil, map[string]string{"TgChatID": "123", "AutoResume": "true"}},
+		{"Auto resume", nil, errors.New("Fail to convert AutoResume"), map[string]string{"AutoResume": "yes"}},
+		{"Spool file", spool, nil, map[string]string{"AutoResume": "", "SpoolFile": "/var/lib/robot/spool.jsonl"}},
+		{"No warm-up", warmUp, nil, map[string]string{"SpoolFile": "", "WarmUp": "0"}},
+		{"No warm-up", nil, errors.New("Fail to convert WarmUp"), map[string]string{"WarmUp": "-1"}},
 	}
 
 	os.Setenv("dsn", "123")
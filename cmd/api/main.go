@@ -14,7 +14,6 @@ import (
 	"github.com/cgriceld/crypto-trade-bot/internal/services/robot"
 	"github.com/cgriceld/crypto-trade-bot/pkg/kraken"
 	"github.com/cgriceld/crypto-trade-bot/pkg/log"
-	pgs "github.com/cgriceld/crypto-trade-bot/pkg/postgres"
 	"github.com/cgriceld/crypto-trade-bot/pkg/telegram"
 
 	"github.com/sirupsen/logrus"
@@ -22,28 +21,51 @@ import (
 
 const (
 	serverShutdownTimeout = 5 * time.Second
+	summaryInterval       = 24 * time.Hour
+	spoolInterval         = 30 * time.Second
+	instrumentsInterval   = time.Hour
+	reconcileInterval     = 30 * time.Second
 )
 
 func main() {
 	l := logrus.New()
 	logger := log.NewLog(l, logrus.DebugLevel, os.Stdout)
 
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := migrate(l, logger, os.Args[2:]); err != nil {
+			logger.Fatalf("Fail to migrate: %v", err)
+		}
+		return
+	}
+
 	cfg, err := configApp()
 	if err != nil {
 		logger.Fatalf("Fail to config app: %v", err)
 	}
 
-	pool, err := pgs.NewPool(l, cfg.dsn)
+	db, err := repository.Open(context.Background(), l, logger, cfg.dsn)
 	if err != nil {
-		return
+		logger.Fatalf("Fail to open database: %v", err)
 	}
-	defer pool.Close()
 
-	repo := repository.New(pool, logger)
 	notify := telegram.New(logger, cfg.TgChatID, cfg.TgBotURL)
+	repo, err := repository.NewSpool(db, cfg.SpoolFile, spoolInterval, logger, notify)
+	if err != nil {
+		logger.Fatalf("Fail to open spool: %v", err)
+	}
 
 	kraken := kraken.New(logger, notify, cfg.APIPublic, cfg.APIPrivate)
 	robot := robot.New(kraken, repo, logger, notify)
+	robot.SetWarmUp(cfg.WarmUp)
+	if err = robot.LoadInstruments(context.Background()); err != nil {
+		logger.Errorf("Fail to load instruments, markets aren't validated: %v", err)
+	}
+	robot.StartInstruments(instrumentsInterval)
+	if err = robot.Restore(context.Background(), cfg.AutoResume); err != nil {
+		logger.Errorf("Fail to restore settings: %v", err)
+	}
+	robot.StartSummary(summaryInterval)
+	robot.StartReconcile(reconcileInterval)
 	handler := handlers.New(robot, logger)
 
 	baseCtx, baseCancel := context.WithCancel(context.Background())
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/cgriceld/crypto-trade-bot/internal/repository"
+	"github.com/cgriceld/crypto-trade-bot/internal/repository/migrations"
+	"github.com/cgriceld/crypto-trade-bot/pkg/log"
+	pgs "github.com/cgriceld/crypto-trade-bot/pkg/postgres"
+
+	"github.com/sirupsen/logrus"
+)
+
+const migrateUsage = "Usage: migrate up | down [steps] | status"
+
+// migrate runs migrate subcommand with args: up, down [steps] or status.
+// Only dsn has to be set.
+func migrate(l *logrus.Logger, logger log.Logger, args []string) error {
+	if len(args) == 0 || len(args) > 2 {
+		return fmt.Errorf(migrateUsage)
+	}
+
+	steps := 1
+	if len(args) == 2 {
+		n, err := strconv.Atoi(args[1])
+		if args[0] != "down" || err != nil || n <= 0 {
+			return fmt.Errorf(migrateUsage)
+		}
+		steps = n
+	}
+
+	dsn, _ := os.LookupEnv("dsn")
+	if dsn == "" {
+		return fmt.Errorf("No config: dsn")
+	}
+	if repository.IsSQLite(dsn) {
+		return fmt.Errorf("SQLite schema is migrated at server start")
+	}
+
+	pool, err := pgs.NewPool(l, dsn)
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	migrator, err := migrations.New(pool, logger)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	switch args[0] {
+	case "up":
+		n, err := migrator.Up(ctx)
+		if err != nil {
+			return err
+		}
+		logger.Infof("%v migrations applied", n)
+	case "down":
+		n, err := migrator.Down(ctx, steps)
+		if err != nil {
+			return err
+		}
+		logger.Infof("%v migrations rolled back", n)
+	case "status":
+		res, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+		for _, s := range res {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%04d\t%v\t%v\n", s.Version, s.Name, applied)
+		}
+		return w.Flush()
+	default:
+		return fmt.Errorf(migrateUsage)
+	}
+
+	return nil
+}
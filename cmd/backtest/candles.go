@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/cgriceld/crypto-trade-bot/internal/domain"
+)
+
+// loadCandles reads candles from .json file (array of Kraken candles or Kraken
+// charts response) or from .csv file with time,open,high,low,close columns.
+func loadCandles(path string) ([]domain.Candle, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Fail to open candles: %w", err)
+	}
+	defer f.Close()
+
+	var candles []domain.Candle
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		candles, err = decodeJSON(f)
+	case ".csv":
+		candles, err = decodeCSV(f)
+	default:
+		return nil, fmt.Errorf("Unknown candles format: %v", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(candles) == 0 {
+		return nil, fmt.Errorf("No candles in %v", path)
+	}
+
+	return candles, nil
+}
+
+func decodeJSON(r io.Reader) ([]domain.Candle, error) {
+	by, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("Fail to read candles: %w", err)
+	}
+
+	var candles []domain.Candle
+	if err = json.Unmarshal(by, &candles); err == nil {
+		return candles, validate(candles)
+	}
+
+	var chart struct {
+		Candles []domain.Candle `json:"candles"`
+	}
+	if err = json.Unmarshal(by, &chart); err != nil {
+		return nil, fmt.Errorf("Fail to decode candles: %w", err)
+	}
+
+	return chart.Candles, validate(chart.Candles)
+}
+
+func decodeCSV(r io.Reader) ([]domain.Candle, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("Fail to read candles: %w", err)
+	}
+
+	var candles []domain.Candle
+	for i, row := range rows {
+		if len(row) < 5 {
+			return nil, fmt.Errorf("Fail to decode candles: line %v: expect time,open,high,low,close", i+1)
+		}
+
+		ts, err := strconv.ParseFloat(strings.TrimSpace(row[0]), 64)
+		if err != nil {
+			// header
+			if i == 0 {
+				continue
+			}
+			return nil, fmt.Errorf("Fail to decode candles: line %v: %w", i+1, err)
+		}
+
+		candles = append(candles, domain.Candle{
+			Time:  ts,
+			Open:  strings.TrimSpace(row[1]),
+			High:  strings.TrimSpace(row[2]),
+			Low:   strings.TrimSpace(row[3]),
+			Close: strings.TrimSpace(row[4]),
+		})
+	}
+
+	return candles, validate(candles)
+}
+
+func validate(candles []domain.Candle) error {
+	for _, c := range candles {
+		for _, v := range []string{c.Open, c.High, c.Low, c.Close} {
+			if _, err := strconv.ParseFloat(v, 64); err != nil {
+				return fmt.Errorf("Fail to decode candles: %v: %w", c.Time, err)
+			}
+		}
+	}
+
+	return nil
+}
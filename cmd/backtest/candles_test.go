@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/cgriceld/crypto-trade-bot/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type Decode struct {
+	name  string
+	input string
+	res   []domain.Candle
+	err   error
+}
+
+var (
+	decoded = []domain.Candle{
+		{Time: 1, Open: "1", High: "2", Low: "0.5", Close: "1.5"},
+		{Time: 2, Open: "1.5", High: "3", Low: "1", Close: "2"},
+	}
+)
+
+func TestDecodeCSV(t *testing.T) {
+	tests := []Decode{
+		{"Header", "time,open,high,low,close\n1,1,2,0.5,1.5\n2,1.5,3,1,2\n", decoded, nil},
+		{"No header", "1,1,2,0.5,1.5\n2,1.5,3,1,2\n", decoded, nil},
+		{"Short line", "1,1,2,0.5\n", nil, errors.New("Fail to decode candles: line 1: expect time,open,high,low,close")},
+	}
+
+	for _, test := range tests {
+		res, err := decodeCSV(strings.NewReader(test.input))
+
+		if !assert.Equal(t, test.err, err, "%v: Expect: %v, Got: %v", test.name, test.err, err) ||
+			!assert.Equal(t, test.res, res, "%v: Expect: %v, Got: %v", test.name, test.res, res) {
+			t.Fatal()
+		}
+	}
+}
+
+func TestDecodeJSON(t *testing.T) {
+	tests := []Decode{
+		{"Array", `[{"time":1,"open":"1","high":"2","low":"0.5","close":"1.5"},{"time":2,"open":"1.5","high":"3","low":"1","close":"2"}]`, decoded, nil},
+		{"Chart", `{"candles":[{"time":1,"open":"1","high":"2","low":"0.5","close":"1.5"},{"time":2,"open":"1.5","high":"3","low":"1","close":"2"}],"more_candles":false}`, decoded, nil},
+	}
+
+	for _, test := range tests {
+		res, err := decodeJSON(strings.NewReader(test.input))
+
+		if !assert.Equal(t, test.err, err, "%v: Expect: %v, Got: %v", test.name, test.err, err) ||
+			!assert.Equal(t, test.res, res, "%v: Expect: %v, Got: %v", test.name, test.res, res) {
+			t.Fatal()
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/cgriceld/crypto-trade-bot/internal/domain"
+	"github.com/cgriceld/crypto-trade-bot/internal/services/robot"
+	"github.com/cgriceld/crypto-trade-bot/pkg/log"
+	"github.com/cgriceld/crypto-trade-bot/pkg/simulator"
+
+	"github.com/sirupsen/logrus"
+)
+
+// orders collects repeated -sell/-buy flags in form price:size,
+// or distance[%]:size for trailing ones.
+type orders []domain.Order
+
+func (o *orders) String() string {
+	return fmt.Sprint(*o)
+}
+
+func (o *orders) Set(val string) error {
+	parts := strings.Split(val, ":")
+	if len(parts) != 2 {
+		return fmt.Errorf("expect price:size, got %v", val)
+	}
+
+	size, err := strconv.Atoi(parts[1])
+	if err != nil || size <= 0 {
+		return fmt.Errorf("wrong size: %v", parts[1])
+	}
+
+	var order domain.Order
+	order.Size = size
+
+	if strings.HasPrefix(parts[0], "~") {
+		trail := &domain.Trailing{}
+		d := strings.TrimPrefix(parts[0], "~")
+		if strings.HasSuffix(d, "%") {
+			trail.Percent = true
+			d = strings.TrimSuffix(d, "%")
+		}
+		if trail.Distance, err = strconv.ParseFloat(d, 64); err != nil || trail.Distance <= 0 {
+			return fmt.Errorf("wrong distance: %v", parts[0])
+		}
+		order.Trailing = trail
+	} else if order.Price, err = strconv.ParseFloat(parts[0], 64); err != nil || order.Price <= 0 {
+		return fmt.Errorf("wrong price: %v", parts[0])
+	}
+
+	*o = append(*o, order)
+	return nil
+}
+
+type notifier struct {
+	logger log.Logger
+}
+
+func (n *notifier) Notify(m domain.Market, message string) {
+	n.logger.Infof("notify: %v", message)
+}
+
+type memory struct {
+	orders []domain.Order
+}
+
+func (s *memory) SaveOrder(ctx context.Context, order domain.Order) error {
+	s.orders = append(s.orders, order)
+	return nil
+}
+
+func (s *memory) GetOrders(ctx context.Context, filter domain.OrderFilter) (*domain.OrdersResp, error) {
+	return &domain.OrdersResp{Orders: s.orders}, nil
+}
+
+func (s *memory) EachOrder(ctx context.Context, filter domain.OrderFilter, fn func(domain.Order) error) error {
+	for _, v := range s.orders {
+		if err := fn(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *memory) SaveSettings(ctx context.Context, settings domain.MarketSettings) error {
+	return nil
+}
+
+func (s *memory) GetSettings(ctx context.Context) ([]domain.MarketSettings, error) {
+	return nil, nil
+}
+
+func (s *memory) SaveCandle(ctx context.Context, candle domain.CandleRecord) error {
+	return nil
+}
+
+func (s *memory) GetCandles(ctx context.Context, filter domain.CandleFilter) ([]domain.CandleRecord, error) {
+	return nil, nil
+}
+
+func (s *memory) Close() {
+}
+
+func main() {
+	var sells, buys orders
+	file := flag.String("file", "", "candles file, .csv (time,open,high,low,close) or .json")
+	market := flag.String("market", "pi_xbtusd", "market")
+	strategy := flag.String("strategy", robot.DefaultStrategy, "strategy name")
+	oco := flag.Bool("oco", false, "link sell and buy orders")
+	source := flag.String("source", domain.DefaultSource, "candle price: close, ohlc4, hlc3 or hilo")
+	slippage := flag.Float64("slippage", 0, "slippage, percent of price")
+	fee := flag.Float64("fee", 0, "fee, percent of order value")
+	verbose := flag.Bool("v", false, "log robot events")
+	flag.Var(&sells, "sell", "sell order price:size or trailing ~distance[%]:size, may be repeated")
+	flag.Var(&buys, "buy", "buy order price:size or trailing ~distance[%]:size, may be repeated")
+	flag.Parse()
+
+	level := logrus.WarnLevel
+	if *verbose {
+		level = logrus.InfoLevel
+	}
+	logger := log.NewLog(logrus.New(), level, os.Stderr)
+
+	if *file == "" {
+		logger.Fatal("No candles file, use -file")
+	}
+	candles, err := loadCandles(*file)
+	if err != nil {
+		logger.Fatalf("Fail to load candles: %v", err)
+	}
+
+	exchange := simulator.New(candles, simulator.Executor{Slippage: *slippage, Fee: *fee})
+	r := robot.New(exchange, &memory{}, logger, &notifier{logger: logger})
+	// candles of the file are the whole history
+	r.SetWarmUp(0)
+
+	ctx := context.Background()
+	m := domain.Market(*market)
+	r.SetMarket(ctx, m)
+	if err = r.SetStrategy(ctx, m, *strategy); err != nil {
+		logger.Fatal(err)
+	}
+	if err = r.SetOCO(ctx, m, *oco); err != nil {
+		logger.Fatal(err)
+	}
+	if err = r.SetFeed(ctx, m, domain.Feed{Source: *source}); err != nil {
+		logger.Fatal(err)
+	}
+	for _, order := range sells {
+		order.Typ = "sell"
+		if _, err = r.AddTrigger(ctx, m, order); err != nil {
+			logger.Fatal(err)
+		}
+	}
+	for _, order := range buys {
+		order.Typ = "buy"
+		if _, err = r.AddTrigger(ctx, m, order); err != nil {
+			logger.Fatal(err)
+		}
+	}
+
+	if _, err = r.StartMarket(ctx, m); err != nil {
+		logger.Fatal(err)
+	}
+	_ = r.StopMarket(ctx, m)
+
+	last, _ := strconv.ParseFloat(candles[len(candles)-1].Close, 64)
+	newReport(exchange.Executed(), last, r.Tracker(m)).print(os.Stdout)
+}
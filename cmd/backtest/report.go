@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+
+	"github.com/cgriceld/crypto-trade-bot/internal/domain"
+	"github.com/cgriceld/crypto-trade-bot/internal/services/robot"
+)
+
+type report struct {
+	fills    []domain.Order
+	position int
+	fees     float64
+	pnl      float64
+	drawdown float64
+	currency string
+}
+
+// newReport marks the position of tracker to market after every fill and
+// after the last candle (at price last) to get PnL and maximum drawdown.
+// PnL is computed by the robot for the contract of the market, e.g. in XBT
+// for inverse ones, and doesn't include fees.
+func newReport(fills []domain.Order, last float64, tracker *robot.Tracker) *report {
+	rep := &report{fills: fills}
+
+	var peak float64
+	mark := func(price float64) {
+		p := tracker.Mark(price)
+		equity := math.Round((p.Realized+p.Unrealized)*1e8) / 1e8
+		if equity > peak {
+			peak = equity
+		}
+		if drawdown := math.Round((peak-equity)*1e8) / 1e8; drawdown > rep.drawdown {
+			rep.drawdown = drawdown
+		}
+		rep.pnl = equity
+		rep.position = p.Size
+		rep.fees = p.Fees
+		rep.currency = p.PnLCurrency
+	}
+
+	for _, f := range fills {
+		tracker.Apply(f)
+		mark(f.Price)
+	}
+	mark(last)
+
+	return rep
+}
+
+func (rep *report) print(w io.Writer) {
+	fmt.Fprintln(w, "fills:")
+	for _, f := range rep.fills {
+		fmt.Fprintf(w, "  %-4s %-8s %4d @ %.2f, fee %.2f\n", f.Typ, f.ID, f.Size, f.Price, f.Fee)
+	}
+
+	// PnL of inverse contracts is a fraction of coin
+	pnl := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	fmt.Fprintf(w, "trades:       %d\n", len(rep.fills))
+	fmt.Fprintf(w, "position:     %d\n", rep.position)
+	fmt.Fprintf(w, "fees:         %.2f\n", rep.fees)
+	fmt.Fprintf(w, "pnl:          %v %v\n", pnl(rep.pnl), rep.currency)
+	fmt.Fprintf(w, "max drawdown: %v %v\n", pnl(rep.drawdown), rep.currency)
+}
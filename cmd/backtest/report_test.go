@@ -0,0 +1,53 @@
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/cgriceld/crypto-trade-bot/internal/domain"
+	"github.com/cgriceld/crypto-trade-bot/internal/services/robot"
+	"github.com/cgriceld/crypto-trade-bot/pkg/log"
+	"github.com/cgriceld/crypto-trade-bot/pkg/simulator"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReport(t *testing.T) {
+	logger := log.NewLog(logrus.New(), logrus.WarnLevel, ioutil.Discard)
+	r := robot.New(simulator.New(nil, simulator.Executor{}), &memory{}, logger, &notifier{logger: logger})
+
+	tests := []struct {
+		name     string
+		market   domain.Market
+		fills    []domain.Order
+		last     float64
+		position int
+		fees     float64
+		pnl      float64
+		drawdown float64
+		currency string
+	}{
+		{"Linear", "pf_ethusd", []domain.Order{
+			{Typ: "buy", Price: 100, Size: 2, Fee: 1},
+			{Typ: "sell", Price: 90, Size: 1, Fee: 1},
+			{Typ: "sell", Price: 130, Size: 1, Fee: 1},
+		}, 120, 0, 3, 20, 20, "USD"},
+		{"Inverse", "pi_xbtusd", []domain.Order{
+			{Typ: "buy", Price: 50000, Size: 2},
+			{Typ: "sell", Price: 62500, Size: 1},
+		}, 40000, 1, 0, -0.000001, 0.000009, "XBT"},
+	}
+
+	for _, test := range tests {
+		rep := newReport(test.fills, test.last, r.Tracker(test.market))
+
+		if !assert.Equal(t, test.position, rep.position, test.name) ||
+			!assert.Equal(t, test.fees, rep.fees, test.name) ||
+			!assert.Equal(t, test.pnl, rep.pnl, test.name) ||
+			!assert.Equal(t, test.drawdown, rep.drawdown, test.name) ||
+			!assert.Equal(t, test.currency, rep.currency, test.name) {
+			t.Fatal()
+		}
+	}
+}
@@ -1 +0,0 @@
-create table orders(ts timestamp, market text, type text, price numeric, size numeric);
\ No newline at end of file
@@ -5,18 +5,39 @@ import (
 	"crypto/sha256"
 	"crypto/sha512"
 	"encoding/base64"
+	"errors"
+	"math"
 	"strconv"
+	"strings"
 	"time"
 )
 
 const (
-	MarketName   Market = "market"
-	TriggerPrice Market = "price"
-	OrderSize    Market = "size"
+	MarketName    Market = "market"
+	TriggerPrice  Market = "price"
+	OrderSize     Market = "size"
+	OrderSide     Market = "type"
+	TrailDistance Market = "distance"
+	OCOLink       Market = "oco"
+	TriggerID     Market = "id"
+	StrategyName  Market = "strategy"
+	PaperMode     Market = "paper"
+	CandleFeed    Market = "feed"
+	Conditions    Market = "cond"
+	OrdersQuery   Market = "orders"
+	ExportFormat  Market = "format"
+	CandlesQuery  Market = "candles"
+	ExecQuery     Market = "execution"
+	ExchangeOrder Market = "exchange"
+	FillsQuery    Market = "fills"
+	CancelQuery   Market = "cancel"
 )
 
 var (
 	InternalServerError = "Internal Server Error"
+	// UnsuccessfulResponse is wrapped by errors of Kraken requests answered
+	// with "result":"error", Kraken error text follows it.
+	UnsuccessfulResponse = errors.New("Unsuccessful response")
 )
 
 type Market string
@@ -24,15 +45,382 @@ type Price float64
 type Size int
 
 type Order struct {
-	Time   *time.Time `json:"time,omitempty"`
-	Market string     `json:"market"`
-	Typ    string     `json:"type"`
-	Price  float64    `json:"price"`
-	Size   int        `json:"size"`
+	Time       *time.Time `json:"time,omitempty"`
+	ID         string     `json:"id,omitempty"`
+	Market     string     `json:"market"`
+	Typ        string     `json:"type"`
+	Price      float64    `json:"price"`
+	Size       int        `json:"size"`
+	Fee        float64    `json:"fee,omitempty"`
+	Paper      bool       `json:"paper,omitempty"`
+	Trailing   *Trailing  `json:"trailing,omitempty"`
+	OCO        bool       `json:"oco,omitempty"`
+	Conditions []string   `json:"conditions,omitempty"`
+	Interval   string     `json:"interval,omitempty"`
+	Source     string     `json:"source,omitempty"`
+	Execution
+	// Kraken fills of the resting order which are already in the ledger
+	Fills []string `json:"fills,omitempty"`
+
+	// order ledger
+	ClientID     string     `json:"cli_ord_id,omitempty"`
+	OrderID      string     `json:"order_id,omitempty"`
+	Outcome      string     `json:"outcome,omitempty"`
+	Status       string     `json:"status,omitempty"`
+	Error        string     `json:"error,omitempty"`
+	TriggerPrice float64    `json:"trigger_price,omitempty"`
+	SentAt       *time.Time `json:"sent_at,omitempty"`
+	ReceivedAt   *time.Time `json:"received_at,omitempty"`
+
+	// database row, used for pagination
+	RowID int64 `json:"-"`
+}
+
+// Outcomes of sending order to Kraken. Open orders were placed, but rest on
+// the exchange without executions.
+const (
+	OrderPlaced   = "placed"
+	OrderOpen     = "open"
+	OrderRejected = "rejected"
+	OrderNoFunds  = "insufficient_funds"
+	OrderFailed   = "error"
+)
+
+var Outcomes = []string{OrderPlaced, OrderOpen, OrderRejected, OrderNoFunds, OrderFailed}
+
+// Kraken Futures order types, ioc is used if type is not set.
+const (
+	OrderLimit      = "lmt"
+	OrderPost       = "post"
+	OrderMarket     = "mkt"
+	OrderStop       = "stp"
+	OrderTakeProfit = "take_profit"
+	OrderIOC        = "ioc"
+)
+
+var (
+	OrderTypes = []string{OrderLimit, OrderPost, OrderMarket, OrderStop, OrderTakeProfit, OrderIOC}
+	// TriggerSignals are prices stop and take profit orders are triggered by.
+	TriggerSignals = []string{"mark", "index", "last"}
+)
+
+// Execution describes how order is sent to Kraken. Limit orders are sent
+// at the trigger price, stop and take profit orders are market orders
+// triggered at StopPrice by TriggerSignal (Kraken uses mark price if it's
+// empty). ReduceOnly orders can only reduce the open position.
+type Execution struct {
+	OrderType     string  `json:"order_type,omitempty"`
+	StopPrice     float64 `json:"stop_price,omitempty"`
+	ReduceOnly    bool    `json:"reduce_only,omitempty"`
+	TriggerSignal string  `json:"trigger_signal,omitempty"`
+}
+
+// Kind returns Kraken order type, ioc by default.
+func (e Execution) Kind() string {
+	if e.OrderType == "" {
+		return OrderIOC
+	}
+	return e.OrderType
+}
+
+// Stop reports whether order is triggered on the exchange by its stop price.
+func (e Execution) Stop() bool {
+	return e.OrderType == OrderStop || e.OrderType == OrderTakeProfit
+}
+
+// Resting reports whether order may stay in the order book without executions,
+// ioc and market orders are executed at once or cancelled.
+func (e Execution) Resting() bool {
+	return e.Kind() != OrderIOC && e.Kind() != OrderMarket
+}
+
+// Invalid returns the name of the first wrong field (as API query parameter),
+// empty string if execution is valid. Only stop orders have stop price
+// and trigger signal.
+func (e Execution) Invalid() string {
+	switch {
+	case e.OrderType != "" && !Contains(OrderTypes, e.OrderType):
+		return "order_type"
+	case e.Stop() && e.StopPrice <= 0, !e.Stop() && e.StopPrice != 0:
+		return "stop_price"
+	case e.TriggerSignal != "" && (!e.Stop() || !Contains(TriggerSignals, e.TriggerSignal)):
+		return "trigger_signal"
+	}
+
+	return ""
+}
+
+// Contains reports whether v is one of values.
+func Contains(values []string, v string) bool {
+	for _, val := range values {
+		if val == v {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	DefaultOrdersLimit = 100
+	MaxOrdersLimit     = 1000
+)
+
+// OrderFilter selects orders from the ledger, empty fields match all orders.
+// Orders are sorted by time (newest first if Desc) and returned by pages of
+// Limit orders, Cursor points to the last order of the previous page.
+type OrderFilter struct {
+	Outcome string
+	Market  string
+	Side    string
+	From    *time.Time
+	To      *time.Time
+	Limit   int
+	Cursor  *Cursor
+	Desc    bool
+}
+
+// Cursor is the position of order in the ledger sorted by time and row.
+type Cursor struct {
+	Time  time.Time
+	RowID int64
+}
+
+func (c Cursor) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(c.Time.UnixNano(), 10) + ":" + strconv.FormatInt(c.RowID, 10)))
+}
+
+// ParseCursor parses cursor returned as next_cursor of orders page.
+func ParseCursor(s string) (*Cursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := strings.SplitN(string(b), ":", 2)
+	if len(parts) != 2 {
+		return nil, strconv.ErrSyntax
+	}
+	ts, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	id, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Cursor{Time: time.Unix(0, ts).UTC(), RowID: id}, nil
+}
+
+// ExportFormats are formats of trade history export.
+var ExportFormats = []string{"csv", "jsonl"}
+
+// TradeRecord is an executed order in trade history export with PnL it realized
+// in PnLCurrency, see Position.
+type TradeRecord struct {
+	Time        *time.Time `json:"time"`
+	OrderID     string     `json:"order_id"`
+	Market      string     `json:"market"`
+	Side        string     `json:"side"`
+	Price       float64    `json:"price"`
+	Size        int        `json:"size"`
+	Fee         float64    `json:"fee"`
+	Realized    float64    `json:"realized_pnl"`
+	PnLCurrency string     `json:"pnl_currency"`
+	Paper       bool       `json:"paper"`
+}
+
+// OrdersResp is a page of orders ledger, NextCursor is empty on the last page.
+type OrdersResp struct {
+	Orders     []Order `json:"orders"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+}
+
+const (
+	DefaultCandlesLimit = 1000
+	MaxCandlesLimit     = 10000
+)
+
+// CandleRecord is a candle of market feed with interval stored in the candle
+// history, there is one record per market, interval and time.
+type CandleRecord struct {
+	Market   string    `json:"market"`
+	Interval string    `json:"interval"`
+	Time     time.Time `json:"time"`
+	Open     float64   `json:"open"`
+	High     float64   `json:"high"`
+	Low      float64   `json:"low"`
+	Close    float64   `json:"close"`
+	Volume   float64   `json:"volume"`
+}
+
+// NewCandleRecord converts Kraken candle of market feed with interval.
+func NewCandleRecord(m Market, interval string, c Candle) (CandleRecord, error) {
+	var ohlc [4]float64
+	for i, v := range []string{c.Open, c.High, c.Low, c.Close} {
+		val, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return CandleRecord{}, err
+		}
+		ohlc[i] = val
+	}
+
+	return CandleRecord{
+		Market:   string(m),
+		Interval: interval,
+		Time:     time.UnixMilli(int64(c.Time)).UTC(),
+		Open:     ohlc[0],
+		High:     ohlc[1],
+		Low:      ohlc[2],
+		Close:    ohlc[3],
+		Volume:   c.Volume,
+	}, nil
+}
+
+// Candle converts record back to Kraken candle.
+func (c CandleRecord) Candle() Candle {
+	format := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+
+	return Candle{
+		Open:   format(c.Open),
+		High:   format(c.High),
+		Low:    format(c.Low),
+		Close:  format(c.Close),
+		Time:   float64(c.Time.UnixMilli()),
+		Volume: c.Volume,
+	}
+}
+
+// CandleFilter selects candles of market feed with interval from the candle
+// history. Candles are sorted by time (newest first if Desc), at most Limit
+// candles are returned.
+type CandleFilter struct {
+	Market   string
+	Interval string
+	From     *time.Time
+	To       *time.Time
+	Limit    int
+	Desc     bool
+}
+
+const (
+	DefaultInterval = "1m"
+	DefaultSource   = "ohlc4"
+)
+
+var (
+	// Intervals are candle intervals of Kraken Futures candles_trade feeds.
+	Intervals = []string{"1m", "5m", "15m", "30m", "1h", "4h", "12h", "1d", "1w"}
+	// PriceSources are candle prices orders can be triggered with: close,
+	// (open+high+low+close)/4, (high+low+close)/3, or high for sell orders
+	// and low for buy orders (hilo).
+	PriceSources = []string{"close", "ohlc4", "hlc3", "hilo"}
+)
+
+var intervalDurations = map[string]time.Duration{
+	"1m": time.Minute, "5m": 5 * time.Minute, "15m": 15 * time.Minute, "30m": 30 * time.Minute,
+	"1h": time.Hour, "4h": 4 * time.Hour, "12h": 12 * time.Hour, "1d": 24 * time.Hour, "1w": 7 * 24 * time.Hour,
+}
+
+// IntervalDuration returns duration of candle interval, 0 if it's unknown.
+func IntervalDuration(interval string) time.Duration {
+	return intervalDurations[interval]
+}
+
+// Feed configures candles of a market, empty fields mean defaults
+// (or unchanged settings when passed to the robot).
+type Feed struct {
+	Interval string `json:"interval,omitempty"`
+	Source   string `json:"source,omitempty"`
+}
+
+// Paper configures paper trading on a market: orders are filled in process
+// with Slippage and Fee (percents) instead of being sent to Kraken.
+type Paper struct {
+	Enabled  bool    `json:"paper"`
+	Slippage float64 `json:"slippage"`
+	Fee      float64 `json:"fee"`
+}
+
+// Trailing describes a trigger which follows the best price seen since arming
+// by Distance (absolute or percentage) and fires when price retraces by it.
+type Trailing struct {
+	Distance float64 `json:"distance"`
+	Percent  bool    `json:"percent"`
+	Best     float64 `json:"best"`
+}
+
+// Level returns the current trigger level of the trailing order of type typ,
+// zero if no price has been seen yet.
+func (t *Trailing) Level(typ string) float64 {
+	if t.Best == 0 {
+		return 0
+	}
+
+	d := t.Distance
+	if t.Percent {
+		d = t.Best * t.Distance / 100
+	}
+
+	if typ == "sell" {
+		return t.Best - d
+	}
+	return t.Best + d
 }
 
 type SendStatus struct {
-	Stat string `json:"status"`
+	OrderID  string       `json:"order_id,omitempty"`
+	Stat     string       `json:"status"`
+	Received string       `json:"receivedTime,omitempty"`
+	Events   []OrderEvent `json:"orderEvents,omitempty"`
+}
+
+type OrderEvent struct {
+	Type        string  `json:"type"`
+	Price       float64 `json:"price"`
+	Amount      float64 `json:"amount"`
+	ExecutionID string  `json:"executionId,omitempty"`
+}
+
+// Executed returns the average price and the amount of order executions,
+// zero amount if order wasn't executed (e.g. it rests in the order book).
+func (s SendStatus) Executed() (float64, float64) {
+	var value, amount float64
+	for _, e := range s.Events {
+		if e.Type == "EXECUTION" {
+			value += e.Price * e.Amount
+			amount += e.Amount
+		}
+	}
+	if amount == 0 {
+		return 0, 0
+	}
+
+	return value / amount, amount
+}
+
+// Executions returns IDs of order executions, they are fill IDs of fills.
+func (s SendStatus) Executions() []string {
+	var res []string
+	for _, e := range s.Events {
+		if e.Type == "EXECUTION" && e.ExecutionID != "" {
+			res = append(res, e.ExecutionID)
+		}
+	}
+
+	return res
+}
+
+// ReceivedTime returns the time Kraken received the order, nil if unknown.
+func (s SendStatus) ReceivedTime() *time.Time {
+	ts, err := time.Parse(time.RFC3339, s.Received)
+	if err != nil {
+		return nil
+	}
+
+	return &ts
 }
 
 type RespOrder struct {
@@ -41,6 +429,90 @@ type RespOrder struct {
 	Error  string     `json:"error"`
 }
 
+type CancelStatus struct {
+	OrderID  string `json:"order_id,omitempty"`
+	Stat     string `json:"status"`
+	Received string `json:"receivedTime,omitempty"`
+}
+
+// RespCancel is a response to cancelorder, the order is cancelled if status
+// is "cancelled", "filled" and "notFound" mean it's not in the order book.
+type RespCancel struct {
+	Result string       `json:"result"`
+	Status CancelStatus `json:"cancelStatus"`
+	Error  string       `json:"error"`
+}
+
+type EditStatus struct {
+	OrderID  string `json:"orderId,omitempty"`
+	Stat     string `json:"status"`
+	Received string `json:"receivedTime,omitempty"`
+}
+
+// RespEdit is a response to editorder, the order is changed if status is "edited".
+type RespEdit struct {
+	Result string     `json:"result"`
+	Status EditStatus `json:"editStatus"`
+	Error  string     `json:"error"`
+}
+
+// CancelledOrder is an order cancelled by cancelallorders.
+type CancelledOrder struct {
+	OrderID  string `json:"order_id"`
+	ClientID string `json:"cliOrdId,omitempty"`
+}
+
+// CancelAllStatus is a status of cancelallorders, "noOrdersToCancel" if there
+// were no open orders.
+type CancelAllStatus struct {
+	Stat       string           `json:"status"`
+	CancelOnly string           `json:"cancelOnly,omitempty"`
+	Received   string           `json:"receivedTime,omitempty"`
+	Orders     []CancelledOrder `json:"cancelledOrders"`
+}
+
+// OpenOrder is an order resting in the Kraken order book.
+type OpenOrder struct {
+	OrderID       string  `json:"order_id"`
+	ClientID      string  `json:"cliOrdId,omitempty"`
+	Symbol        string  `json:"symbol"`
+	Side          string  `json:"side"`
+	OrderType     string  `json:"orderType"`
+	LimitPrice    float64 `json:"limitPrice,omitempty"`
+	StopPrice     float64 `json:"stopPrice,omitempty"`
+	FilledSize    float64 `json:"filledSize"`
+	UnfilledSize  float64 `json:"unfilledSize"`
+	ReduceOnly    bool    `json:"reduceOnly"`
+	TriggerSignal string  `json:"triggerSignal,omitempty"`
+	Status        string  `json:"status"`
+	Received      string  `json:"receivedTime"`
+	LastUpdate    string  `json:"lastUpdateTime,omitempty"`
+}
+
+// OpenPosition is a position of Kraken account, side is long or short.
+type OpenPosition struct {
+	Symbol            string  `json:"symbol"`
+	Side              string  `json:"side"`
+	Price             float64 `json:"price"`
+	Size              float64 `json:"size"`
+	FillTime          string  `json:"fillTime"`
+	UnrealizedFunding float64 `json:"unrealizedFunding,omitempty"`
+}
+
+// Fill is an execution of order on Kraken, fill type is maker, taker,
+// liquidation etc.
+type Fill struct {
+	FillID   string  `json:"fill_id"`
+	Symbol   string  `json:"symbol"`
+	Side     string  `json:"side"`
+	OrderID  string  `json:"order_id"`
+	ClientID string  `json:"cliOrdId,omitempty"`
+	Size     float64 `json:"size"`
+	Price    float64 `json:"price"`
+	FillTime string  `json:"fillTime"`
+	FillType string  `json:"fillType"`
+}
+
 type Subscribe struct {
 	Event    string   `json:"event"`
 	Mess     string   `json:"message,omitempty"`
@@ -49,52 +521,171 @@ type Subscribe struct {
 }
 
 type Candle struct {
-	Close string  `json:"close"`
-	Open  string  `json:"open"`
-	High  string  `json:"high"`
-	Low   string  `json:"low"`
-	Time  float64 `json:"time"`
+	Close  string  `json:"close"`
+	Open   string  `json:"open"`
+	High   string  `json:"high"`
+	Low    string  `json:"low"`
+	Time   float64 `json:"time"`
+	Volume float64 `json:"volume"`
 }
 
 type CandleSub struct {
 	Cand Candle `json:"candle"`
 }
 
+// Types of Kraken accounts: cash account holds spot balances, margin account
+// is the collateral of single-collateral futures in its currency, flex account
+// is the multi-collateral one.
+const (
+	CashAccount   = "cashAccount"
+	MarginAccount = "marginAccount"
+	FlexAccount   = "multiCollateralMarginAccount"
+)
+
+// Margin is the margin requirement of account, liquidation and termination
+// thresholds are reported by margin accounts only.
+type Margin struct {
+	Initial     float64 `json:"initial"`
+	Maintenance float64 `json:"maintenance"`
+	Liquidation float64 `json:"liquidation,omitempty"`
+	Termination float64 `json:"termination,omitempty"`
+}
+
+// Account is a Kraken account of any type. Balances are amounts per currency,
+// values of margin account are in its currency, values of flex account in USD.
+type Account struct {
+	Type              string             `json:"type"`
+	Currency          string             `json:"currency,omitempty"`
+	Balances          map[string]float64 `json:"balances"`
+	Margin            *Margin            `json:"margin,omitempty"`
+	PortfolioValue    float64            `json:"portfolio_value"`
+	AvailableFunds    float64            `json:"available_funds"`
+	PnL               float64            `json:"pnl"`
+	UnrealizedFunding float64            `json:"unrealized_funding"`
+}
+
+// AccountsResp are accounts of the user by their names.
 type AccountsResp struct {
-	Fi_xbtusd float64 `json:"fi_xbtusd"`
-	Fi_bchusd float64 `json:"fi_bchusd"`
-	Fi_ethusd float64 `json:"fi_ethusd"`
-	Fi_ltcusd float64 `json:"fi_ltcusd"`
-	Fi_xrpusd float64 `json:"fi_xrpusd"`
-	Fv_xrpxbt float64 `json:"fv_xrpxbt"`
+	ServerTime string             `json:"server_time,omitempty"`
+	Accounts   map[string]Account `json:"accounts"`
 }
 
 type Auxiliary struct {
-	Af float64 `json:"af"`
+	USD     float64 `json:"usd"`
+	PV      float64 `json:"pv"`
+	PnL     float64 `json:"pnl"`
+	Af      float64 `json:"af"`
+	Funding float64 `json:"funding"`
+}
+
+type MarginRequirements struct {
+	Im float64 `json:"im"`
+	Mm float64 `json:"mm"`
+	Lt float64 `json:"lt"`
+	Tt float64 `json:"tt"`
 }
 
+type FlexCurrency struct {
+	Quantity   float64 `json:"quantity"`
+	Value      float64 `json:"value"`
+	Collateral float64 `json:"collateral"`
+	Available  float64 `json:"available"`
+}
+
+// Funds is an account as Kraken sends it, the fields depend on its type.
 type Funds struct {
-	Aux Auxiliary `json:"auxiliary"`
+	Type              string                  `json:"type"`
+	Currency          string                  `json:"currency"`
+	Balances          map[string]float64      `json:"balances"`
+	Aux               Auxiliary               `json:"auxiliary"`
+	Requirements      *MarginRequirements     `json:"marginRequirements"`
+	Currencies        map[string]FlexCurrency `json:"currencies"`
+	InitialMargin     float64                 `json:"initialMargin"`
+	MaintenanceMargin float64                 `json:"maintenanceMargin"`
+	PortfolioValue    float64                 `json:"portfolioValue"`
+	PnL               float64                 `json:"pnl"`
+	UnrealizedFunding float64                 `json:"unrealizedFunding"`
+	AvailableMargin   float64                 `json:"availableMargin"`
 }
 
-type Markets struct {
-	Fi_xbtusd Funds `json:"fi_xbtusd"`
-	Fi_bchusd Funds `json:"fi_bchusd"`
-	Fi_ethusd Funds `json:"fi_ethusd"`
-	Fi_ltcusd Funds `json:"fi_ltcusd"`
-	Fi_xrpusd Funds `json:"fi_xrpusd"`
-	Fv_xrpxbt Funds `json:"fv_xrpxbt"`
+// Account converts funds to the account of their type, accounts of unknown
+// types are read as margin ones.
+func (f Funds) Account() Account {
+	acc := Account{
+		Type:     f.Type,
+		Currency: f.Currency,
+		Balances: make(map[string]float64),
+	}
+	for k, v := range f.Balances {
+		acc.Balances[k] = v
+	}
+
+	switch f.Type {
+	case CashAccount:
+	case FlexAccount:
+		for k, v := range f.Currencies {
+			acc.Balances[k] = v.Quantity
+		}
+		acc.Margin = &Margin{Initial: f.InitialMargin, Maintenance: f.MaintenanceMargin}
+		acc.PortfolioValue = f.PortfolioValue
+		acc.AvailableFunds = f.AvailableMargin
+		acc.PnL = f.PnL
+		acc.UnrealizedFunding = f.UnrealizedFunding
+	default:
+		if f.Requirements != nil {
+			acc.Margin = &Margin{Initial: f.Requirements.Im, Maintenance: f.Requirements.Mm,
+				Liquidation: f.Requirements.Lt, Termination: f.Requirements.Tt}
+		}
+		acc.PortfolioValue = f.Aux.PV
+		acc.AvailableFunds = f.Aux.Af
+		acc.PnL = f.Aux.PnL
+		acc.UnrealizedFunding = f.Aux.Funding
+	}
+
+	return acc
 }
 
 type Wallet struct {
-	Result   string  `json:"result"`
-	Accounts Markets `json:"accounts"`
-	Error    string  `json:"error"`
+	Result     string           `json:"result"`
+	ServerTime string           `json:"serverTime"`
+	Accounts   map[string]Funds `json:"accounts"`
+	Error      string           `json:"error"`
+}
+
+// MarketSettings is a snapshot of market configuration which is persisted
+// on every change and restored at startup. Orders are inner orders in
+// the /active form.
+type MarketSettings struct {
+	Market   string  `json:"market"`
+	Strategy string  `json:"strategy"`
+	OCO      bool    `json:"oco"`
+	Paper    *Paper  `json:"paper,omitempty"`
+	Feed     Feed    `json:"feed"`
+	Active   bool    `json:"active"`
+	Seq      int     `json:"seq"`
+	Orders   []Order `json:"orders"`
+}
+
+// Position is a net position of market (positive size is long, negative is
+// short) with PnL marked at the last candle price. PnL of inverse contracts is
+// in their base coin, PnL of linear ones is in USD, see PnLCurrency.
+type Position struct {
+	Market      string  `json:"market"`
+	Size        int     `json:"size"`
+	AvgPrice    float64 `json:"avg_price"`
+	LastPrice   float64 `json:"last_price"`
+	Realized    float64 `json:"realized_pnl"`
+	Unrealized  float64 `json:"unrealized_pnl"`
+	Fees        float64 `json:"fees"`
+	Trades      int     `json:"trades"`
+	PnLCurrency string  `json:"pnl_currency"`
+	Paper       bool    `json:"paper,omitempty"`
 }
 
 type MarketsResp struct {
 	Market string `json:"market"`
 	Status string `json:"status"`
+	Paper  bool   `json:"paper,omitempty"`
 }
 
 type TgSend struct {
@@ -107,10 +698,78 @@ type API struct {
 	Private string
 }
 
+// Instrument is a contract traded on Kraken. Prices of its orders are
+// multiples of TickSize, sizes are multiples of the contract step up to
+// MaxPositionSize (Kraken doesn't list the maximal order size).
+type Instrument struct {
+	Symbol          string  `json:"symbol"`
+	Type            string  `json:"type"`
+	Tradeable       bool    `json:"tradeable"`
+	TickSize        float64 `json:"tickSize"`
+	ContractSize    float64 `json:"contractSize"`
+	Precision       float64 `json:"contractValueTradePrecision"`
+	MaxPositionSize float64 `json:"maxPositionSize"`
+}
+
+// InverseFutures is the type of inverse contracts: they are quoted in USD,
+// but margined and settled in the base coin (e.g. pi_xbtusd in XBT).
+const InverseFutures = "futures_inverse"
+
+// Inverse reports whether the contract is inverse.
+func (i Instrument) Inverse() bool {
+	return i.Type == InverseFutures
+}
+
+// Step is the minimal order size in contracts, every size is its multiple.
+func (i Instrument) Step() float64 {
+	return math.Pow(10, -i.Precision)
+}
+
+// InvalidPrice reports whether price isn't a multiple of the tick size.
+func (i Instrument) InvalidPrice(p Price) bool {
+	return i.TickSize > 0 && !multiple(float64(p), i.TickSize)
+}
+
+// InvalidSize reports whether size isn't a multiple of the contract step.
+func (i Instrument) InvalidSize(s Size) bool {
+	return !multiple(float64(s), i.Step())
+}
+
+// RoundPrice rounds price to the nearest multiple of the tick size.
+func (i Instrument) RoundPrice(p float64) float64 {
+	if i.TickSize <= 0 {
+		return p
+	}
+
+	// decimals of the tick size cut the float error of the multiplication
+	scale := math.Pow(10, math.Max(0, math.Ceil(-math.Log10(i.TickSize))))
+	return math.Round(math.Round(p/i.TickSize)*i.TickSize*scale) / scale
+}
+
+// PositionLimit reports whether size is less than the contract step or more
+// than the maximal position size.
+func (i Instrument) PositionLimit(s Size) bool {
+	return float64(s) < i.Step() || i.MaxPositionSize > 0 && float64(s) > i.MaxPositionSize
+}
+
+// multiple reports whether v is a whole multiple of step up to float error.
+func multiple(v float64, step float64) bool {
+	n := v / step
+	return math.Abs(n-math.Round(n)) < 1e-6
+}
+
 type Urls struct {
-	Ws        string
-	SendOrder string
-	Accounts  string
+	Ws              string
+	SendOrder       string
+	EditOrder       string
+	CancelOrder     string
+	CancelAllOrders string
+	OpenOrders      string
+	OpenPositions   string
+	Fills           string
+	Accounts        string
+	Instruments     string
+	Charts          string
 }
 
 func NewAPI(APIPublic string, APIPrivate string) *API {
@@ -122,9 +781,17 @@ func NewAPI(APIPublic string, APIPrivate string) *API {
 
 func NewUrls() *Urls {
 	return &Urls{
-		Ws:        "wss://demo-futures.kraken.com/ws/v1?chart",
-		SendOrder: "https://demo-futures.kraken.com/derivatives/api/v3/sendorder",
-		Accounts:  "https://demo-futures.kraken.com/derivatives/api/v3/accounts",
+		Ws:              "wss://demo-futures.kraken.com/ws/v1?chart",
+		SendOrder:       "https://demo-futures.kraken.com/derivatives/api/v3/sendorder",
+		EditOrder:       "https://demo-futures.kraken.com/derivatives/api/v3/editorder",
+		CancelOrder:     "https://demo-futures.kraken.com/derivatives/api/v3/cancelorder",
+		CancelAllOrders: "https://demo-futures.kraken.com/derivatives/api/v3/cancelallorders",
+		OpenOrders:      "https://demo-futures.kraken.com/derivatives/api/v3/openorders",
+		OpenPositions:   "https://demo-futures.kraken.com/derivatives/api/v3/openpositions",
+		Fills:           "https://demo-futures.kraken.com/derivatives/api/v3/fills",
+		Accounts:        "https://demo-futures.kraken.com/derivatives/api/v3/accounts",
+		Instruments:     "https://demo-futures.kraken.com/derivatives/api/v3/instruments",
+		Charts:          "https://demo-futures.kraken.com/api/charts/v1/trade",
 	}
 }
 
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/cgriceld/crypto-trade-bot/internal/domain"
+)
+
+// flushEvery is the number of records after which export is flushed to client.
+const flushEvery = 100
+
+// exporter writes trade history records to response.
+type exporter interface {
+	write(v domain.TradeRecord) error
+	flush() error
+}
+
+func flushResponse(w http.ResponseWriter) {
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+type csvExporter struct {
+	w     http.ResponseWriter
+	csv   *csv.Writer
+	count int
+}
+
+// newCSVExporter buffers the header, nothing is sent until the first flush.
+func newCSVExporter(w http.ResponseWriter) *csvExporter {
+	e := &csvExporter{w: w, csv: csv.NewWriter(w)}
+	_ = e.csv.Write([]string{"time", "order_id", "market", "side", "price", "size", "fee", "realized_pnl", "pnl_currency", "paper"})
+
+	return e
+}
+
+func (e *csvExporter) write(v domain.TradeRecord) error {
+	var ts string
+	if v.Time != nil {
+		ts = v.Time.Format(time.RFC3339Nano)
+	}
+
+	err := e.csv.Write([]string{
+		ts,
+		v.OrderID,
+		v.Market,
+		v.Side,
+		strconv.FormatFloat(v.Price, 'f', -1, 64),
+		strconv.Itoa(v.Size),
+		strconv.FormatFloat(v.Fee, 'f', -1, 64),
+		strconv.FormatFloat(v.Realized, 'f', -1, 64),
+		v.PnLCurrency,
+		strconv.FormatBool(v.Paper),
+	})
+	if err != nil {
+		return err
+	}
+
+	e.count++
+	if e.count%flushEvery == 0 {
+		return e.flush()
+	}
+
+	return nil
+}
+
+func (e *csvExporter) flush() error {
+	e.csv.Flush()
+	flushResponse(e.w)
+
+	return e.csv.Error()
+}
+
+type jsonlExporter struct {
+	w     http.ResponseWriter
+	enc   *json.Encoder
+	count int
+}
+
+func newJSONLExporter(w http.ResponseWriter) *jsonlExporter {
+	return &jsonlExporter{w: w, enc: json.NewEncoder(w)}
+}
+
+func (e *jsonlExporter) write(v domain.TradeRecord) error {
+	if err := e.enc.Encode(v); err != nil {
+		return err
+	}
+
+	e.count++
+	if e.count%flushEvery == 0 {
+		return e.flush()
+	}
+
+	return nil
+}
+
+func (e *jsonlExporter) flush() error {
+	flushResponse(e.w)
+	return nil
+}
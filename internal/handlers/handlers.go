@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"github.com/cgriceld/crypto-trade-bot/internal/domain"
 	"github.com/cgriceld/crypto-trade-bot/pkg/log"
@@ -14,20 +15,38 @@ import (
 
 type Robot interface {
 	Accounts(ctx context.Context) (*domain.AccountsResp, error)
+	OpenOrders(ctx context.Context) ([]domain.OpenOrder, error)
+	OpenPositions(ctx context.Context) ([]domain.OpenPosition, error)
+	Fills(ctx context.Context, before *time.Time) ([]domain.Fill, error)
+	CancelOrder(ctx context.Context, orderID string) (*domain.CancelStatus, error)
+	CancelAllOrders(ctx context.Context, m domain.Market) (*domain.CancelAllStatus, error)
 	GetActive(ctx context.Context, m domain.Market) ([]domain.Order, error)
 	GetActiveAll(ctx context.Context) []domain.Order
+	CheckMarket(m domain.Market) error
 	SetMarket(ctx context.Context, m domain.Market)
 	SetSell(ctx context.Context, m domain.Market, p domain.Price, s domain.Size) error
+	SetExchange(ctx context.Context, m domain.Market, typ string, p domain.Price, s domain.Size, exec domain.Execution) (domain.Order, error)
 	UnsetSell(ctx context.Context, m domain.Market) error
 	SetBuy(ctx context.Context, m domain.Market, p domain.Price, s domain.Size) error
 	UnsetBuy(ctx context.Context, m domain.Market) error
+	SetTrailing(ctx context.Context, m domain.Market, typ string, t domain.Trailing, s domain.Size) error
+	SetOCO(ctx context.Context, m domain.Market, oco bool) error
+	AddTrigger(ctx context.Context, m domain.Market, order domain.Order) (domain.Order, error)
+	CancelTrigger(ctx context.Context, m domain.Market, id string) error
+	SetStrategy(ctx context.Context, m domain.Market, name string) error
+	Strategies(ctx context.Context) []string
+	SetPaper(ctx context.Context, m domain.Market, p domain.Paper) error
+	SetFeed(ctx context.Context, m domain.Market, feed domain.Feed) error
 	UnsetAll(ctx context.Context) []domain.MarketsResp
 	StartMarket(ctx context.Context, m domain.Market) (int, error)
 	StopMarket(ctx context.Context, m domain.Market) error
 	StartAll(ctx context.Context) []domain.MarketsResp
 	StopAll(ctx context.Context) []domain.MarketsResp
-	GetOrders(ctx context.Context) ([]domain.Order, error)
+	GetOrders(ctx context.Context, filter domain.OrderFilter) (*domain.OrdersResp, error)
+	ExportOrders(ctx context.Context, filter domain.OrderFilter, fn func(domain.TradeRecord) error) error
+	GetCandles(ctx context.Context, filter domain.CandleFilter) ([]domain.CandleRecord, error)
 	Running(ctx context.Context) []domain.MarketsResp
+	Positions(ctx context.Context) []domain.Position
 	Close()
 }
 
@@ -55,10 +74,21 @@ func (h *Handler) Routes() chi.Router {
 
 	r.Group(func(r chi.Router) {
 		r.Get("/accounts", h.accounts)
-		r.Get("/orders", h.getOrders)
+		r.With(getOrderFilter).Get("/orders", h.getOrders)
+		r.With(getOrderFilter, getFormat).Get("/orders/export", h.exportOrders)
+		r.With(getCandleFilter).Get("/candles", h.getCandles)
 		r.With(getMarket).Get("/active", h.active)
 		r.Get("/activeall", h.activeAll)
 		r.Get("/running", h.running)
+		r.Get("/positions", h.positions)
+		r.Get("/strategies", h.strategies)
+	})
+
+	r.Group(func(r chi.Router) {
+		r.Get("/exchange/openorders", h.openOrders)
+		r.Get("/exchange/positions", h.openPositions)
+		r.With(getFills).Get("/exchange/fills", h.fills)
+		r.With(getCancel).Post("/exchange/cancel", h.cancelOrders)
 	})
 
 	r.Group(func(r chi.Router) {
@@ -66,14 +96,27 @@ func (h *Handler) Routes() chi.Router {
 		r.With(getMarket).Post("/unsetsell", h.unsetSell)
 		r.With(getMarket).Post("/unsetbuy", h.unsetBuy)
 		r.Post("/unsetall", h.unsetAll)
+		r.With(getMarket, getStrategy).Post("/setstrategy", h.setStrategy)
+		r.With(getMarket, getPaper).Post("/setpaper", h.setPaper)
+		r.With(getMarket, getFeed).Post("/setfeed", h.setFeed)
 	})
 
 	r.Group(func(r chi.Router) {
-		r.Use(getMarket, getPrice, getSize)
+		r.Use(getMarket, getPrice, getSize, getOCO, getExchange)
 		r.Post("/setsell", h.setSell)
 		r.Post("/setbuy", h.setBuy)
 	})
 
+	r.Group(func(r chi.Router) {
+		r.Use(getMarket, getSide, getTrailing, getSize)
+		r.Post("/settrailing", h.setTrailing)
+	})
+
+	r.Group(func(r chi.Router) {
+		r.With(getMarket, getSide, getPrice, getSize, getTrailing, getID, getConditions, getExecution).Post("/addtrigger", h.addTrigger)
+		r.With(getMarket, getID).Post("/canceltrigger", h.cancelTrigger)
+	})
+
 	r.Group(func(r chi.Router) {
 		r.With(getMarket).Post("/start", h.startMarket)
 		r.With(getMarket).Post("/stop", h.stopMarket)
@@ -90,11 +133,20 @@ func (h *Handler) setMarket(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	h.robot.SetMarket(r.Context(), m)
 	res := &domain.MarketsResp{
 		Market: string(m),
 		Status: "ok",
 	}
+	if err := h.robot.CheckMarket(m); err != nil {
+		res.Status = err.Error()
+
+		h.logger.Errorf("%v: %v", r.URL, err)
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, res)
+		return
+	}
+
+	h.robot.SetMarket(r.Context(), m)
 
 	h.logger.Infof("Request to %v succeeded", r.URL)
 	render.Status(r, http.StatusCreated)
@@ -109,8 +161,21 @@ func (h *Handler) running(w http.ResponseWriter, r *http.Request) {
 	render.JSON(w, r, res)
 }
 
+func (h *Handler) positions(w http.ResponseWriter, r *http.Request) {
+	res := h.robot.Positions(r.Context())
+
+	h.logger.Infof("Request to %v succeeded", r.URL)
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, res)
+}
+
 func (h *Handler) getOrders(w http.ResponseWriter, r *http.Request) {
-	res, err := h.robot.GetOrders(r.Context())
+	filter := h.checkOrderFilter(w, r)
+	if filter == nil {
+		return
+	}
+
+	res, err := h.robot.GetOrders(r.Context(), *filter)
 	if err != nil {
 		renderPlain(w, r, http.StatusInternalServerError, domain.InternalServerError)
 		return
@@ -121,11 +186,159 @@ func (h *Handler) getOrders(w http.ResponseWriter, r *http.Request) {
 	render.JSON(w, r, res)
 }
 
+func (h *Handler) getCandles(w http.ResponseWriter, r *http.Request) {
+	filter := h.checkCandleFilter(w, r)
+	if filter == nil {
+		return
+	}
+
+	res, err := h.robot.GetCandles(r.Context(), *filter)
+	if err != nil {
+		h.logger.Errorf("%v: %v", r.URL, err)
+		renderPlain(w, r, http.StatusInternalServerError, domain.InternalServerError)
+		return
+	}
+
+	h.logger.Infof("Request to %v succeeded", r.URL)
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, res)
+}
+
+// exportOrders streams trade history as it is read from the database, so errors
+// after the first record can only be logged.
+func (h *Handler) exportOrders(w http.ResponseWriter, r *http.Request) {
+	filter := h.checkOrderFilter(w, r)
+	if filter == nil {
+		return
+	}
+	if param := notExported(filter); param != "" {
+		h.logger.Errorf("%v: %v: %v isn't supported", r.URL, WrongQuery, param)
+		renderPlain(w, r, http.StatusBadRequest, fmt.Sprintf("%v: %v isn't supported", WrongQuery, param))
+		return
+	}
+	format := h.checkFormat(w, r)
+	if format == "" {
+		return
+	}
+
+	var exp exporter
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		exp = newCSVExporter(w)
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		exp = newJSONLExporter(w)
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=orders.%v", format))
+
+	var count int
+	err := h.robot.ExportOrders(r.Context(), *filter, func(v domain.TradeRecord) error {
+		count++
+		return exp.write(v)
+	})
+	if err == nil {
+		err = exp.flush()
+	}
+	if err != nil {
+		h.logger.Errorf("%v: %v, %v orders exported", r.URL, err, count)
+		if count == 0 {
+			w.Header().Del("Content-Disposition")
+			renderPlain(w, r, http.StatusInternalServerError, domain.InternalServerError)
+			return
+		}
+		// records written so far are sent, then the response is aborted, so
+		// that the client doesn't take the export for the complete one
+		_ = exp.flush()
+		panic(http.ErrAbortHandler)
+	}
+
+	h.logger.Infof("Request to %v succeeded, %v orders exported", r.URL, count)
+}
+
 func (h *Handler) accounts(w http.ResponseWriter, r *http.Request) {
 	res, err := h.robot.Accounts(r.Context())
 	if err != nil {
 		h.logger.Errorf("%v: %v", r.URL, err)
-		renderPlain(w, r, http.StatusInternalServerError, domain.InternalServerError)
+		renderExchange(w, r, err)
+		return
+	}
+
+	h.logger.Infof("Request to %v succeeded", r.URL)
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, res)
+}
+
+func (h *Handler) openOrders(w http.ResponseWriter, r *http.Request) {
+	res, err := h.robot.OpenOrders(r.Context())
+	if err != nil {
+		h.logger.Errorf("%v: %v", r.URL, err)
+		renderExchange(w, r, err)
+		return
+	}
+	if res == nil {
+		res = []domain.OpenOrder{}
+	}
+
+	h.logger.Infof("Request to %v succeeded", r.URL)
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, res)
+}
+
+func (h *Handler) openPositions(w http.ResponseWriter, r *http.Request) {
+	res, err := h.robot.OpenPositions(r.Context())
+	if err != nil {
+		h.logger.Errorf("%v: %v", r.URL, err)
+		renderExchange(w, r, err)
+		return
+	}
+	if res == nil {
+		res = []domain.OpenPosition{}
+	}
+
+	h.logger.Infof("Request to %v succeeded", r.URL)
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, res)
+}
+
+func (h *Handler) fills(w http.ResponseWriter, r *http.Request) {
+	before, ok := h.checkBefore(w, r)
+	if !ok {
+		return
+	}
+
+	res, err := h.robot.Fills(r.Context(), before)
+	if err != nil {
+		h.logger.Errorf("%v: %v", r.URL, err)
+		renderExchange(w, r, err)
+		return
+	}
+	if res == nil {
+		res = []domain.Fill{}
+	}
+
+	h.logger.Infof("Request to %v succeeded", r.URL)
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, res)
+}
+
+// cancelOrders cancels orders on Kraken, the response is the status of
+// cancelorder or cancelallorders.
+func (h *Handler) cancelOrders(w http.ResponseWriter, r *http.Request) {
+	req := h.checkCancel(w, r)
+	if req == nil {
+		return
+	}
+
+	var res interface{}
+	var err error
+	if req.orderID != "" {
+		res, err = h.robot.CancelOrder(r.Context(), req.orderID)
+	} else {
+		res, err = h.robot.CancelAllOrders(r.Context(), req.market)
+	}
+	if err != nil {
+		h.logger.Errorf("%v: %v", r.URL, err)
+		renderExchange(w, r, err)
 		return
 	}
 
@@ -139,12 +352,36 @@ func (h *Handler) setSell(w http.ResponseWriter, r *http.Request) {
 	if p == 0 {
 		return
 	}
+	oco, ok := h.checkOCO(w, r)
+	if !ok {
+		return
+	}
+	exec, ok := h.checkExchange(w, r, p)
+	if !ok {
+		return
+	}
 	m := h.checkMarket(w, r)
 	if m == "" {
 		return
 	}
 
-	err := h.robot.SetSell(r.Context(), m, p, s)
+	res := &domain.Order{
+		ID:     "sell",
+		Market: string(m),
+		Typ:    "sell",
+		Price:  float64(p),
+		Size:   int(s),
+	}
+
+	var err error
+	if exec != nil {
+		*res, err = h.robot.SetExchange(r.Context(), m, "sell", p, s, *exec)
+	} else {
+		err = h.robot.SetSell(r.Context(), m, p, s)
+	}
+	if err == nil && oco != nil {
+		err = h.robot.SetOCO(r.Context(), m, *oco)
+	}
 	if err != nil {
 		res := &domain.MarketsResp{
 			Market: string(m),
@@ -156,22 +393,77 @@ func (h *Handler) setSell(w http.ResponseWriter, r *http.Request) {
 		render.JSON(w, r, res)
 		return
 	}
+	res.OCO = h.linked(r.Context(), m, res.ID)
+
+	h.logger.Infof("Request to %v succeeded", r.URL)
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, res)
+}
+
+func (h *Handler) setBuy(w http.ResponseWriter, r *http.Request) {
+	p, s := h.checkPriceSize(w, r)
+	if p == 0 {
+		return
+	}
+	oco, ok := h.checkOCO(w, r)
+	if !ok {
+		return
+	}
+	exec, ok := h.checkExchange(w, r, p)
+	if !ok {
+		return
+	}
+	m := h.checkMarket(w, r)
+	if m == "" {
+		return
+	}
 
 	res := &domain.Order{
+		ID:     "buy",
 		Market: string(m),
-		Typ:    "sell",
+		Typ:    "buy",
 		Price:  float64(p),
 		Size:   int(s),
 	}
 
+	var err error
+	if exec != nil {
+		*res, err = h.robot.SetExchange(r.Context(), m, "buy", p, s, *exec)
+	} else {
+		err = h.robot.SetBuy(r.Context(), m, p, s)
+	}
+	if err == nil && oco != nil {
+		err = h.robot.SetOCO(r.Context(), m, *oco)
+	}
+	if err != nil {
+		res := &domain.MarketsResp{
+			Market: string(m),
+			Status: err.Error(),
+		}
+
+		h.logger.Errorf("%v: %v", r.URL, err)
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, res)
+		return
+	}
+	res.OCO = h.linked(r.Context(), m, res.ID)
+
 	h.logger.Infof("Request to %v succeeded", r.URL)
 	render.Status(r, http.StatusCreated)
 	render.JSON(w, r, res)
 }
 
-func (h *Handler) setBuy(w http.ResponseWriter, r *http.Request) {
-	p, s := h.checkPriceSize(w, r)
-	if p == 0 {
+func (h *Handler) setTrailing(w http.ResponseWriter, r *http.Request) {
+	t := h.checkTrailing(w, r)
+	if t == nil {
+		return
+	}
+	s := h.checkSize(w, r)
+	if s == 0 {
+		return
+	}
+	typ := h.checkSide(w, r)
+	if typ == "" {
 		return
 	}
 	m := h.checkMarket(w, r)
@@ -179,7 +471,7 @@ func (h *Handler) setBuy(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := h.robot.SetBuy(r.Context(), m, p, s)
+	err := h.robot.SetTrailing(r.Context(), m, typ, *t, s)
 	if err != nil {
 		res := &domain.MarketsResp{
 			Market: string(m),
@@ -193,10 +485,78 @@ func (h *Handler) setBuy(w http.ResponseWriter, r *http.Request) {
 	}
 
 	res := &domain.Order{
-		Market: string(m),
-		Typ:    "buy",
-		Price:  float64(p),
-		Size:   int(s),
+		ID:       typ,
+		Market:   string(m),
+		Typ:      typ,
+		Size:     int(s),
+		Trailing: t,
+	}
+
+	h.logger.Infof("Request to %v succeeded", r.URL)
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, res)
+}
+
+func (h *Handler) addTrigger(w http.ResponseWriter, r *http.Request) {
+	var order domain.Order
+	order.Conditions, _ = r.Context().Value(domain.Conditions).([]string)
+	p, _ := r.Context().Value(domain.TriggerPrice).(domain.Price)
+
+	if t, ok := r.Context().Value(domain.TrailDistance).(domain.Trailing); ok && t.Distance != 0 {
+		trail := h.checkTrailing(w, r)
+		if trail == nil {
+			return
+		}
+		s := h.checkSize(w, r)
+		if s == 0 {
+			return
+		}
+		order.Trailing = trail
+		order.Size = int(s)
+	} else if len(order.Conditions) > 0 && p == 0 {
+		// triggered by conditions only
+		s := h.checkSize(w, r)
+		if s == 0 {
+			return
+		}
+		order.Size = int(s)
+	} else {
+		p, s := h.checkPriceSize(w, r)
+		if p == 0 {
+			return
+		}
+		order.Price = float64(p)
+		order.Size = int(s)
+	}
+
+	exec := h.checkExecution(w, r)
+	if exec == nil {
+		return
+	}
+	typ := h.checkSide(w, r)
+	if typ == "" {
+		return
+	}
+	m := h.checkMarket(w, r)
+	if m == "" {
+		return
+	}
+
+	order.Typ = typ
+	order.ID, _ = r.Context().Value(domain.TriggerID).(string)
+	order.Execution = *exec
+
+	res, err := h.robot.AddTrigger(r.Context(), m, order)
+	if err != nil {
+		res := &domain.MarketsResp{
+			Market: string(m),
+			Status: err.Error(),
+		}
+
+		h.logger.Errorf("%v: %v", r.URL, err)
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, res)
+		return
 	}
 
 	h.logger.Infof("Request to %v succeeded", r.URL)
@@ -204,6 +564,136 @@ func (h *Handler) setBuy(w http.ResponseWriter, r *http.Request) {
 	render.JSON(w, r, res)
 }
 
+func (h *Handler) cancelTrigger(w http.ResponseWriter, r *http.Request) {
+	id := h.checkID(w, r)
+	if id == "" {
+		return
+	}
+	m := h.checkMarket(w, r)
+	if m == "" {
+		return
+	}
+
+	err := h.robot.CancelTrigger(r.Context(), m, id)
+	res := &domain.MarketsResp{
+		Market: string(m),
+		Status: "ok",
+	}
+
+	if err != nil {
+		res.Status = err.Error()
+
+		h.logger.Errorf("%v: %v", r.URL, err)
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, res)
+		return
+	}
+
+	h.logger.Infof("Request to %v succeeded", r.URL)
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, res)
+}
+
+func (h *Handler) setStrategy(w http.ResponseWriter, r *http.Request) {
+	name := h.checkStrategy(w, r)
+	if name == "" {
+		return
+	}
+	m := h.checkMarket(w, r)
+	if m == "" {
+		return
+	}
+
+	err := h.robot.SetStrategy(r.Context(), m, name)
+	res := &domain.MarketsResp{
+		Market: string(m),
+		Status: "ok",
+	}
+
+	if err != nil {
+		res.Status = err.Error()
+
+		h.logger.Errorf("%v: %v", r.URL, err)
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, res)
+		return
+	}
+
+	h.logger.Infof("Request to %v succeeded", r.URL)
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, res)
+}
+
+func (h *Handler) setPaper(w http.ResponseWriter, r *http.Request) {
+	p := h.checkPaper(w, r)
+	if p == nil {
+		return
+	}
+	m := h.checkMarket(w, r)
+	if m == "" {
+		return
+	}
+
+	err := h.robot.SetPaper(r.Context(), m, *p)
+	res := &domain.MarketsResp{
+		Market: string(m),
+		Status: "ok",
+		Paper:  p.Enabled,
+	}
+
+	if err != nil {
+		res.Status = err.Error()
+		res.Paper = false
+
+		h.logger.Errorf("%v: %v", r.URL, err)
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, res)
+		return
+	}
+
+	h.logger.Infof("Request to %v succeeded", r.URL)
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, res)
+}
+
+func (h *Handler) setFeed(w http.ResponseWriter, r *http.Request) {
+	feed := h.checkFeed(w, r)
+	if feed == nil {
+		return
+	}
+	m := h.checkMarket(w, r)
+	if m == "" {
+		return
+	}
+
+	err := h.robot.SetFeed(r.Context(), m, *feed)
+	res := &domain.MarketsResp{
+		Market: string(m),
+		Status: "ok",
+	}
+
+	if err != nil {
+		res.Status = err.Error()
+
+		h.logger.Errorf("%v: %v", r.URL, err)
+		render.Status(r, http.StatusBadRequest)
+		render.JSON(w, r, res)
+		return
+	}
+
+	h.logger.Infof("Request to %v succeeded", r.URL)
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, res)
+}
+
+func (h *Handler) strategies(w http.ResponseWriter, r *http.Request) {
+	res := h.robot.Strategies(r.Context())
+
+	h.logger.Infof("Request to %v succeeded", r.URL)
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, res)
+}
+
 func (h *Handler) startMarket(w http.ResponseWriter, r *http.Request) {
 	m := h.checkMarket(w, r)
 	if m == "" {
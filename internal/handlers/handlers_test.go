@@ -2,17 +2,23 @@ package handlers
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/cgriceld/crypto-trade-bot/internal/domain"
 	"github.com/cgriceld/crypto-trade-bot/internal/services/robot"
 	"github.com/cgriceld/crypto-trade-bot/pkg/kraken"
 	"github.com/cgriceld/crypto-trade-bot/pkg/log"
 
+	"github.com/go-chi/chi/v5"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 )
@@ -22,6 +28,12 @@ const (
 	setSell    = "/setsell"
 	unsetSell  = "/unsetsell"
 	setBuy     = "/setbuy"
+	setTrail   = "/settrailing"
+	addTrig    = "/addtrigger"
+	cancelTrig = "/canceltrigger"
+	setStrat   = "/setstrategy"
+	setPaper   = "/setpaper"
+	setFeed    = "/setfeed"
 	unsetBuy   = "/unsetbuy"
 	unsetAll   = "/unsetall"
 	active     = "/active"
@@ -29,6 +41,8 @@ const (
 	stopMarket = "/stop"
 	stopAll    = "/stopall"
 	running    = "/running"
+	positions  = "/positions"
+	orders     = "/orders"
 )
 
 var (
@@ -207,7 +221,27 @@ func TestSetSell(t *testing.T) {
 				domain.MarketName:   domain.Market("pi_ethusd"),
 				domain.TriggerPrice: domain.Price(4000),
 				domain.OrderSize:    domain.Size(5)},
-			"{\"market\":\"pi_ethusd\",\"type\":\"sell\",\"price\":4000,\"size\":5}\n"},
+			"{\"id\":\"sell\",\"market\":\"pi_ethusd\",\"type\":\"sell\",\"price\":4000,\"size\":5}\n"},
+		{"Linked", http.MethodPost, setSell, http.StatusCreated,
+			map[domain.Market]interface{}{
+				domain.MarketName:   domain.Market("pi_ethusd"),
+				domain.TriggerPrice: domain.Price(4000),
+				domain.OrderSize:    domain.Size(5),
+				domain.OCOLink:      "true"},
+			"{\"id\":\"sell\",\"market\":\"pi_ethusd\",\"type\":\"sell\",\"price\":4000,\"size\":5,\"oco\":true}\n"},
+		{"Linkage kept", http.MethodPost, setSell, http.StatusCreated,
+			map[domain.Market]interface{}{
+				domain.MarketName:   domain.Market("pi_ethusd"),
+				domain.TriggerPrice: domain.Price(4100),
+				domain.OrderSize:    domain.Size(5)},
+			"{\"id\":\"sell\",\"market\":\"pi_ethusd\",\"type\":\"sell\",\"price\":4100,\"size\":5,\"oco\":true}\n"},
+		{"Unlinked", http.MethodPost, setSell, http.StatusCreated,
+			map[domain.Market]interface{}{
+				domain.MarketName:   domain.Market("pi_ethusd"),
+				domain.TriggerPrice: domain.Price(4000),
+				domain.OrderSize:    domain.Size(5),
+				domain.OCOLink:      "false"},
+			"{\"id\":\"sell\",\"market\":\"pi_ethusd\",\"type\":\"sell\",\"price\":4000,\"size\":5}\n"},
 		{"No market query", http.MethodPost, setSell, http.StatusBadRequest,
 			map[domain.Market]interface{}{
 				domain.MarketName:   domain.Market(""),
@@ -256,6 +290,27 @@ func TestSetSell(t *testing.T) {
 				domain.TriggerPrice: domain.Price(4000),
 				domain.OrderSize:    domain.Size(5)},
 			"{\"market\":\"not_set\",\"status\":\"No market was set: not_set\"}\n"},
+		{"Wrong exchange query", http.MethodPost, setSell, http.StatusBadRequest,
+			map[domain.Market]interface{}{
+				domain.MarketName:    domain.Market("pi_ethusd"),
+				domain.TriggerPrice:  domain.Price(4000),
+				domain.OrderSize:     domain.Size(5),
+				domain.ExchangeOrder: map[string]string{"exchange": "lmt"}},
+			"Wrong query parameter: exchange: lmt"},
+		{"Wrong reduce only query", http.MethodPost, setSell, http.StatusBadRequest,
+			map[domain.Market]interface{}{
+				domain.MarketName:    domain.Market("pi_ethusd"),
+				domain.TriggerPrice:  domain.Price(4000),
+				domain.OrderSize:     domain.Size(5),
+				domain.ExchangeOrder: map[string]string{"exchange": "stp", "reduce_only": "yes"}},
+			"Wrong query parameter: reduce_only: yes"},
+		{"Wrong trigger signal query", http.MethodPost, setSell, http.StatusBadRequest,
+			map[domain.Market]interface{}{
+				domain.MarketName:    domain.Market("pi_ethusd"),
+				domain.TriggerPrice:  domain.Price(4000),
+				domain.OrderSize:     domain.Size(5),
+				domain.ExchangeOrder: map[string]string{"exchange": "take_profit", "trigger_signal": "spot"}},
+			"Wrong query parameter: trigger_signal: spot"},
 	}
 
 	for _, test := range tests {
@@ -287,7 +342,7 @@ func TestSetBuy(t *testing.T) {
 				domain.MarketName:   domain.Market("pi_ethusd"),
 				domain.TriggerPrice: domain.Price(4000),
 				domain.OrderSize:    domain.Size(5)},
-			"{\"market\":\"pi_ethusd\",\"type\":\"buy\",\"price\":4000,\"size\":5}\n"},
+			"{\"id\":\"buy\",\"market\":\"pi_ethusd\",\"type\":\"buy\",\"price\":4000,\"size\":5}\n"},
 		{"No market query", http.MethodPost, setBuy, http.StatusBadRequest,
 			map[domain.Market]interface{}{
 				domain.MarketName:   domain.Market(""),
@@ -365,7 +420,7 @@ func TestActive(t *testing.T) {
 		{"Right query", http.MethodGet, active, http.StatusOK,
 			map[domain.Market]interface{}{
 				domain.MarketName: domain.Market("pi_ethusd")},
-			"[{\"market\":\"pi_ethusd\",\"type\":\"sell\",\"price\":4000,\"size\":5},{\"market\":\"pi_ethusd\",\"type\":\"buy\",\"price\":4000,\"size\":5}]\n"},
+			"[{\"id\":\"sell\",\"market\":\"pi_ethusd\",\"type\":\"sell\",\"price\":4000,\"size\":5,\"interval\":\"1m\",\"source\":\"ohlc4\"},{\"id\":\"buy\",\"market\":\"pi_ethusd\",\"type\":\"buy\",\"price\":4000,\"size\":5,\"interval\":\"1m\",\"source\":\"ohlc4\"}]\n"},
 		{"No query", http.MethodGet, active, http.StatusBadRequest,
 			map[domain.Market]interface{}{
 				domain.MarketName: domain.Market("")},
@@ -403,7 +458,7 @@ func TestActiveAll(t *testing.T) {
 		{"Right query", http.MethodGet, activeAll, http.StatusOK,
 			map[domain.Market]interface{}{
 				domain.MarketName: domain.Market("pi_ethusd")},
-			"[{\"market\":\"pi_ethusd\",\"type\":\"sell\",\"price\":4000,\"size\":5},{\"market\":\"pi_ethusd\",\"type\":\"buy\",\"price\":4000,\"size\":5}]\n"},
+			"[{\"id\":\"sell\",\"market\":\"pi_ethusd\",\"type\":\"sell\",\"price\":4000,\"size\":5,\"interval\":\"1m\",\"source\":\"ohlc4\"},{\"id\":\"buy\",\"market\":\"pi_ethusd\",\"type\":\"buy\",\"price\":4000,\"size\":5,\"interval\":\"1m\",\"source\":\"ohlc4\"}]\n"},
 	}
 
 	for _, test := range tests {
@@ -503,3 +558,669 @@ func TestRunning(t *testing.T) {
 		}
 	}
 }
+
+func TestSetTrailing(t *testing.T) {
+	tests := []Test{
+		{"Right query", http.MethodPost, setTrail, http.StatusCreated,
+			map[domain.Market]interface{}{
+				domain.MarketName:    domain.Market("pi_ethusd"),
+				domain.OrderSide:     "sell",
+				domain.TrailDistance: domain.Trailing{Distance: 2, Percent: true},
+				domain.OrderSize:     domain.Size(5)},
+			"{\"id\":\"sell\",\"market\":\"pi_ethusd\",\"type\":\"sell\",\"price\":0,\"size\":5,\"trailing\":{\"distance\":2,\"percent\":true,\"best\":0}}\n"},
+		{"Wrong type query", http.MethodPost, setTrail, http.StatusBadRequest,
+			map[domain.Market]interface{}{
+				domain.MarketName:    domain.Market("pi_ethusd"),
+				domain.OrderSide:     "hold",
+				domain.TrailDistance: domain.Trailing{Distance: 2},
+				domain.OrderSize:     domain.Size(5)},
+			"Wrong query parameter: type: hold"},
+		{"No distance query", http.MethodPost, setTrail, http.StatusBadRequest,
+			map[domain.Market]interface{}{
+				domain.MarketName:    domain.Market("pi_ethusd"),
+				domain.OrderSide:     "sell",
+				domain.TrailDistance: domain.Trailing{},
+				domain.OrderSize:     domain.Size(5)},
+			"Wrong query parameter: distance: 0"},
+		{"Wrong percent query", http.MethodPost, setTrail, http.StatusBadRequest,
+			map[domain.Market]interface{}{
+				domain.MarketName:    domain.Market("pi_ethusd"),
+				domain.OrderSide:     "buy",
+				domain.TrailDistance: domain.Trailing{Distance: 100, Percent: true},
+				domain.OrderSize:     domain.Size(5)},
+			"Wrong query parameter: distance: 100"},
+		{"No such market", http.MethodPost, setTrail, http.StatusBadRequest,
+			map[domain.Market]interface{}{
+				domain.MarketName:    domain.Market("not_set"),
+				domain.OrderSide:     "sell",
+				domain.TrailDistance: domain.Trailing{Distance: 2},
+				domain.OrderSize:     domain.Size(5)},
+			"{\"market\":\"not_set\",\"status\":\"No market was set: not_set\"}\n"},
+	}
+
+	for _, test := range tests {
+		request := httptest.NewRequest(test.method, test.url, nil)
+
+		var ctx context.Context
+		for k, v := range test.query {
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			ctx = context.WithValue(ctx, k, v)
+		}
+
+		response := httptest.NewRecorder()
+		handler.setTrailing(response, request.WithContext(ctx))
+		body := response.Body.String()
+
+		if !assert.Equal(t, test.status, response.Code, "%v: Expect: %v, Got: %v", test.name, test.status, response.Code) ||
+			!assert.Equal(t, test.resp, body, "%v: Expect: %v, Got: %v", test.name, test.resp, body) {
+			t.Fatal()
+		}
+	}
+}
+
+func TestAddTrigger(t *testing.T) {
+	tests := []Test{
+		{"Named price query", http.MethodPost, addTrig, http.StatusCreated,
+			map[domain.Market]interface{}{
+				domain.MarketName:    domain.Market("pi_ethusd"),
+				domain.OrderSide:     "sell",
+				domain.TriggerPrice:  domain.Price(4200),
+				domain.OrderSize:     domain.Size(2),
+				domain.TrailDistance: domain.Trailing{},
+				domain.TriggerID:     "tp1"},
+			"{\"id\":\"tp1\",\"market\":\"pi_ethusd\",\"type\":\"sell\",\"price\":4200,\"size\":2}\n"},
+		{"Generated trailing query", http.MethodPost, addTrig, http.StatusCreated,
+			map[domain.Market]interface{}{
+				domain.MarketName:    domain.Market("pi_ethusd"),
+				domain.OrderSide:     "buy",
+				domain.TriggerPrice:  domain.Price(0),
+				domain.OrderSize:     domain.Size(1),
+				domain.TrailDistance: domain.Trailing{Distance: 50},
+				domain.TriggerID:     ""},
+			"{\"id\":\"1\",\"market\":\"pi_ethusd\",\"type\":\"buy\",\"price\":0,\"size\":1,\"trailing\":{\"distance\":50,\"percent\":false,\"best\":0}}\n"},
+		{"Duplicate query", http.MethodPost, addTrig, http.StatusBadRequest,
+			map[domain.Market]interface{}{
+				domain.MarketName:    domain.Market("pi_ethusd"),
+				domain.OrderSide:     "sell",
+				domain.TriggerPrice:  domain.Price(4500),
+				domain.OrderSize:     domain.Size(2),
+				domain.TrailDistance: domain.Trailing{},
+				domain.TriggerID:     "tp1"},
+			"{\"market\":\"pi_ethusd\",\"status\":\"Order already exists: pi_ethusd: tp1\"}\n"},
+		{"No price query", http.MethodPost, addTrig, http.StatusBadRequest,
+			map[domain.Market]interface{}{
+				domain.MarketName:    domain.Market("pi_ethusd"),
+				domain.OrderSide:     "sell",
+				domain.TriggerPrice:  domain.Price(0),
+				domain.OrderSize:     domain.Size(2),
+				domain.TrailDistance: domain.Trailing{}},
+			"Wrong query parameter: price: 0"},
+		{"Conditions query", http.MethodPost, addTrig, http.StatusCreated,
+			map[domain.Market]interface{}{
+				domain.MarketName:    domain.Market("pi_ethusd"),
+				domain.OrderSide:     "buy",
+				domain.TriggerPrice:  domain.Price(0),
+				domain.OrderSize:     domain.Size(1),
+				domain.TrailDistance: domain.Trailing{},
+				domain.TriggerID:     "rsi",
+				domain.Conditions:    []string{"rsi(14) < 30", "price  crosses_above ema(20)"}},
+			"{\"id\":\"rsi\",\"market\":\"pi_ethusd\",\"type\":\"buy\",\"price\":0,\"size\":1,\"conditions\":[\"rsi(14) \\u003c 30\",\"price crosses_above ema(20)\"]}\n"},
+		{"Wrong condition query", http.MethodPost, addTrig, http.StatusBadRequest,
+			map[domain.Market]interface{}{
+				domain.MarketName:    domain.Market("pi_ethusd"),
+				domain.OrderSide:     "sell",
+				domain.TriggerPrice:  domain.Price(0),
+				domain.OrderSize:     domain.Size(1),
+				domain.TrailDistance: domain.Trailing{},
+				domain.Conditions:    []string{"rsi(14) above 70"}},
+			"{\"market\":\"pi_ethusd\",\"status\":\"Wrong condition: rsi(14) above 70: no operator\"}\n"},
+		{"Stop order query", http.MethodPost, addTrig, http.StatusCreated,
+			map[domain.Market]interface{}{
+				domain.MarketName:    domain.Market("pi_ethusd"),
+				domain.OrderSide:     "sell",
+				domain.TriggerPrice:  domain.Price(4300),
+				domain.OrderSize:     domain.Size(1),
+				domain.TrailDistance: domain.Trailing{},
+				domain.TriggerID:     "sl",
+				domain.ExecQuery:     map[string]string{"order_type": "stp", "stop_price": "4250", "reduce_only": "true"}},
+			"{\"id\":\"sl\",\"market\":\"pi_ethusd\",\"type\":\"sell\",\"price\":4300,\"size\":1,\"order_type\":\"stp\",\"stop_price\":4250,\"reduce_only\":true}\n"},
+		{"No stop price query", http.MethodPost, addTrig, http.StatusBadRequest,
+			map[domain.Market]interface{}{
+				domain.MarketName:    domain.Market("pi_ethusd"),
+				domain.OrderSide:     "sell",
+				domain.TriggerPrice:  domain.Price(4300),
+				domain.OrderSize:     domain.Size(1),
+				domain.TrailDistance: domain.Trailing{},
+				domain.ExecQuery:     map[string]string{"order_type": "take_profit"}},
+			"Wrong query parameter: no stop_price"},
+		{"Wrong order type query", http.MethodPost, addTrig, http.StatusBadRequest,
+			map[domain.Market]interface{}{
+				domain.MarketName:    domain.Market("pi_ethusd"),
+				domain.OrderSide:     "sell",
+				domain.TriggerPrice:  domain.Price(4300),
+				domain.OrderSize:     domain.Size(1),
+				domain.TrailDistance: domain.Trailing{},
+				domain.ExecQuery:     map[string]string{"order_type": "lmt", "trigger_signal": "mark"}},
+			"Wrong query parameter: trigger_signal: mark"},
+	}
+
+	for _, test := range tests {
+		request := httptest.NewRequest(test.method, test.url, nil)
+
+		var ctx context.Context
+		for k, v := range test.query {
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			ctx = context.WithValue(ctx, k, v)
+		}
+
+		response := httptest.NewRecorder()
+		handler.addTrigger(response, request.WithContext(ctx))
+		body := response.Body.String()
+
+		if !assert.Equal(t, test.status, response.Code, "%v: Expect: %v, Got: %v", test.name, test.status, response.Code) ||
+			!assert.Equal(t, test.resp, body, "%v: Expect: %v, Got: %v", test.name, test.resp, body) {
+			t.Fatal()
+		}
+	}
+}
+
+func TestCancelTrigger(t *testing.T) {
+	tests := []Test{
+		{"Right query", http.MethodPost, cancelTrig, http.StatusOK,
+			map[domain.Market]interface{}{
+				domain.MarketName: domain.Market("pi_ethusd"),
+				domain.TriggerID:  "tp1"},
+			"{\"market\":\"pi_ethusd\",\"status\":\"ok\"}\n"},
+		{"No such order", http.MethodPost, cancelTrig, http.StatusBadRequest,
+			map[domain.Market]interface{}{
+				domain.MarketName: domain.Market("pi_ethusd"),
+				domain.TriggerID:  "tp1"},
+			"{\"market\":\"pi_ethusd\",\"status\":\"No such order: pi_ethusd: tp1\"}\n"},
+		{"No id query", http.MethodPost, cancelTrig, http.StatusBadRequest,
+			map[domain.Market]interface{}{
+				domain.MarketName: domain.Market("pi_ethusd"),
+				domain.TriggerID:  ""},
+			"Wrong query parameter: no id"},
+	}
+
+	for _, test := range tests {
+		request := httptest.NewRequest(test.method, test.url, nil)
+
+		var ctx context.Context
+		for k, v := range test.query {
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			ctx = context.WithValue(ctx, k, v)
+		}
+
+		response := httptest.NewRecorder()
+		handler.cancelTrigger(response, request.WithContext(ctx))
+		body := response.Body.String()
+
+		if !assert.Equal(t, test.status, response.Code, "%v: Expect: %v, Got: %v", test.name, test.status, response.Code) ||
+			!assert.Equal(t, test.resp, body, "%v: Expect: %v, Got: %v", test.name, test.resp, body) {
+			t.Fatal()
+		}
+	}
+}
+
+func TestSetStrategy(t *testing.T) {
+	tests := []Test{
+		{"Right query", http.MethodPost, setStrat, http.StatusOK,
+			map[domain.Market]interface{}{
+				domain.MarketName:   domain.Market("pi_ethusd"),
+				domain.StrategyName: "breakout"},
+			"{\"market\":\"pi_ethusd\",\"status\":\"ok\"}\n"},
+		{"Unknown strategy", http.MethodPost, setStrat, http.StatusBadRequest,
+			map[domain.Market]interface{}{
+				domain.MarketName:   domain.Market("pi_ethusd"),
+				domain.StrategyName: "martingale"},
+			"{\"market\":\"pi_ethusd\",\"status\":\"Unknown strategy: martingale\"}\n"},
+		{"No strategy query", http.MethodPost, setStrat, http.StatusBadRequest,
+			map[domain.Market]interface{}{
+				domain.MarketName:   domain.Market("pi_ethusd"),
+				domain.StrategyName: ""},
+			"Wrong query parameter: no strategy"},
+		{"No such market", http.MethodPost, setStrat, http.StatusBadRequest,
+			map[domain.Market]interface{}{
+				domain.MarketName:   domain.Market("not_set"),
+				domain.StrategyName: "breakout"},
+			"{\"market\":\"not_set\",\"status\":\"No market was set: not_set\"}\n"},
+	}
+
+	for _, test := range tests {
+		request := httptest.NewRequest(test.method, test.url, nil)
+
+		var ctx context.Context
+		for k, v := range test.query {
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			ctx = context.WithValue(ctx, k, v)
+		}
+
+		response := httptest.NewRecorder()
+		handler.setStrategy(response, request.WithContext(ctx))
+		body := response.Body.String()
+
+		if !assert.Equal(t, test.status, response.Code, "%v: Expect: %v, Got: %v", test.name, test.status, response.Code) ||
+			!assert.Equal(t, test.resp, body, "%v: Expect: %v, Got: %v", test.name, test.resp, body) {
+			t.Fatal()
+		}
+	}
+}
+
+func TestSetPaper(t *testing.T) {
+	tests := []Test{
+		{"Paper on", http.MethodPost, setPaper, http.StatusOK,
+			map[domain.Market]interface{}{
+				domain.MarketName: domain.Market("pi_ethusd"),
+				domain.PaperMode:  domain.Paper{Enabled: true, Slippage: 0.1, Fee: 0.05}},
+			"{\"market\":\"pi_ethusd\",\"status\":\"ok\",\"paper\":true}\n"},
+		{"Paper off", http.MethodPost, setPaper, http.StatusOK,
+			map[domain.Market]interface{}{
+				domain.MarketName: domain.Market("pi_ethusd"),
+				domain.PaperMode:  domain.Paper{}},
+			"{\"market\":\"pi_ethusd\",\"status\":\"ok\"}\n"},
+		{"Wrong slippage", http.MethodPost, setPaper, http.StatusBadRequest,
+			map[domain.Market]interface{}{
+				domain.MarketName: domain.Market("pi_ethusd"),
+				domain.PaperMode:  domain.Paper{Enabled: true, Slippage: -1}},
+			"Wrong query parameter: slippage: -1"},
+		{"No paper query", http.MethodPost, setPaper, http.StatusBadRequest,
+			map[domain.Market]interface{}{
+				domain.MarketName: domain.Market("pi_ethusd")},
+			"Wrong query parameter: no paper"},
+		{"No such market", http.MethodPost, setPaper, http.StatusBadRequest,
+			map[domain.Market]interface{}{
+				domain.MarketName: domain.Market("not_set"),
+				domain.PaperMode:  domain.Paper{Enabled: true}},
+			"{\"market\":\"not_set\",\"status\":\"No market was set: not_set\"}\n"},
+	}
+
+	for _, test := range tests {
+		request := httptest.NewRequest(test.method, test.url, nil)
+
+		var ctx context.Context
+		for k, v := range test.query {
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			ctx = context.WithValue(ctx, k, v)
+		}
+
+		response := httptest.NewRecorder()
+		handler.setPaper(response, request.WithContext(ctx))
+		body := response.Body.String()
+
+		if !assert.Equal(t, test.status, response.Code, "%v: Expect: %v, Got: %v", test.name, test.status, response.Code) ||
+			!assert.Equal(t, test.resp, body, "%v: Expect: %v, Got: %v", test.name, test.resp, body) {
+			t.Fatal()
+		}
+	}
+}
+
+func TestPositions(t *testing.T) {
+	open := &positionsMock{Robot: rob, positions: []domain.Position{{Market: "pi_xbtusd", Size: 2, AvgPrice: 50000,
+		LastPrice: 51000, Unrealized: 0.00000078, Trades: 1, PnLCurrency: "XBT"}}}
+
+	tests := []struct {
+		Test
+		robot Robot
+	}{
+		{Test{"No trades", http.MethodGet, positions, http.StatusOK,
+			map[domain.Market]interface{}{}, "[]\n"}, rob},
+		{Test{"Open position", http.MethodGet, positions, http.StatusOK,
+			map[domain.Market]interface{}{},
+			"[{\"market\":\"pi_xbtusd\",\"size\":2,\"avg_price\":50000,\"last_price\":51000,\"realized_pnl\":0," +
+				"\"unrealized_pnl\":7.8e-7,\"fees\":0,\"trades\":1,\"pnl_currency\":\"XBT\"}]\n"}, open},
+	}
+
+	for _, test := range tests {
+		request := httptest.NewRequest(test.method, test.url, nil)
+
+		response := httptest.NewRecorder()
+		New(test.robot, logger).positions(response, request)
+		body := response.Body.String()
+
+		if !assert.Equal(t, test.status, response.Code, "%v: Expect: %v, Got: %v", test.name, test.status, response.Code) ||
+			!assert.Equal(t, test.resp, body, "%v: Expect: %v, Got: %v", test.name, test.resp, body) {
+			t.Fatal()
+		}
+	}
+}
+
+func TestSetFeed(t *testing.T) {
+	tests := []Test{
+		{"Interval and source", http.MethodPost, setFeed, http.StatusOK,
+			map[domain.Market]interface{}{
+				domain.MarketName: domain.Market("pi_ethusd"),
+				domain.CandleFeed: domain.Feed{Interval: "5m", Source: "hilo"}},
+			"{\"market\":\"pi_ethusd\",\"status\":\"ok\"}\n"},
+		{"Wrong interval", http.MethodPost, setFeed, http.StatusBadRequest,
+			map[domain.Market]interface{}{
+				domain.MarketName: domain.Market("pi_ethusd"),
+				domain.CandleFeed: domain.Feed{Interval: "2m"}},
+			"{\"market\":\"pi_ethusd\",\"status\":\"Unknown candle interval or price source: 2m\"}\n"},
+		{"No feed query", http.MethodPost, setFeed, http.StatusBadRequest,
+			map[domain.Market]interface{}{
+				domain.MarketName: domain.Market("pi_ethusd"),
+				domain.CandleFeed: domain.Feed{}},
+			"Wrong query parameter: no interval or source"},
+		{"No such market", http.MethodPost, setFeed, http.StatusBadRequest,
+			map[domain.Market]interface{}{
+				domain.MarketName: domain.Market("not_set"),
+				domain.CandleFeed: domain.Feed{Source: "close"}},
+			"{\"market\":\"not_set\",\"status\":\"No market was set: not_set\"}\n"},
+	}
+
+	for _, test := range tests {
+		request := httptest.NewRequest(test.method, test.url, nil)
+
+		var ctx context.Context
+		for k, v := range test.query {
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			ctx = context.WithValue(ctx, k, v)
+		}
+
+		response := httptest.NewRecorder()
+		handler.setFeed(response, request.WithContext(ctx))
+		body := response.Body.String()
+
+		if !assert.Equal(t, test.status, response.Code, "%v: Expect: %v, Got: %v", test.name, test.status, response.Code) ||
+			!assert.Equal(t, test.resp, body, "%v: Expect: %v, Got: %v", test.name, test.resp, body) {
+			t.Fatal()
+		}
+	}
+}
+
+func TestGetOrders(t *testing.T) {
+	storage.SaveOrder(context.Background(), domain.Order{Market: "pi_ethusd", Typ: "buy", Price: 100, Size: 1, Outcome: domain.OrderPlaced, Status: "placed"})
+	storage.SaveOrder(context.Background(), domain.Order{Market: "pi_xbtusd", Typ: "sell", Price: 50, Size: 1, Outcome: domain.OrderNoFunds,
+		Status: "insufficientAvailableFunds"})
+
+	cursor := domain.Cursor{Time: time.Date(2021, 12, 1, 13, 37, 37, 0, time.UTC), RowID: 42}.String()
+
+	tests := []Mid{
+		{"Placed", map[string]string{"outcome": "placed"},
+			"{\"orders\":[{\"market\":\"pi_ethusd\",\"type\":\"buy\",\"price\":100,\"size\":1,\"outcome\":\"placed\",\"status\":\"placed\"}]}\n"},
+		{"Market and side", map[string]string{"market": "pi_xbtusd", "type": "sell", "sort": "desc", "limit": "10",
+			"from": "2021-12-01T00:00:00Z", "to": "2021-12-02T00:00:00+03:00", "cursor": cursor},
+			"{\"orders\":[{\"market\":\"pi_xbtusd\",\"type\":\"sell\",\"price\":50,\"size\":1,\"outcome\":\"insufficient_funds\",\"status\":\"insufficientAvailableFunds\"}]}\n"},
+		{"No such outcome", map[string]string{"outcome": "filled"},
+			"Wrong query parameter: outcome: filled"},
+		{"Wrong side", map[string]string{"type": "long"},
+			"Wrong query parameter: type: long"},
+		{"Wrong time", map[string]string{"from": "2021-12-01"},
+			"Wrong query parameter: from: 2021-12-01"},
+		{"Wrong limit", map[string]string{"limit": "1001"},
+			"Wrong query parameter: limit: 1001"},
+		{"Wrong cursor", map[string]string{"cursor": "xyz"},
+			"Wrong query parameter: cursor: xyz"},
+		{"Wrong sort", map[string]string{"sort": "up"},
+			"Wrong query parameter: sort: up"},
+	}
+
+	r := chi.NewRouter()
+	r.With(getOrderFilter).Get("/", handler.getOrders)
+
+	ts := httptest.NewServer(r)
+	defer ts.Close()
+
+	for _, test := range tests {
+		q := url.Values{}
+		for k, v := range test.query {
+			q.Add(k, v)
+		}
+
+		res, err := http.Get(ts.URL + "?" + q.Encode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+
+		if !assert.Equal(t, test.resp, string(raw), "%v: Expect: %v, Got: %v", test.name, test.resp, string(raw)) {
+			t.Fatal()
+		}
+	}
+}
+
+func TestExportOrders(t *testing.T) {
+	ts := time.Date(2021, 12, 1, 13, 37, 37, 0, time.UTC)
+	storage.SaveOrder(context.Background(), domain.Order{Time: &ts, Market: "pi_ltcusd", Typ: "buy", Price: 150.5, Size: 2, Fee: 0.3,
+		OrderID: "61ca5732", Outcome: domain.OrderPlaced, Status: "placed"})
+
+	tests := []Mid{
+		{"CSV", map[string]string{"format": "csv", "market": "pi_ltcusd"},
+			"time,order_id,market,side,price,size,fee,realized_pnl,pnl_currency,paper\n" +
+				"2021-12-01T13:37:37Z,61ca5732,pi_ltcusd,buy,150.5,2,0.3,0,LTC,false\n"},
+		{"JSON Lines", map[string]string{"format": "jsonl", "market": "pi_ltcusd"},
+			"{\"time\":\"2021-12-01T13:37:37Z\",\"order_id\":\"61ca5732\",\"market\":\"pi_ltcusd\",\"side\":\"buy\"," +
+				"\"price\":150.5,\"size\":2,\"fee\":0.3,\"realized_pnl\":0,\"pnl_currency\":\"LTC\",\"paper\":false}\n"},
+		{"Empty CSV", map[string]string{"format": "csv", "market": "pi_bchusd"},
+			"time,order_id,market,side,price,size,fee,realized_pnl,pnl_currency,paper\n"},
+		{"No format", map[string]string{"market": "pi_ltcusd"},
+			"Wrong query parameter: no format"},
+		{"Wrong format", map[string]string{"format": "xlsx"},
+			"Wrong query parameter: format: xlsx"},
+		{"Wrong time", map[string]string{"format": "csv", "to": "yesterday"},
+			"Wrong query parameter: to: yesterday"},
+		{"Side", map[string]string{"format": "csv", "market": "pi_ltcusd", "type": "sell"},
+			"time,order_id,market,side,price,size,fee,realized_pnl,pnl_currency,paper\n"},
+		{"Limit", map[string]string{"format": "csv", "limit": "10"},
+			"Wrong query parameter: limit isn't supported"},
+		{"Sort", map[string]string{"format": "csv", "sort": "desc"},
+			"Wrong query parameter: sort isn't supported"},
+	}
+
+	r := chi.NewRouter()
+	r.With(getOrderFilter, getFormat).Get("/", handler.exportOrders)
+
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	for _, test := range tests {
+		q := url.Values{}
+		for k, v := range test.query {
+			q.Add(k, v)
+		}
+
+		res, err := http.Get(srv.URL + "?" + q.Encode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+
+		if !assert.Equal(t, test.resp, string(raw), "%v: Expect: %v, Got: %v", test.name, test.resp, string(raw)) {
+			t.Fatal()
+		}
+	}
+}
+
+func TestExportFailed(t *testing.T) {
+	ts := time.Date(2021, 12, 1, 13, 37, 37, 0, time.UTC)
+	record := domain.TradeRecord{Time: &ts, Market: "pi_ltcusd", Side: "buy", Price: 150.5, Size: 2, PnLCurrency: "LTC"}
+
+	tests := []struct {
+		name    string
+		records []domain.TradeRecord
+		status  int
+		resp    string
+	}{
+		{"Before records", nil, http.StatusInternalServerError, domain.InternalServerError},
+		{"After records", []domain.TradeRecord{record}, http.StatusOK,
+			"time,order_id,market,side,price,size,fee,realized_pnl,pnl_currency,paper\n" +
+				"2021-12-01T13:37:37Z,,pi_ltcusd,buy,150.5,2,0,0,LTC,false\n"},
+	}
+
+	for _, test := range tests {
+		r := chi.NewRouter()
+		robot := &exportMock{Robot: rob, records: test.records, err: errors.New("connection reset")}
+		r.With(getOrderFilter, getFormat).Get("/", New(robot, logger).exportOrders)
+		srv := httptest.NewServer(r)
+
+		res, err := http.Get(srv.URL + "?format=csv")
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		srv.Close()
+
+		// the export is cut, so the client can't take it for the complete one
+		if !assert.Equal(t, test.status, res.StatusCode, test.name) || !assert.Equal(t, test.resp, string(raw), test.name) ||
+			test.records != nil && !assert.Error(t, err, test.name) {
+			t.Fatal()
+		}
+	}
+}
+
+func TestGetCandles(t *testing.T) {
+	ts := time.Date(2021, 12, 1, 13, 37, 0, 0, time.UTC)
+	for _, v := range []float64{4100.5, 4101} {
+		storage.SaveCandle(context.Background(), domain.CandleRecord{Market: "pi_ethusd", Interval: "1m", Time: ts,
+			Open: 4100, High: 4102, Low: 4099, Close: v, Volume: 3})
+	}
+	storage.SaveCandle(context.Background(), domain.CandleRecord{Market: "pi_ethusd", Interval: "5m", Time: ts,
+		Open: 4090, High: 4102, Low: 4080, Close: 4101, Volume: 20})
+
+	tests := []Mid{
+		{"Market", map[string]string{"market": "pi_ethusd"},
+			"[{\"market\":\"pi_ethusd\",\"interval\":\"1m\",\"time\":\"2021-12-01T13:37:00Z\",\"open\":4100,\"high\":4102," +
+				"\"low\":4099,\"close\":4101,\"volume\":3}]\n"},
+		{"Interval and time range", map[string]string{"market": "pi_ethusd", "interval": "5m",
+			"from": "2021-12-01T16:00:00+03:00", "to": "2021-12-02T00:00:00Z", "limit": "10", "sort": "desc"},
+			"[{\"market\":\"pi_ethusd\",\"interval\":\"5m\",\"time\":\"2021-12-01T13:37:00Z\",\"open\":4090,\"high\":4102," +
+				"\"low\":4080,\"close\":4101,\"volume\":20}]\n"},
+		{"Empty", map[string]string{"market": "pi_ethusd", "to": "2021-12-01T00:00:00Z"},
+			"[]\n"},
+		{"No market", map[string]string{"interval": "1m"},
+			"Wrong query parameter: no market"},
+		{"Wrong interval", map[string]string{"market": "pi_ethusd", "interval": "2m"},
+			"Wrong query parameter: interval: 2m"},
+		{"Wrong limit", map[string]string{"market": "pi_ethusd", "limit": "0"},
+			"Wrong query parameter: limit: 0"},
+	}
+
+	r := chi.NewRouter()
+	r.With(getCandleFilter).Get("/", handler.getCandles)
+
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	for _, test := range tests {
+		q := url.Values{}
+		for k, v := range test.query {
+			q.Add(k, v)
+		}
+
+		res, err := http.Get(srv.URL + "?" + q.Encode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		raw, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+
+		if !assert.Equal(t, test.resp, string(raw), "%v: Expect: %v, Got: %v", test.name, test.resp, string(raw)) {
+			t.Fatal()
+		}
+	}
+}
+
+func TestExchangeQuery(t *testing.T) {
+	tests := []Test{
+		{"No cancel query", http.MethodPost, "/exchange/cancel", http.StatusBadRequest,
+			map[domain.Market]interface{}{
+				domain.CancelQuery: map[string]string{}},
+			"Wrong query parameter: no order_id"},
+		{"Order and market", http.MethodPost, "/exchange/cancel", http.StatusBadRequest,
+			map[domain.Market]interface{}{
+				domain.CancelQuery: map[string]string{"order_id": "o1", "market": "pi_ethusd"}},
+			"Wrong query parameter: market: pi_ethusd"},
+		{"Wrong all", http.MethodPost, "/exchange/cancel", http.StatusBadRequest,
+			map[domain.Market]interface{}{
+				domain.CancelQuery: map[string]string{"all": "false"}},
+			"Wrong query parameter: all: false"},
+		{"Wrong before", http.MethodGet, "/exchange/fills", http.StatusBadRequest,
+			map[domain.Market]interface{}{
+				domain.FillsQuery: "yesterday"},
+			"Wrong query parameter: before: yesterday"},
+	}
+
+	for _, test := range tests {
+		request := httptest.NewRequest(test.method, test.url, nil)
+
+		ctx := context.Background()
+		for k, v := range test.query {
+			ctx = context.WithValue(ctx, k, v)
+		}
+
+		response := httptest.NewRecorder()
+		if test.method == http.MethodPost {
+			handler.cancelOrders(response, request.WithContext(ctx))
+		} else {
+			handler.fills(response, request.WithContext(ctx))
+		}
+		body := response.Body.String()
+
+		if !assert.Equal(t, test.status, response.Code, "%v: Expect: %v, Got: %v", test.name, test.status, response.Code) ||
+			!assert.Equal(t, test.resp, body, "%v: Expect: %v, Got: %v", test.name, test.resp, body) {
+			t.Fatal()
+		}
+	}
+}
+
+func TestExchangeError(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		resp   string
+	}{
+		{"Kraken error", fmt.Errorf("OpenOrders: %w: apiLimitExceeded", domain.UnsuccessfulResponse), http.StatusBadGateway,
+			"OpenOrders: Unsuccessful response: apiLimitExceeded"},
+		{"Server error", errors.New("OpenOrders: Fail to send request: timeout"), http.StatusInternalServerError,
+			"Internal Server Error"},
+	}
+
+	for _, test := range tests {
+		request := httptest.NewRequest(http.MethodGet, "/exchange/openorders", nil)
+
+		response := httptest.NewRecorder()
+		New(&exchangeMock{Robot: rob, err: test.err}, logger).openOrders(response, request)
+		body := response.Body.String()
+
+		if !assert.Equal(t, test.status, response.Code, "%v: Expect: %v, Got: %v", test.name, test.status, response.Code) ||
+			!assert.Equal(t, test.resp, body, "%v: Expect: %v, Got: %v", test.name, test.resp, body) {
+			t.Fatal()
+		}
+	}
+}
+
+func TestParseCancel(t *testing.T) {
+	req, param := parseCancel(map[string]string{"order_id": "o1"})
+	if !assert.Equal(t, &cancelRequest{orderID: "o1"}, req) || !assert.Equal(t, "", param) {
+		t.Fatal()
+	}
+	req, _ = parseCancel(map[string]string{"market": "pi_ethusd"})
+	if !assert.Equal(t, &cancelRequest{market: "pi_ethusd"}, req) {
+		t.Fatal()
+	}
+	req, _ = parseCancel(map[string]string{"all": "true"})
+	if !assert.Equal(t, &cancelRequest{all: true}, req) {
+		t.Fatal()
+	}
+	req, param = parseCancel(map[string]string{"market": "pi_ethusd", "all": "true"})
+	if !assert.Nil(t, req) || !assert.Equal(t, "all", param) {
+		t.Fatal()
+	}
+}
@@ -1,9 +1,12 @@
 package handlers
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/cgriceld/crypto-trade-bot/internal/domain"
 
@@ -34,25 +37,621 @@ func (h *Handler) checkPriceSize(w http.ResponseWriter, r *http.Request) (domain
 		return 0, 0
 	}
 
-	v = r.Context().Value(domain.OrderSize)
+	s := h.checkSize(w, r)
+	if s == 0 {
+		return 0, 0
+	}
+
+	return p, s
+}
+
+func (h *Handler) checkSize(w http.ResponseWriter, r *http.Request) domain.Size {
+	v := r.Context().Value(domain.OrderSize)
 	if v == nil {
 		h.logger.Errorf("%v: %v: no %v", r.URL, WrongQuery, domain.OrderSize)
 		renderPlain(w, r, http.StatusBadRequest, fmt.Sprintf("%v: no %v", WrongQuery, domain.OrderSize))
-		return 0, 0
+		return 0
 	}
 	s, ok := v.(domain.Size)
 	if !ok {
 		h.logger.Errorf("%v: %v: %v", r.URL, FailedQuery, domain.OrderSize)
 		renderPlain(w, r, http.StatusInternalServerError, domain.InternalServerError)
-		return 0, 0
+		return 0
 	}
 	if s <= 0 {
 		h.logger.Errorf("%v: %v: %v %v", r.URL, WrongQuery, domain.OrderSize, s)
 		renderPlain(w, r, http.StatusBadRequest, fmt.Sprintf("%v: %v: %v", WrongQuery, domain.OrderSize, s))
-		return 0, 0
+		return 0
 	}
 
-	return p, s
+	return s
+}
+
+func (h *Handler) checkSide(w http.ResponseWriter, r *http.Request) string {
+	v := r.Context().Value(domain.OrderSide)
+	if v == nil {
+		h.logger.Errorf("%v: %v: no %v", r.URL, WrongQuery, domain.OrderSide)
+		renderPlain(w, r, http.StatusBadRequest, fmt.Sprintf("%v: no %v", WrongQuery, domain.OrderSide))
+		return ""
+	}
+	typ, ok := v.(string)
+	if !ok {
+		h.logger.Errorf("%v: %v: %v", r.URL, FailedQuery, domain.OrderSide)
+		renderPlain(w, r, http.StatusInternalServerError, domain.InternalServerError)
+		return ""
+	}
+	if typ != "sell" && typ != "buy" {
+		h.logger.Errorf("%v: %v: %v %v", r.URL, WrongQuery, domain.OrderSide, typ)
+		renderPlain(w, r, http.StatusBadRequest, fmt.Sprintf("%v: %v: %v", WrongQuery, domain.OrderSide, typ))
+		return ""
+	}
+
+	return typ
+}
+
+func (h *Handler) checkTrailing(w http.ResponseWriter, r *http.Request) *domain.Trailing {
+	v := r.Context().Value(domain.TrailDistance)
+	if v == nil {
+		h.logger.Errorf("%v: %v: no %v", r.URL, WrongQuery, domain.TrailDistance)
+		renderPlain(w, r, http.StatusBadRequest, fmt.Sprintf("%v: no %v", WrongQuery, domain.TrailDistance))
+		return nil
+	}
+	t, ok := v.(domain.Trailing)
+	if !ok {
+		h.logger.Errorf("%v: %v: %v", r.URL, FailedQuery, domain.TrailDistance)
+		renderPlain(w, r, http.StatusInternalServerError, domain.InternalServerError)
+		return nil
+	}
+	if t.Distance <= 0 || (t.Percent && t.Distance >= 100) {
+		h.logger.Errorf("%v: %v: %v %v", r.URL, WrongQuery, domain.TrailDistance, t.Distance)
+		renderPlain(w, r, http.StatusBadRequest, fmt.Sprintf("%v: %v: %v", WrongQuery, domain.TrailDistance, t.Distance))
+		return nil
+	}
+
+	return &t
+}
+
+// linked reports whether the active order id of market is linked with
+// the opposite ones, oco parameter may be omitted, so it's read back.
+func (h *Handler) linked(ctx context.Context, m domain.Market, id string) bool {
+	active, err := h.robot.GetActive(ctx, m)
+	if err != nil {
+		return false
+	}
+	for _, v := range active {
+		if v.ID == id {
+			return v.OCO
+		}
+	}
+
+	return false
+}
+
+// checkOCO returns nil if oco query parameter wasn't passed, ok is false
+// if the parameter is invalid and response was already written.
+func (h *Handler) checkOCO(w http.ResponseWriter, r *http.Request) (oco *bool, ok bool) {
+	v := r.Context().Value(domain.OCOLink)
+	if v == nil {
+		return nil, true
+	}
+	q, ok := v.(string)
+	if !ok {
+		h.logger.Errorf("%v: %v: %v", r.URL, FailedQuery, domain.OCOLink)
+		renderPlain(w, r, http.StatusInternalServerError, domain.InternalServerError)
+		return nil, false
+	}
+	if q == "" {
+		return nil, true
+	}
+	link, err := strconv.ParseBool(q)
+	if err != nil {
+		h.logger.Errorf("%v: %v: %v %v", r.URL, WrongQuery, domain.OCOLink, q)
+		renderPlain(w, r, http.StatusBadRequest, fmt.Sprintf("%v: %v: %v", WrongQuery, domain.OCOLink, q))
+		return nil, false
+	}
+
+	return &link, true
+}
+
+// checkExecution parses Kraken order type and its parameters, all of them
+// are optional.
+func (h *Handler) checkExecution(w http.ResponseWriter, r *http.Request) *domain.Execution {
+	v := r.Context().Value(domain.ExecQuery)
+	if v == nil {
+		return &domain.Execution{}
+	}
+	query, ok := v.(map[string]string)
+	if !ok {
+		h.logger.Errorf("%v: %v: %v", r.URL, FailedQuery, domain.ExecQuery)
+		renderPlain(w, r, http.StatusInternalServerError, domain.InternalServerError)
+		return nil
+	}
+
+	exec, param := parseExecution(query)
+	if exec == nil && query[param] == "" {
+		h.logger.Errorf("%v: %v: no %v", r.URL, WrongQuery, param)
+		renderPlain(w, r, http.StatusBadRequest, fmt.Sprintf("%v: no %v", WrongQuery, param))
+		return nil
+	}
+	if exec == nil {
+		h.logger.Errorf("%v: %v: %v %v", r.URL, WrongQuery, param, query[param])
+		renderPlain(w, r, http.StatusBadRequest, fmt.Sprintf("%v: %v: %v", WrongQuery, param, query[param]))
+		return nil
+	}
+
+	return exec
+}
+
+// parseExecution returns nil execution and the name of the first wrong
+// parameter if query is invalid.
+func parseExecution(query map[string]string) (*domain.Execution, string) {
+	exec := &domain.Execution{
+		OrderType:     query["order_type"],
+		TriggerSignal: query["trigger_signal"],
+	}
+
+	if v, ok := query["stop_price"]; ok {
+		price, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, "stop_price"
+		}
+		exec.StopPrice = price
+	}
+	if v, ok := query["reduce_only"]; ok {
+		reduce, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, "reduce_only"
+		}
+		exec.ReduceOnly = reduce
+	}
+	if param := exec.Invalid(); param != "" {
+		return nil, param
+	}
+
+	return exec, ""
+}
+
+// checkExchange returns nil if exchange query parameter wasn't passed, ok is
+// false if parameters are invalid and response was already written. Stop price
+// of the exchange order is p.
+func (h *Handler) checkExchange(w http.ResponseWriter, r *http.Request, p domain.Price) (exec *domain.Execution, ok bool) {
+	v := r.Context().Value(domain.ExchangeOrder)
+	if v == nil {
+		return nil, true
+	}
+	query, ok := v.(map[string]string)
+	if !ok {
+		h.logger.Errorf("%v: %v: %v", r.URL, FailedQuery, domain.ExchangeOrder)
+		renderPlain(w, r, http.StatusInternalServerError, domain.InternalServerError)
+		return nil, false
+	}
+	if query["exchange"] == "" {
+		return nil, true
+	}
+
+	exec, param := parseExchange(query, p)
+	if exec == nil {
+		h.logger.Errorf("%v: %v: %v %v", r.URL, WrongQuery, param, query[param])
+		renderPlain(w, r, http.StatusBadRequest, fmt.Sprintf("%v: %v: %v", WrongQuery, param, query[param]))
+		return nil, false
+	}
+
+	return exec, true
+}
+
+// parseExchange returns nil execution and the name of the first wrong
+// parameter if query is invalid, exchange is the type of Kraken order.
+func parseExchange(query map[string]string, p domain.Price) (*domain.Execution, string) {
+	exec := &domain.Execution{
+		OrderType:     query["exchange"],
+		StopPrice:     float64(p),
+		TriggerSignal: query["trigger_signal"],
+	}
+
+	if !exec.Stop() {
+		return nil, "exchange"
+	}
+	if v, ok := query["reduce_only"]; ok {
+		reduce, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, "reduce_only"
+		}
+		exec.ReduceOnly = reduce
+	}
+	if param := exec.Invalid(); param != "" {
+		return nil, param
+	}
+
+	return exec, ""
+}
+
+// checkBefore returns nil if before query parameter wasn't passed, ok is false
+// if it's invalid and response was already written.
+func (h *Handler) checkBefore(w http.ResponseWriter, r *http.Request) (before *time.Time, ok bool) {
+	v := r.Context().Value(domain.FillsQuery)
+	if v == nil {
+		return nil, true
+	}
+	beforeQ, ok := v.(string)
+	if !ok {
+		h.logger.Errorf("%v: %v: %v", r.URL, FailedQuery, domain.FillsQuery)
+		renderPlain(w, r, http.StatusInternalServerError, domain.InternalServerError)
+		return nil, false
+	}
+	if beforeQ == "" {
+		return nil, true
+	}
+
+	ts, err := time.Parse(time.RFC3339, beforeQ)
+	if err != nil {
+		h.logger.Errorf("%v: %v: before %v", r.URL, WrongQuery, beforeQ)
+		renderPlain(w, r, http.StatusBadRequest, fmt.Sprintf("%v: before: %v", WrongQuery, beforeQ))
+		return nil, false
+	}
+
+	return &ts, true
+}
+
+// cancelRequest selects orders cancelled on Kraken: the order with orderID,
+// all orders of market or all orders of the account.
+type cancelRequest struct {
+	orderID string
+	market  domain.Market
+	all     bool
+}
+
+func (h *Handler) checkCancel(w http.ResponseWriter, r *http.Request) *cancelRequest {
+	v := r.Context().Value(domain.CancelQuery)
+	if v == nil {
+		h.logger.Errorf("%v: %v: no order_id", r.URL, WrongQuery)
+		renderPlain(w, r, http.StatusBadRequest, fmt.Sprintf("%v: no order_id", WrongQuery))
+		return nil
+	}
+	query, ok := v.(map[string]string)
+	if !ok {
+		h.logger.Errorf("%v: %v: %v", r.URL, FailedQuery, domain.CancelQuery)
+		renderPlain(w, r, http.StatusInternalServerError, domain.InternalServerError)
+		return nil
+	}
+
+	req, param := parseCancel(query)
+	if req == nil {
+		if query[param] == "" {
+			h.logger.Errorf("%v: %v: no %v", r.URL, WrongQuery, param)
+			renderPlain(w, r, http.StatusBadRequest, fmt.Sprintf("%v: no %v", WrongQuery, param))
+			return nil
+		}
+		h.logger.Errorf("%v: %v: %v %v", r.URL, WrongQuery, param, query[param])
+		renderPlain(w, r, http.StatusBadRequest, fmt.Sprintf("%v: %v: %v", WrongQuery, param, query[param]))
+		return nil
+	}
+
+	return req
+}
+
+// parseCancel returns nil request and the name of the wrong parameter if query
+// is invalid, the second of parameters if more than one is passed.
+func parseCancel(query map[string]string) (*cancelRequest, string) {
+	var set []string
+	for _, k := range cancelParams {
+		if _, ok := query[k]; ok {
+			set = append(set, k)
+		}
+	}
+	if len(set) == 0 {
+		return nil, "order_id"
+	}
+	if len(set) > 1 {
+		return nil, set[1]
+	}
+
+	req := &cancelRequest{
+		orderID: query["order_id"],
+		market:  domain.Market(query["market"]),
+	}
+	if v, ok := query["all"]; ok {
+		all, err := strconv.ParseBool(v)
+		if err != nil || !all {
+			return nil, "all"
+		}
+		req.all = true
+	}
+
+	return req, ""
+}
+
+func (h *Handler) checkID(w http.ResponseWriter, r *http.Request) string {
+	v := r.Context().Value(domain.TriggerID)
+	if v == nil {
+		h.logger.Errorf("%v: %v: no %v", r.URL, WrongQuery, domain.TriggerID)
+		renderPlain(w, r, http.StatusBadRequest, fmt.Sprintf("%v: no %v", WrongQuery, domain.TriggerID))
+		return ""
+	}
+	id, ok := v.(string)
+	if !ok {
+		h.logger.Errorf("%v: %v: %v", r.URL, FailedQuery, domain.TriggerID)
+		renderPlain(w, r, http.StatusInternalServerError, domain.InternalServerError)
+		return ""
+	}
+	if id == "" {
+		h.logger.Errorf("%v: %v: no %v", r.URL, WrongQuery, domain.TriggerID)
+		renderPlain(w, r, http.StatusBadRequest, fmt.Sprintf("%v: no %v", WrongQuery, domain.TriggerID))
+		return ""
+	}
+
+	return id
+}
+
+func (h *Handler) checkStrategy(w http.ResponseWriter, r *http.Request) string {
+	v := r.Context().Value(domain.StrategyName)
+	if v == nil {
+		h.logger.Errorf("%v: %v: no %v", r.URL, WrongQuery, domain.StrategyName)
+		renderPlain(w, r, http.StatusBadRequest, fmt.Sprintf("%v: no %v", WrongQuery, domain.StrategyName))
+		return ""
+	}
+	name, ok := v.(string)
+	if !ok {
+		h.logger.Errorf("%v: %v: %v", r.URL, FailedQuery, domain.StrategyName)
+		renderPlain(w, r, http.StatusInternalServerError, domain.InternalServerError)
+		return ""
+	}
+	if name == "" {
+		h.logger.Errorf("%v: %v: no %v", r.URL, WrongQuery, domain.StrategyName)
+		renderPlain(w, r, http.StatusBadRequest, fmt.Sprintf("%v: no %v", WrongQuery, domain.StrategyName))
+		return ""
+	}
+
+	return name
+}
+
+func (h *Handler) checkFeed(w http.ResponseWriter, r *http.Request) *domain.Feed {
+	v := r.Context().Value(domain.CandleFeed)
+	if v == nil {
+		h.logger.Errorf("%v: %v: no %v", r.URL, WrongQuery, domain.CandleFeed)
+		renderPlain(w, r, http.StatusBadRequest, fmt.Sprintf("%v: no interval or source", WrongQuery))
+		return nil
+	}
+	feed, ok := v.(domain.Feed)
+	if !ok {
+		h.logger.Errorf("%v: %v: %v", r.URL, FailedQuery, domain.CandleFeed)
+		renderPlain(w, r, http.StatusInternalServerError, domain.InternalServerError)
+		return nil
+	}
+	if feed.Interval == "" && feed.Source == "" {
+		h.logger.Errorf("%v: %v: no %v", r.URL, WrongQuery, domain.CandleFeed)
+		renderPlain(w, r, http.StatusBadRequest, fmt.Sprintf("%v: no interval or source", WrongQuery))
+		return nil
+	}
+
+	return &feed
+}
+
+// checkOrderFilter parses orders ledger filter, all parameters are optional.
+func (h *Handler) checkOrderFilter(w http.ResponseWriter, r *http.Request) *domain.OrderFilter {
+	v := r.Context().Value(domain.OrdersQuery)
+	if v == nil {
+		return &domain.OrderFilter{}
+	}
+	query, ok := v.(map[string]string)
+	if !ok {
+		h.logger.Errorf("%v: %v: %v", r.URL, FailedQuery, domain.OrdersQuery)
+		renderPlain(w, r, http.StatusInternalServerError, domain.InternalServerError)
+		return nil
+	}
+
+	filter, param := parseOrderFilter(query)
+	if filter == nil {
+		h.logger.Errorf("%v: %v: %v %v", r.URL, WrongQuery, param, query[param])
+		renderPlain(w, r, http.StatusBadRequest, fmt.Sprintf("%v: %v: %v", WrongQuery, param, query[param]))
+		return nil
+	}
+
+	return filter
+}
+
+func (h *Handler) checkFormat(w http.ResponseWriter, r *http.Request) string {
+	v := r.Context().Value(domain.ExportFormat)
+	if v == nil {
+		h.logger.Errorf("%v: %v: no %v", r.URL, WrongQuery, domain.ExportFormat)
+		renderPlain(w, r, http.StatusBadRequest, fmt.Sprintf("%v: no %v", WrongQuery, domain.ExportFormat))
+		return ""
+	}
+	format, ok := v.(string)
+	if !ok {
+		h.logger.Errorf("%v: %v: %v", r.URL, FailedQuery, domain.ExportFormat)
+		renderPlain(w, r, http.StatusInternalServerError, domain.InternalServerError)
+		return ""
+	}
+	if format == "" {
+		h.logger.Errorf("%v: %v: no %v", r.URL, WrongQuery, domain.ExportFormat)
+		renderPlain(w, r, http.StatusBadRequest, fmt.Sprintf("%v: no %v", WrongQuery, domain.ExportFormat))
+		return ""
+	}
+	if !domain.Contains(domain.ExportFormats, format) {
+		h.logger.Errorf("%v: %v: %v %v", r.URL, WrongQuery, domain.ExportFormat, format)
+		renderPlain(w, r, http.StatusBadRequest, fmt.Sprintf("%v: %v: %v", WrongQuery, domain.ExportFormat, format))
+		return ""
+	}
+
+	return format
+}
+
+// notExported returns the first orders filter parameter trade history export
+// doesn't support: it has executed orders only and is exported whole in time
+// order.
+func notExported(filter *domain.OrderFilter) string {
+	switch {
+	case filter.Outcome != "" && filter.Outcome != domain.OrderPlaced:
+		return "outcome"
+	case filter.Limit != 0:
+		return "limit"
+	case filter.Cursor != nil:
+		return "cursor"
+	case filter.Desc:
+		return "sort"
+	}
+
+	return ""
+}
+
+// parseOrderFilter returns nil filter and the name of the first wrong parameter
+// if query is invalid.
+func parseOrderFilter(query map[string]string) (*domain.OrderFilter, string) {
+	filter := &domain.OrderFilter{
+		Market: query["market"],
+		Side:   query["type"],
+	}
+
+	if v, ok := query["outcome"]; ok {
+		if !domain.Contains(domain.Outcomes, v) {
+			return nil, "outcome"
+		}
+		filter.Outcome = v
+	}
+	if v, ok := query["type"]; ok && v != "sell" && v != "buy" {
+		return nil, "type"
+	}
+	for _, k := range []string{"from", "to"} {
+		v, ok := query[k]
+		if !ok {
+			continue
+		}
+		ts, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, k
+		}
+		if k == "from" {
+			filter.From = &ts
+		} else {
+			filter.To = &ts
+		}
+	}
+	if v, ok := query["limit"]; ok {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > domain.MaxOrdersLimit {
+			return nil, "limit"
+		}
+		filter.Limit = limit
+	}
+	if v, ok := query["cursor"]; ok {
+		cursor, err := domain.ParseCursor(v)
+		if err != nil {
+			return nil, "cursor"
+		}
+		filter.Cursor = cursor
+	}
+	if v, ok := query["sort"]; ok {
+		if v != "asc" && v != "desc" {
+			return nil, "sort"
+		}
+		filter.Desc = v == "desc"
+	}
+
+	return filter, ""
+}
+
+// checkCandleFilter parses candle history filter, only market is required.
+// Interval is 1m if not set.
+func (h *Handler) checkCandleFilter(w http.ResponseWriter, r *http.Request) *domain.CandleFilter {
+	v := r.Context().Value(domain.CandlesQuery)
+	if v == nil {
+		h.logger.Errorf("%v: %v: no %v", r.URL, WrongQuery, domain.MarketName)
+		renderPlain(w, r, http.StatusBadRequest, fmt.Sprintf("%v: no %v", WrongQuery, domain.MarketName))
+		return nil
+	}
+	query, ok := v.(map[string]string)
+	if !ok {
+		h.logger.Errorf("%v: %v: %v", r.URL, FailedQuery, domain.CandlesQuery)
+		renderPlain(w, r, http.StatusInternalServerError, domain.InternalServerError)
+		return nil
+	}
+	if query["market"] == "" {
+		h.logger.Errorf("%v: %v: no %v", r.URL, WrongQuery, domain.MarketName)
+		renderPlain(w, r, http.StatusBadRequest, fmt.Sprintf("%v: no %v", WrongQuery, domain.MarketName))
+		return nil
+	}
+
+	filter, param := parseCandleFilter(query)
+	if filter == nil {
+		h.logger.Errorf("%v: %v: %v %v", r.URL, WrongQuery, param, query[param])
+		renderPlain(w, r, http.StatusBadRequest, fmt.Sprintf("%v: %v: %v", WrongQuery, param, query[param]))
+		return nil
+	}
+
+	return filter
+}
+
+// parseCandleFilter returns nil filter and the name of the first wrong parameter
+// if query is invalid.
+func parseCandleFilter(query map[string]string) (*domain.CandleFilter, string) {
+	filter := &domain.CandleFilter{
+		Market:   query["market"],
+		Interval: domain.DefaultInterval,
+	}
+
+	if v, ok := query["interval"]; ok {
+		if !domain.Contains(domain.Intervals, v) {
+			return nil, "interval"
+		}
+		filter.Interval = v
+	}
+	for _, k := range []string{"from", "to"} {
+		v, ok := query[k]
+		if !ok {
+			continue
+		}
+		ts, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return nil, k
+		}
+		if k == "from" {
+			filter.From = &ts
+		} else {
+			filter.To = &ts
+		}
+	}
+	if v, ok := query["limit"]; ok {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit <= 0 || limit > domain.MaxCandlesLimit {
+			return nil, "limit"
+		}
+		filter.Limit = limit
+	}
+	if v, ok := query["sort"]; ok {
+		if v != "asc" && v != "desc" {
+			return nil, "sort"
+		}
+		filter.Desc = v == "desc"
+	}
+
+	return filter, ""
+}
+
+func (h *Handler) checkPaper(w http.ResponseWriter, r *http.Request) *domain.Paper {
+	v := r.Context().Value(domain.PaperMode)
+	if v == nil {
+		h.logger.Errorf("%v: %v: no %v", r.URL, WrongQuery, domain.PaperMode)
+		renderPlain(w, r, http.StatusBadRequest, fmt.Sprintf("%v: no %v", WrongQuery, domain.PaperMode))
+		return nil
+	}
+	p, ok := v.(domain.Paper)
+	if !ok {
+		h.logger.Errorf("%v: %v: %v", r.URL, FailedQuery, domain.PaperMode)
+		renderPlain(w, r, http.StatusInternalServerError, domain.InternalServerError)
+		return nil
+	}
+	if p.Slippage < 0 || p.Slippage >= 100 {
+		h.logger.Errorf("%v: %v: slippage %v", r.URL, WrongQuery, p.Slippage)
+		renderPlain(w, r, http.StatusBadRequest, fmt.Sprintf("%v: slippage: %v", WrongQuery, p.Slippage))
+		return nil
+	}
+	if p.Fee < 0 || p.Fee >= 100 {
+		h.logger.Errorf("%v: %v: fee %v", r.URL, WrongQuery, p.Fee)
+		renderPlain(w, r, http.StatusBadRequest, fmt.Sprintf("%v: fee: %v", WrongQuery, p.Fee))
+		return nil
+	}
+
+	return &p
 }
 
 func (h *Handler) checkMarket(w http.ResponseWriter, r *http.Request) domain.Market {
@@ -77,6 +676,16 @@ func (h *Handler) checkMarket(w http.ResponseWriter, r *http.Request) domain.Mar
 	return m
 }
 
+// renderExchange renders error of request to Kraken: Kraken error text with
+// 502 if Kraken answered with error, 500 otherwise.
+func renderExchange(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, domain.UnsuccessfulResponse) {
+		renderPlain(w, r, http.StatusBadGateway, err.Error())
+		return
+	}
+	renderPlain(w, r, http.StatusInternalServerError, domain.InternalServerError)
+}
+
 func renderPlain(w http.ResponseWriter, r *http.Request, code int, text string) {
 	render.Status(r, code)
 	render.PlainText(w, r, text)
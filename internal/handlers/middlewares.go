@@ -49,3 +49,240 @@ func getSize(handler http.Handler) http.Handler {
 
 	return http.HandlerFunc(fn)
 }
+
+func getSide(handler http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		sideQ := r.URL.Query().Get("type")
+
+		ctx := context.WithValue(r.Context(), domain.OrderSide, sideQ)
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+func getTrailing(handler http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		var trail domain.Trailing
+		if val, err := strconv.ParseFloat(r.URL.Query().Get("distance"), 64); err == nil {
+			trail.Distance = val
+		}
+		if val, err := strconv.ParseBool(r.URL.Query().Get("percent")); err == nil {
+			trail.Percent = val
+		}
+
+		ctx := context.WithValue(r.Context(), domain.TrailDistance, trail)
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+func getOCO(handler http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		ocoQ := r.URL.Query().Get("oco")
+
+		ctx := context.WithValue(r.Context(), domain.OCOLink, ocoQ)
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+func getID(handler http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		idQ := r.URL.Query().Get("id")
+
+		ctx := context.WithValue(r.Context(), domain.TriggerID, idQ)
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+func getConditions(handler http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		condQ := r.URL.Query()["cond"]
+
+		ctx := context.WithValue(r.Context(), domain.Conditions, condQ)
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// execParams are query parameters of Kraken order type.
+var execParams = []string{"order_type", "stop_price", "reduce_only", "trigger_signal"}
+
+func getExecution(handler http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		query := make(map[string]string)
+		for _, k := range execParams {
+			if v := r.URL.Query().Get(k); v != "" {
+				query[k] = v
+			}
+		}
+
+		ctx := context.WithValue(r.Context(), domain.ExecQuery, query)
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// exchangeParams are query parameters of stop order resting on Kraken.
+var exchangeParams = []string{"exchange", "trigger_signal", "reduce_only"}
+
+func getExchange(handler http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		query := make(map[string]string)
+		for _, k := range exchangeParams {
+			if v := r.URL.Query().Get(k); v != "" {
+				query[k] = v
+			}
+		}
+
+		ctx := context.WithValue(r.Context(), domain.ExchangeOrder, query)
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+func getFills(handler http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		beforeQ := r.URL.Query().Get("before")
+
+		ctx := context.WithValue(r.Context(), domain.FillsQuery, beforeQ)
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// cancelParams select orders cancelled on Kraken, only one of them is allowed.
+var cancelParams = []string{"order_id", "market", "all"}
+
+func getCancel(handler http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		query := make(map[string]string)
+		for _, k := range cancelParams {
+			if v := r.URL.Query().Get(k); v != "" {
+				query[k] = v
+			}
+		}
+
+		ctx := context.WithValue(r.Context(), domain.CancelQuery, query)
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+func getStrategy(handler http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		strategyQ := r.URL.Query().Get("strategy")
+
+		ctx := context.WithValue(r.Context(), domain.StrategyName, strategyQ)
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+func getFeed(handler http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		feed := domain.Feed{
+			Interval: r.URL.Query().Get("interval"),
+			Source:   r.URL.Query().Get("source"),
+		}
+
+		ctx := context.WithValue(r.Context(), domain.CandleFeed, feed)
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// ordersParams are query parameters of orders ledger filter.
+var ordersParams = []string{"outcome", "market", "type", "from", "to", "limit", "cursor", "sort"}
+
+func getFormat(handler http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		formatQ := r.URL.Query().Get("format")
+
+		ctx := context.WithValue(r.Context(), domain.ExportFormat, formatQ)
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+func getOrderFilter(handler http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		query := make(map[string]string)
+		for _, k := range ordersParams {
+			if v := r.URL.Query().Get(k); v != "" {
+				query[k] = v
+			}
+		}
+
+		ctx := context.WithValue(r.Context(), domain.OrdersQuery, query)
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// candlesParams are query parameters of candle history filter.
+var candlesParams = []string{"market", "interval", "from", "to", "limit", "sort"}
+
+func getCandleFilter(handler http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		query := make(map[string]string)
+		for _, k := range candlesParams {
+			if v := r.URL.Query().Get(k); v != "" {
+				query[k] = v
+			}
+		}
+
+		ctx := context.WithValue(r.Context(), domain.CandlesQuery, query)
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+func getPaper(handler http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		enabled, err := strconv.ParseBool(r.URL.Query().Get("paper"))
+		if err != nil {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		paper := domain.Paper{
+			Enabled:  enabled,
+			Slippage: optionalFloat(r.URL.Query().Get("slippage")),
+			Fee:      optionalFloat(r.URL.Query().Get("fee")),
+		}
+
+		ctx := context.WithValue(r.Context(), domain.PaperMode, paper)
+		handler.ServeHTTP(w, r.WithContext(ctx))
+	}
+
+	return http.HandlerFunc(fn)
+}
+
+// optionalFloat returns 0 for empty query parameter and -1 for invalid one.
+func optionalFloat(q string) float64 {
+	if q == "" {
+		return 0
+	}
+	val, err := strconv.ParseFloat(q, 64)
+	if err != nil {
+		return -1
+	}
+
+	return val
+}
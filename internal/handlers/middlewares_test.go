@@ -23,11 +23,23 @@ func TestMid(t *testing.T) {
 			"market": "pi_ethusd",
 			"price":  "42",
 			"size":   "1"},
-			"{\"market\":\"pi_ethusd\",\"type\":\"sell\",\"price\":42,\"size\":1}\n"},
+			"{\"id\":\"sell\",\"market\":\"pi_ethusd\",\"type\":\"sell\",\"price\":42,\"size\":1}\n"},
+		{"OCO Query", map[string]string{
+			"market": "pi_ethusd",
+			"price":  "42",
+			"size":   "1",
+			"oco":    "true"},
+			"{\"id\":\"sell\",\"market\":\"pi_ethusd\",\"type\":\"sell\",\"price\":42,\"size\":1,\"oco\":true}\n"},
+		{"Wrong OCO Query", map[string]string{
+			"market": "pi_ethusd",
+			"price":  "42",
+			"size":   "1",
+			"oco":    "maybe"},
+			"Wrong query parameter: oco: maybe"},
 	}
 
 	r := chi.NewRouter()
-	r.With(getMarket, getPrice, getSize).Post("/", handler.setSell)
+	r.With(getMarket, getPrice, getSize, getOCO).Post("/", handler.setSell)
 
 	ts := httptest.NewServer(r)
 	defer ts.Close()
@@ -8,37 +8,112 @@ import (
 )
 
 type RepMock interface {
-	SaveOrder(order domain.Order)
-	GetOrders(ctx context.Context) ([]domain.Order, error)
+	SaveOrder(ctx context.Context, order domain.Order) error
+	GetOrders(ctx context.Context, filter domain.OrderFilter) (*domain.OrdersResp, error)
+	EachOrder(ctx context.Context, filter domain.OrderFilter, fn func(domain.Order) error) error
+	SaveSettings(ctx context.Context, settings domain.MarketSettings) error
+	GetSettings(ctx context.Context) ([]domain.MarketSettings, error)
+	SaveCandle(ctx context.Context, candle domain.CandleRecord) error
+	GetCandles(ctx context.Context, filter domain.CandleFilter) ([]domain.CandleRecord, error)
 	Close()
 }
 
 type OrdersInMemory map[string]domain.Order
 
 type ordersStorage struct {
-	orders OrdersInMemory
+	orders   OrdersInMemory
+	settings map[string]domain.MarketSettings
+	candles  []domain.CandleRecord
 }
 
 func NewRepMock() RepMock {
 	return &ordersStorage{
-		orders: make(OrdersInMemory),
+		orders:   make(OrdersInMemory),
+		settings: make(map[string]domain.MarketSettings),
 	}
 }
 
-func (s *ordersStorage) SaveOrder(order domain.Order) {
+func (s *ordersStorage) SaveOrder(ctx context.Context, order domain.Order) error {
 	s.orders[order.Market] = order
+	return nil
 }
 
-func (s *ordersStorage) GetOrders(ctx context.Context) ([]domain.Order, error) {
+func (s *ordersStorage) GetOrders(ctx context.Context, filter domain.OrderFilter) (*domain.OrdersResp, error) {
 	var res []domain.Order
 
 	for _, v := range s.orders {
+		if filter.Outcome != "" && v.Outcome != filter.Outcome ||
+			filter.Market != "" && v.Market != filter.Market ||
+			filter.Side != "" && v.Typ != filter.Side {
+			continue
+		}
+		res = append(res, v)
+	}
+
+	return &domain.OrdersResp{Orders: res}, nil
+}
+
+func (s *ordersStorage) EachOrder(ctx context.Context, filter domain.OrderFilter, fn func(domain.Order) error) error {
+	res, _ := s.GetOrders(ctx, filter)
+
+	for _, v := range res.Orders {
+		if err := fn(v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *ordersStorage) SaveSettings(ctx context.Context, settings domain.MarketSettings) error {
+	s.settings[settings.Market] = settings
+	return nil
+}
+
+func (s *ordersStorage) GetSettings(ctx context.Context) ([]domain.MarketSettings, error) {
+	var res []domain.MarketSettings
+
+	for _, v := range s.settings {
 		res = append(res, v)
 	}
 
 	return res, nil
 }
 
+func (s *ordersStorage) SaveCandle(ctx context.Context, candle domain.CandleRecord) error {
+	for i, v := range s.candles {
+		if v.Market == candle.Market && v.Interval == candle.Interval && v.Time.Equal(candle.Time) {
+			s.candles[i] = candle
+			return nil
+		}
+	}
+	s.candles = append(s.candles, candle)
+	return nil
+}
+
+func (s *ordersStorage) GetCandles(ctx context.Context, filter domain.CandleFilter) ([]domain.CandleRecord, error) {
+	res := make([]domain.CandleRecord, 0)
+
+	for _, v := range s.candles {
+		if filter.Market != "" && v.Market != filter.Market ||
+			filter.Interval != "" && v.Interval != filter.Interval ||
+			filter.From != nil && v.Time.Before(*filter.From) ||
+			filter.To != nil && !v.Time.Before(*filter.To) {
+			continue
+		}
+		if filter.Desc {
+			res = append([]domain.CandleRecord{v}, res...)
+		} else {
+			res = append(res, v)
+		}
+	}
+	if filter.Limit > 0 && len(res) > filter.Limit {
+		res = res[:filter.Limit]
+	}
+
+	return res, nil
+}
+
 func (s *ordersStorage) Close() {
 }
 
@@ -68,3 +143,39 @@ func NewTgMock(logger log.Logger, id int, url string) *messStorage {
 func (tg *messStorage) Notify(m domain.Market, message string) {
 	tg.mess = append(tg.mess, message)
 }
+
+// positionsMock is the robot with positions of executed orders.
+type positionsMock struct {
+	Robot
+	positions []domain.Position
+}
+
+func (r *positionsMock) Positions(ctx context.Context) []domain.Position {
+	return r.positions
+}
+
+// exchangeMock is the robot which requests to Kraken fail with err.
+type exchangeMock struct {
+	Robot
+	err error
+}
+
+func (r *exchangeMock) OpenOrders(ctx context.Context) ([]domain.OpenOrder, error) {
+	return nil, r.err
+}
+
+// exportMock is the robot which exports records and fails with err.
+type exportMock struct {
+	Robot
+	records []domain.TradeRecord
+	err     error
+}
+
+func (r *exportMock) ExportOrders(ctx context.Context, filter domain.OrderFilter, fn func(domain.TradeRecord) error) error {
+	for _, v := range r.records {
+		if err := fn(v); err != nil {
+			return err
+		}
+	}
+	return r.err
+}
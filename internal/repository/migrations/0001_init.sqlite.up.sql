@@ -0,0 +1,4 @@
+-- SQLite can't add primary key to existing table, so id of 0003 is created here.
+create table if not exists orders(id integer primary key autoincrement, ts timestamp, market text, type text, price numeric,
+    size integer, fee numeric default 0, paper boolean default false);
+create table if not exists settings(market text primary key, data text not null, updated_at timestamp not null default current_timestamp);
@@ -0,0 +1,6 @@
+-- Baseline schema, tables may already exist on deployments created with init.sql.
+create table if not exists orders(ts timestamp, market text, type text, price numeric, size numeric, fee numeric default 0, paper boolean default false);
+alter table orders
+    add column if not exists fee numeric default 0,
+    add column if not exists paper boolean default false;
+create table if not exists settings(market text primary key, data jsonb not null, updated_at timestamp not null default now());
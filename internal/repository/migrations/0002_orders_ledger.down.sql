@@ -0,0 +1,11 @@
+drop index if exists orders_outcome;
+alter table orders
+    drop column if exists trigger_id,
+    drop column if exists cli_ord_id,
+    drop column if exists order_id,
+    drop column if exists outcome,
+    drop column if exists status,
+    drop column if exists error,
+    drop column if exists trigger_price,
+    drop column if exists sent_at,
+    drop column if exists received_at;
@@ -0,0 +1,10 @@
+drop index if exists orders_outcome;
+alter table orders drop column trigger_id;
+alter table orders drop column cli_ord_id;
+alter table orders drop column order_id;
+alter table orders drop column outcome;
+alter table orders drop column status;
+alter table orders drop column error;
+alter table orders drop column trigger_price;
+alter table orders drop column sent_at;
+alter table orders drop column received_at;
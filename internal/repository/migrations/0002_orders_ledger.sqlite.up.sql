@@ -0,0 +1,10 @@
+alter table orders add column trigger_id text;
+alter table orders add column cli_ord_id text;
+alter table orders add column order_id text;
+alter table orders add column outcome text not null default 'placed';
+alter table orders add column status text;
+alter table orders add column error text;
+alter table orders add column trigger_price numeric;
+alter table orders add column sent_at timestamp;
+alter table orders add column received_at timestamp;
+create index if not exists orders_outcome on orders(outcome);
@@ -0,0 +1,11 @@
+alter table orders
+    add column if not exists trigger_id text,
+    add column if not exists cli_ord_id text,
+    add column if not exists order_id text,
+    add column if not exists outcome text not null default 'placed',
+    add column if not exists status text,
+    add column if not exists error text,
+    add column if not exists trigger_price numeric,
+    add column if not exists sent_at timestamp,
+    add column if not exists received_at timestamp;
+create index if not exists orders_outcome on orders(outcome);
@@ -0,0 +1,2 @@
+-- id is created with orders by 0001.
+select 1;
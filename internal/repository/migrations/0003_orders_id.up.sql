@@ -0,0 +1 @@
+alter table orders add column if not exists id bigserial primary key;
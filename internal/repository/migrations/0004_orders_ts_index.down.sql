@@ -0,0 +1,2 @@
+drop index if exists orders_market_ts;
+drop index if exists orders_ts_id;
@@ -0,0 +1,2 @@
+create index if not exists orders_ts_id on orders(ts, id);
+create index if not exists orders_market_ts on orders(market, ts);
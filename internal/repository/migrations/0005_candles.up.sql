@@ -0,0 +1,3 @@
+create table if not exists candles(market text not null, resolution text not null, ts timestamptz not null,
+    open numeric not null, high numeric not null, low numeric not null, close numeric not null, volume numeric not null default 0,
+    primary key (market, resolution, ts));
@@ -0,0 +1,5 @@
+alter table orders
+    drop column if exists order_type,
+    drop column if exists stop_price,
+    drop column if exists reduce_only,
+    drop column if exists trigger_signal;
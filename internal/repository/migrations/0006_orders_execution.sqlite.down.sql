@@ -0,0 +1,4 @@
+alter table orders drop column order_type;
+alter table orders drop column stop_price;
+alter table orders drop column reduce_only;
+alter table orders drop column trigger_signal;
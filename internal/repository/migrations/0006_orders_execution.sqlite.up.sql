@@ -0,0 +1,4 @@
+alter table orders add column order_type text;
+alter table orders add column stop_price numeric;
+alter table orders add column reduce_only boolean;
+alter table orders add column trigger_signal text;
@@ -0,0 +1,5 @@
+alter table orders
+    add column if not exists order_type text,
+    add column if not exists stop_price numeric,
+    add column if not exists reduce_only boolean,
+    add column if not exists trigger_signal text;
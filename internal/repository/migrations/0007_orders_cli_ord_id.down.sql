@@ -0,0 +1 @@
+drop index if exists orders_cli_ord_id;
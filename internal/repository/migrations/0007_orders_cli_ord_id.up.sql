@@ -0,0 +1,3 @@
+update orders set cli_ord_id = null where cli_ord_id = '';
+delete from orders where cli_ord_id is not null and id not in (select min(id) from orders where cli_ord_id is not null group by cli_ord_id);
+create unique index if not exists orders_cli_ord_id on orders(cli_ord_id);
@@ -0,0 +1,2 @@
+-- fee and paper belong to the baseline schema and are dropped with orders by 0001.
+select 1;
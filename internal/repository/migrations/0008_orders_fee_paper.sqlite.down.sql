@@ -0,0 +1,2 @@
+-- fee and paper are created with orders by 0001.
+select 1;
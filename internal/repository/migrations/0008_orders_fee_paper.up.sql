@@ -0,0 +1,4 @@
+-- Deployments that applied 0001 before it added fee and paper to an existing orders table.
+alter table orders
+    add column if not exists fee numeric default 0,
+    add column if not exists paper boolean default false;
@@ -0,0 +1,319 @@
+// Package migrations keeps the database schema as numbered SQL migrations
+// embedded into the binary and applies them in order.
+//
+// Every migration is a pair of files NNNN_name.up.sql and NNNN_name.down.sql.
+// Applied versions are recorded in schema_migrations table.
+//
+// Postgres and SQLite share the migrations. Postgres types and functions are
+// converted for SQLite, statements it doesn't support are replaced by
+// NNNN_name.sqlite.up.sql and NNNN_name.sqlite.down.sql of the same version.
+package migrations
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cgriceld/crypto-trade-bot/pkg/log"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+//go:embed *.sql
+var files embed.FS
+
+var (
+	WrongMigration = errors.New("Wrong migration")
+	UnknownVersion = errors.New("Database has unknown migration version")
+)
+
+// Dialect is the database migrations are loaded for.
+type Dialect string
+
+const (
+	Postgres Dialect = "postgres"
+	SQLite   Dialect = "sqlite"
+)
+
+// sqliteTypes converts Postgres types and functions of shared migrations
+// to SQLite ones.
+var sqliteTypes = strings.NewReplacer("jsonb", "text", "timestamptz", "timestamp", "now()", "current_timestamp")
+
+// lockID is the key of advisory lock which keeps concurrent runners away.
+const lockID = 7_412_893
+
+const (
+	createTable = `CREATE TABLE IF NOT EXISTS schema_migrations(version integer primary key, name text not null,
+	applied_at timestamp not null default now())`
+	getApplied = `SELECT version, applied_at FROM schema_migrations`
+	addApplied = `INSERT INTO schema_migrations(version, name) VALUES ($1, $2)`
+	delApplied = `DELETE FROM schema_migrations WHERE version = $1`
+)
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is a migration and the time it was applied, nil if it is pending.
+type Status struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+}
+
+type Migrator struct {
+	pool       *pgxpool.Pool
+	logger     log.Logger
+	migrations []Migration
+}
+
+func New(pool *pgxpool.Pool, logger log.Logger) (*Migrator, error) {
+	migrations, err := load(files, Postgres)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		pool:       pool,
+		logger:     logger,
+		migrations: migrations,
+	}, nil
+}
+
+// Load returns embedded migrations of dialect sorted by version.
+func Load(dialect Dialect) ([]Migration, error) {
+	return load(files, dialect)
+}
+
+// load reads migrations of dialect from fsys sorted by version.
+func load(fsys fs.FS, dialect Dialect) ([]Migration, error) {
+	names, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	overrides := make(map[string]string)
+	for _, file := range names {
+		base := strings.TrimSuffix(path.Base(file), ".sql")
+		dir := path.Ext(base)
+		base = strings.TrimSuffix(base, dir)
+
+		var own Dialect
+		if ext := path.Ext(base); ext != "" {
+			own = Dialect(strings.TrimPrefix(ext, "."))
+			if own != Postgres && own != SQLite {
+				return nil, fmt.Errorf("%v: %v: unknown dialect %v", WrongMigration, file, own)
+			}
+			base = strings.TrimSuffix(base, ext)
+		}
+
+		parts := strings.SplitN(base, "_", 2)
+		version, err := strconv.Atoi(parts[0])
+		if err != nil || version <= 0 || len(parts) != 2 || parts[1] == "" {
+			return nil, fmt.Errorf("%v: %v: name must be NNNN_name.up.sql or NNNN_name.down.sql", WrongMigration, file)
+		}
+
+		body, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		sql := string(body)
+		if own == "" && dialect == SQLite {
+			sql = sqliteTypes.Replace(sql)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: parts[1]}
+			byVersion[version] = m
+		}
+		if m.Name != parts[1] {
+			return nil, fmt.Errorf("%v: %v: duplicate version %v", WrongMigration, file, version)
+		}
+
+		if dir != ".up" && dir != ".down" {
+			return nil, fmt.Errorf("%v: %v: name must be NNNN_name.up.sql or NNNN_name.down.sql", WrongMigration, file)
+		}
+		switch {
+		case own == dialect:
+			overrides[fmt.Sprintf("%04d%v", version, dir)] = sql
+		case own != "":
+		case dir == ".up":
+			m.Up = sql
+		default:
+			m.Down = sql
+		}
+	}
+	for _, m := range byVersion {
+		if sql, ok := overrides[fmt.Sprintf("%04d.up", m.Version)]; ok {
+			m.Up = sql
+		}
+		if sql, ok := overrides[fmt.Sprintf("%04d.down", m.Version)]; ok {
+			m.Down = sql
+		}
+	}
+
+	var res []Migration
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("%v: %04d_%v: both up and down are required", WrongMigration, m.Version, m.Name)
+		}
+		res = append(res, *m)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Version < res[j].Version })
+
+	return res, nil
+}
+
+// Up applies all pending migrations and returns the number of applied ones.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	var count int
+
+	err := m.locked(ctx, func(conn *pgxpool.Conn, applied map[int]time.Time) error {
+		for _, v := range m.migrations {
+			if _, ok := applied[v.Version]; ok {
+				continue
+			}
+
+			if err := m.apply(ctx, conn, v.Up, addApplied, v.Version, v.Name); err != nil {
+				return fmt.Errorf("%04d_%v: %v", v.Version, v.Name, err)
+			}
+			m.logger.Infof("Migration %04d_%v applied", v.Version, v.Name)
+			count++
+		}
+		return nil
+	})
+
+	return count, err
+}
+
+// Down rolls back steps last applied migrations.
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	var count int
+
+	err := m.locked(ctx, func(conn *pgxpool.Conn, applied map[int]time.Time) error {
+		for i := len(m.migrations) - 1; i >= 0 && count < steps; i-- {
+			v := m.migrations[i]
+			if _, ok := applied[v.Version]; !ok {
+				continue
+			}
+
+			if err := m.apply(ctx, conn, v.Down, delApplied, v.Version); err != nil {
+				return fmt.Errorf("%04d_%v: %v", v.Version, v.Name, err)
+			}
+			m.logger.Infof("Migration %04d_%v rolled back", v.Version, v.Name)
+			count++
+		}
+		return nil
+	})
+
+	return count, err
+}
+
+// Status returns all known migrations with the time they were applied.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var res []Status
+
+	err := m.locked(ctx, func(conn *pgxpool.Conn, applied map[int]time.Time) error {
+		for _, v := range m.migrations {
+			s := Status{Version: v.Version, Name: v.Name}
+			if ts, ok := applied[v.Version]; ok {
+				s.AppliedAt = &ts
+			}
+			res = append(res, s)
+		}
+		return nil
+	})
+
+	return res, err
+}
+
+// locked runs fn holding advisory lock with versions applied to database.
+func (m *Migrator) locked(ctx context.Context, fn func(conn *pgxpool.Conn, applied map[int]time.Time) error) error {
+	conn, err := m.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if _, err = conn.Exec(ctx, "SELECT pg_advisory_lock($1)", lockID); err != nil {
+		return err
+	}
+	defer func() {
+		if _, err := conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", lockID); err != nil {
+			m.logger.Errorf("Fail to release migrations lock: %v", err)
+		}
+	}()
+
+	if _, err = conn.Exec(ctx, createTable); err != nil {
+		return err
+	}
+
+	applied, err := m.applied(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	return fn(conn, applied)
+}
+
+func (m *Migrator) applied(ctx context.Context, conn *pgxpool.Conn) (map[int]time.Time, error) {
+	rows, err := conn.Query(ctx, getApplied)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	known := make(map[int]bool)
+	for _, v := range m.migrations {
+		known[v.Version] = true
+	}
+
+	res := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var ts time.Time
+		if err = rows.Scan(&version, &ts); err != nil {
+			return nil, err
+		}
+		if !known[version] {
+			return nil, fmt.Errorf("%v: %v", UnknownVersion, version)
+		}
+		res[version] = ts
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// apply runs migration sql and records it with query in one transaction.
+func (m *Migrator) apply(ctx context.Context, conn *pgxpool.Conn, sql, query string, args ...interface{}) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if _, err = tx.Exec(ctx, sql); err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec(ctx, query, args...); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,83 @@
+package migrations
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type LoadFiles struct {
+	name    string
+	dialect Dialect
+	files   fstest.MapFS
+	res     []Migration
+	err     error
+}
+
+func file(s string) *fstest.MapFile {
+	return &fstest.MapFile{Data: []byte(s)}
+}
+
+func TestLoad(t *testing.T) {
+	tests := []LoadFiles{
+		{"Sorted", Postgres, fstest.MapFS{
+			"0002_b.up.sql":   file("up b"),
+			"0002_b.down.sql": file("down b"),
+			"0001_a.up.sql":   file("up a"),
+			"0001_a.down.sql": file("down a"),
+		}, []Migration{{1, "a", "up a", "down a"}, {2, "b", "up b", "down b"}}, nil},
+		{"No down", Postgres, fstest.MapFS{
+			"0001_a.up.sql": file("up a"),
+		}, nil, errors.New("Wrong migration: 0001_a: both up and down are required")},
+		{"Duplicate version", Postgres, fstest.MapFS{
+			"0001_a.up.sql":   file("up a"),
+			"0001_a.down.sql": file("down a"),
+			"0001_b.up.sql":   file("up b"),
+		}, nil, errors.New("Wrong migration: 0001_b.up.sql: duplicate version 1")},
+		{"No version", Postgres, fstest.MapFS{
+			"init.up.sql": file("up"),
+		}, nil, errors.New("Wrong migration: init.up.sql: name must be NNNN_name.up.sql or NNNN_name.down.sql")},
+		{"No direction", Postgres, fstest.MapFS{
+			"0001_a.sql": file("up"),
+		}, nil, errors.New("Wrong migration: 0001_a.sql: name must be NNNN_name.up.sql or NNNN_name.down.sql")},
+		{"Postgres skips SQLite", Postgres, fstest.MapFS{
+			"0001_a.up.sql":          file("create table a(data jsonb, ts timestamptz default now())"),
+			"0001_a.down.sql":        file("drop table a"),
+			"0001_a.sqlite.down.sql": file("drop table if exists a"),
+		}, []Migration{{1, "a", "create table a(data jsonb, ts timestamptz default now())", "drop table a"}}, nil},
+		{"SQLite", SQLite, fstest.MapFS{
+			"0001_a.up.sql":          file("create table a(data jsonb, ts timestamptz default now())"),
+			"0001_a.down.sql":        file("drop table a"),
+			"0001_a.sqlite.down.sql": file("drop table if exists a"),
+		}, []Migration{{1, "a", "create table a(data text, ts timestamp default current_timestamp)", "drop table if exists a"}}, nil},
+		{"Unknown dialect", Postgres, fstest.MapFS{
+			"0001_a.mysql.up.sql": file("up"),
+		}, nil, errors.New("Wrong migration: 0001_a.mysql.up.sql: unknown dialect mysql")},
+	}
+
+	for _, test := range tests {
+		res, err := load(test.files, test.dialect)
+
+		if !assert.Equal(t, test.err, err, "%v: Expect: %v, Got: %v", test.name, test.err, err) ||
+			!assert.Equal(t, test.res, res, "%v: Expect: %v, Got: %v", test.name, test.res, res) {
+			t.Fatal()
+		}
+	}
+}
+
+func TestEmbedded(t *testing.T) {
+	for _, dialect := range []Dialect{Postgres, SQLite} {
+		res, err := load(files, dialect)
+		if !assert.NoError(t, err, dialect) {
+			t.Fatal()
+		}
+
+		for i, m := range res {
+			if !assert.Equal(t, i+1, m.Version, "%v: %04d_%v: versions must have no gaps", dialect, m.Version, m.Name) {
+				t.Fatal()
+			}
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package queries
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/cgriceld/crypto-trade-bot/internal/domain"
+)
+
+// saveCandle keeps the last update of candle, Kraken sends the current candle
+// until its interval is over.
+const saveCandle = `INSERT INTO candles(market, resolution, ts, open, high, low, close, volume)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	ON CONFLICT (market, resolution, ts) DO UPDATE SET open = EXCLUDED.open, high = EXCLUDED.high,
+	low = EXCLUDED.low, close = EXCLUDED.close, volume = EXCLUDED.volume`
+
+func (q *Queries) SaveCandle(ctx context.Context, candle domain.CandleRecord) error {
+	_, err := q.pool.Exec(ctx, saveCandle, candleArgs(candle)...)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func candleArgs(c domain.CandleRecord) []interface{} {
+	return []interface{}{c.Market, c.Interval, c.Time, c.Open, c.High, c.Low, c.Close, c.Volume}
+}
+
+const getCandles = `SELECT market, resolution, ts, open, high, low, close, volume FROM candles`
+
+// GetCandles returns candles selected by filter, see domain.CandleFilter.
+func (q *Queries) GetCandles(ctx context.Context, filter domain.CandleFilter) ([]domain.CandleRecord, error) {
+	query, args := candlesQuery(filter)
+
+	rows, err := q.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanCandles(rows)
+}
+
+func scanCandles(rows rows) ([]domain.CandleRecord, error) {
+	res := make([]domain.CandleRecord, 0)
+	for rows.Next() {
+		var c domain.CandleRecord
+		err := rows.Scan(&c.Market, &c.Interval, &c.Time, &c.Open, &c.High, &c.Low, &c.Close, &c.Volume)
+		if err != nil {
+			return nil, err
+		}
+		c.Time = c.Time.UTC()
+		res = append(res, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// candlesQuery builds select of candles with WHERE, ORDER BY and LIMIT clauses
+// of filter.
+func candlesQuery(filter domain.CandleFilter) (string, []interface{}) {
+	var where []string
+	var args []interface{}
+
+	add := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		where = append(where, strings.ReplaceAll(cond, "?", fmt.Sprintf("$%d", len(args))))
+	}
+
+	if filter.Market != "" {
+		add("market = ?", filter.Market)
+	}
+	if filter.Interval != "" {
+		add("resolution = ?", filter.Interval)
+	}
+	if filter.From != nil {
+		add("ts >= ?", filter.From.UTC())
+	}
+	if filter.To != nil {
+		add("ts < ?", filter.To.UTC())
+	}
+
+	limit := filter.Limit
+	if limit <= 0 || limit > domain.MaxCandlesLimit {
+		limit = domain.DefaultCandlesLimit
+	}
+	order := "ASC"
+	if filter.Desc {
+		order = "DESC"
+	}
+
+	query := getCandles
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	args = append(args, limit)
+	query += fmt.Sprintf(" ORDER BY ts %v, market, resolution LIMIT $%d", order, len(args))
+
+	return query, args
+}
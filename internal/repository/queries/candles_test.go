@@ -0,0 +1,57 @@
+package queries
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cgriceld/crypto-trade-bot/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCandlesQuery(t *testing.T) {
+	from := time.Date(2021, 12, 1, 3, 0, 0, 0, time.FixedZone("MSK", 3*60*60))
+	utc := from.UTC()
+
+	tests := []struct {
+		name   string
+		filter domain.CandleFilter
+		where  string
+		args   []interface{}
+	}{
+		{"All", domain.CandleFilter{}, " ORDER BY ts ASC, market, resolution LIMIT $1",
+			[]interface{}{domain.DefaultCandlesLimit}},
+		{"Market and time range", domain.CandleFilter{Market: "pi_xbtusd", Interval: "1m", From: &from, To: &from, Limit: 10},
+			" WHERE market = $1 AND resolution = $2 AND ts >= $3 AND ts < $4 ORDER BY ts ASC, market, resolution LIMIT $5",
+			[]interface{}{"pi_xbtusd", "1m", utc, utc, 10}},
+		{"Last candles", domain.CandleFilter{Market: "pi_xbtusd", Limit: domain.MaxCandlesLimit + 1, Desc: true},
+			" WHERE market = $1 ORDER BY ts DESC, market, resolution LIMIT $2",
+			[]interface{}{"pi_xbtusd", domain.DefaultCandlesLimit}},
+	}
+
+	for _, test := range tests {
+		query, args := candlesQuery(test.filter)
+
+		if !assert.Equal(t, getCandles+test.where, query, "%v: Expect: %v, Got: %v", test.name, test.where, query) ||
+			!assert.Equal(t, test.args, args, "%v: Expect: %v, Got: %v", test.name, test.args, args) {
+			t.Fatal()
+		}
+	}
+}
+
+func TestCandleRecord(t *testing.T) {
+	c := domain.Candle{Open: "56980.5", High: "57010", Low: "56900", Close: "57000.5", Time: 1638363600000, Volume: 12}
+
+	rec, err := domain.NewCandleRecord("pi_xbtusd", "1m", c)
+	if !assert.NoError(t, err) ||
+		!assert.Equal(t, time.Date(2021, 12, 1, 13, 0, 0, 0, time.UTC), rec.Time) ||
+		!assert.Equal(t, 57000.5, rec.Close) || !assert.Equal(t, c, rec.Candle()) {
+		t.Fatal()
+	}
+
+	c.Close = "x"
+	_, err = domain.NewCandleRecord("pi_xbtusd", "1m", c)
+	if !assert.Error(t, err) {
+		t.Fatal()
+	}
+}
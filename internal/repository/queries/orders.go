@@ -2,14 +2,20 @@ package queries
 
 import (
 	"context"
+	"fmt"
+	"strings"
 
 	"github.com/cgriceld/crypto-trade-bot/internal/domain"
 )
 
-const saveOrder = `INSERT INTO orders(ts, market, type, price, size) VALUES ($1, $2, $3, $4, $5)`
+const saveOrder = `INSERT INTO orders(ts, trigger_id, market, type, price, size, fee, paper,
+	cli_ord_id, order_id, outcome, status, error, trigger_price, sent_at, received_at,
+	order_type, stop_price, reduce_only, trigger_signal)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20)
+	ON CONFLICT (cli_ord_id) DO NOTHING`
 
-func (q *Queries) SaveOrder(order domain.Order) error {
-	_, err := q.pool.Exec(context.Background(), saveOrder, order.Time, order.Market, order.Typ, order.Price, order.Size)
+func (q *Queries) SaveOrder(ctx context.Context, order domain.Order) error {
+	_, err := q.pool.Exec(ctx, saveOrder, orderArgs(order)...)
 	if err != nil {
 		return err
 	}
@@ -17,27 +23,159 @@ func (q *Queries) SaveOrder(order domain.Order) error {
 	return nil
 }
 
-const getOrders = `SELECT ts, market, type, price, size FROM orders`
+// orderArgs are saveOrder arguments. Every order sent by the robot, paper ones
+// included, has its own cliOrdId, so replayed orders are saved once. Orders
+// without it (saved before cliOrdId was recorded) get NULL, so that they are
+// not deduplicated.
+func orderArgs(order domain.Order) []interface{} {
+	var cliOrdID interface{}
+	if order.ClientID != "" {
+		cliOrdID = order.ClientID
+	}
+
+	return []interface{}{order.Time, order.ID, order.Market, order.Typ, order.Price, order.Size, order.Fee, order.Paper,
+		cliOrdID, order.OrderID, order.Outcome, order.Status, order.Error, order.TriggerPrice, order.SentAt, order.ReceivedAt,
+		order.OrderType, order.StopPrice, order.ReduceOnly, order.TriggerSignal}
+}
+
+const getOrders = `SELECT id, ts, COALESCE(trigger_id, ''), market, type, price, size, COALESCE(fee, 0), COALESCE(paper, false),
+	COALESCE(cli_ord_id, ''), COALESCE(order_id, ''), COALESCE(outcome, 'placed'), COALESCE(status, ''), COALESCE(error, ''),
+	COALESCE(trigger_price, 0), sent_at, received_at,
+	COALESCE(order_type, ''), COALESCE(stop_price, 0), COALESCE(reduce_only, false), COALESCE(trigger_signal, '')
+	FROM orders`
 
-func (q *Queries) GetOrders(ctx context.Context) ([]domain.Order, error) {
-	rows, err := q.pool.Query(ctx, getOrders)
+// GetOrders returns a page of orders selected by filter, see domain.OrderFilter.
+func (q *Queries) GetOrders(ctx context.Context, filter domain.OrderFilter) (*domain.OrdersResp, error) {
+	query, args, limit := pageQuery(filter)
+
+	rows, err := q.pool.Query(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var orders []domain.Order
+	orders := make([]domain.Order, 0)
+	err = scanOrders(rows, func(o domain.Order) error {
+		orders = append(orders, o)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return page(orders, limit), nil
+}
+
+// pageQuery builds select of orders page, one more order is selected to tell
+// whether there is the next page.
+func pageQuery(filter domain.OrderFilter) (string, []interface{}, int) {
+	limit := filter.Limit
+	if limit <= 0 || limit > domain.MaxOrdersLimit {
+		limit = domain.DefaultOrdersLimit
+	}
+
+	query, args := ordersQuery(filter)
+	args = append(args, limit+1)
+	query += fmt.Sprintf(" LIMIT $%d", len(args))
+
+	return query, args, limit
+}
+
+// page cuts orders selected by pageQuery to limit and points cursor to the last one.
+func page(orders []domain.Order, limit int) *domain.OrdersResp {
+	res := &domain.OrdersResp{Orders: orders}
+	if len(orders) > limit {
+		res.Orders = orders[:limit]
+		last := res.Orders[limit-1]
+		if last.Time != nil {
+			res.NextCursor = domain.Cursor{Time: *last.Time, RowID: last.RowID}.String()
+		}
+	}
+
+	return res
+}
+
+// EachOrder passes all orders selected by filter to fn one by one as they are
+// read from the database, Limit and Cursor are ignored. Iteration stops at the
+// first error of fn.
+func (q *Queries) EachOrder(ctx context.Context, filter domain.OrderFilter, fn func(domain.Order) error) error {
+	filter.Cursor = nil
+	query, args := ordersQuery(filter)
+
+	rows, err := q.pool.Query(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	return scanOrders(rows, fn)
+}
+
+// rows are rows of pgx and database/sql.
+type rows interface {
+	Next() bool
+	Scan(dest ...interface{}) error
+	Err() error
+}
+
+func scanOrders(rows rows, fn func(domain.Order) error) error {
 	for rows.Next() {
 		var o domain.Order
-		err = rows.Scan(&o.Time, &o.Market, &o.Typ, &o.Price, &o.Size)
+		err := rows.Scan(&o.RowID, &o.Time, &o.ID, &o.Market, &o.Typ, &o.Price, &o.Size, &o.Fee, &o.Paper,
+			&o.ClientID, &o.OrderID, &o.Outcome, &o.Status, &o.Error, &o.TriggerPrice, &o.SentAt, &o.ReceivedAt,
+			&o.OrderType, &o.StopPrice, &o.ReduceOnly, &o.TriggerSignal)
 		if err != nil {
-			return nil, err
+			return err
+		}
+		if err = fn(o); err != nil {
+			return err
 		}
-		orders = append(orders, o)
 	}
-	if err = rows.Err(); err != nil {
-		return nil, err
+
+	return rows.Err()
+}
+
+// ordersQuery builds select of orders with WHERE and ORDER BY clauses of filter.
+func ordersQuery(filter domain.OrderFilter) (string, []interface{}) {
+	var where []string
+	var args []interface{}
+
+	add := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		where = append(where, strings.ReplaceAll(cond, "?", fmt.Sprintf("$%d", len(args))))
+	}
+
+	if filter.Outcome != "" {
+		add("COALESCE(outcome, 'placed') = ?", filter.Outcome)
+	}
+	if filter.Market != "" {
+		add("market = ?", filter.Market)
+	}
+	if filter.Side != "" {
+		add("type = ?", filter.Side)
+	}
+	// ts is stored as local time without time zone
+	if filter.From != nil {
+		add("ts >= ?", filter.From.Local())
+	}
+	if filter.To != nil {
+		add("ts < ?", filter.To.Local())
+	}
+
+	op, order := ">", "ASC"
+	if filter.Desc {
+		op, order = "<", "DESC"
+	}
+	if filter.Cursor != nil {
+		args = append(args, filter.Cursor.Time, filter.Cursor.RowID)
+		where = append(where, fmt.Sprintf("(ts, id) %v ($%d, $%d)", op, len(args)-1, len(args)))
+	}
+
+	query := getOrders
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
 	}
+	query += fmt.Sprintf(" ORDER BY ts %v, id %v", order, order)
 
-	return orders, nil
+	return query, args
 }
@@ -0,0 +1,58 @@
+package queries
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cgriceld/crypto-trade-bot/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type Query struct {
+	name   string
+	filter domain.OrderFilter
+	where  string
+	args   []interface{}
+}
+
+func TestOrdersQuery(t *testing.T) {
+	from := time.Date(2021, 12, 1, 0, 0, 0, 0, time.Local)
+	cursor, _ := domain.ParseCursor(domain.Cursor{Time: time.Date(2021, 12, 1, 13, 37, 37, 278283000, time.UTC), RowID: 42}.String())
+
+	tests := []Query{
+		{"All", domain.OrderFilter{}, " ORDER BY ts ASC, id ASC", nil},
+		{"Outcome and market", domain.OrderFilter{Outcome: "placed", Market: "pi_xbtusd"},
+			" WHERE COALESCE(outcome, 'placed') = $1 AND market = $2 ORDER BY ts ASC, id ASC",
+			[]interface{}{"placed", "pi_xbtusd"}},
+		{"Side and time range", domain.OrderFilter{Side: "buy", From: &from, To: &from},
+			" WHERE type = $1 AND ts >= $2 AND ts < $3 ORDER BY ts ASC, id ASC",
+			[]interface{}{"buy", from, from}},
+		{"Next page", domain.OrderFilter{Market: "pi_xbtusd", Cursor: cursor, Desc: true},
+			" WHERE market = $1 AND (ts, id) < ($2, $3) ORDER BY ts DESC, id DESC",
+			[]interface{}{"pi_xbtusd", cursor.Time, int64(42)}},
+	}
+
+	for _, test := range tests {
+		query, args := ordersQuery(test.filter)
+
+		if !assert.Equal(t, getOrders+test.where, query, "%v: Expect: %v, Got: %v", test.name, test.where, query) ||
+			!assert.Equal(t, test.args, args, "%v: Expect: %v, Got: %v", test.name, test.args, args) {
+			t.Fatal()
+		}
+	}
+}
+
+func TestCursor(t *testing.T) {
+	c := domain.Cursor{Time: time.Date(2021, 12, 1, 13, 37, 37, 278283000, time.UTC), RowID: 42}
+
+	res, err := domain.ParseCursor(c.String())
+	if !assert.NoError(t, err) || !assert.Equal(t, &c, res) {
+		t.Fatal()
+	}
+
+	_, err = domain.ParseCursor("xyz")
+	if !assert.Error(t, err) {
+		t.Fatal()
+	}
+}
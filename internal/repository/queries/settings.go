@@ -0,0 +1,58 @@
+package queries
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/cgriceld/crypto-trade-bot/internal/domain"
+)
+
+const saveSettings = `INSERT INTO settings(market, data, updated_at) VALUES ($1, $2, now())
+	ON CONFLICT (market) DO UPDATE SET data = EXCLUDED.data, updated_at = EXCLUDED.updated_at`
+
+func (q *Queries) SaveSettings(ctx context.Context, settings domain.MarketSettings) error {
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.pool.Exec(ctx, saveSettings, settings.Market, data)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+const getSettings = `SELECT data FROM settings ORDER BY market`
+
+func (q *Queries) GetSettings(ctx context.Context) ([]domain.MarketSettings, error) {
+	rows, err := q.pool.Query(ctx, getSettings)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanSettings(rows)
+}
+
+func scanSettings(rows rows) ([]domain.MarketSettings, error) {
+	var res []domain.MarketSettings
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+
+		var s domain.MarketSettings
+		if err := json.Unmarshal(data, &s); err != nil {
+			return nil, err
+		}
+		res = append(res, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
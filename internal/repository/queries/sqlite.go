@@ -0,0 +1,136 @@
+package queries
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/cgriceld/crypto-trade-bot/internal/domain"
+)
+
+// SQLite runs the same queries as Queries on SQLite database. Times are stored
+// in UTC, so that they are compared as text in the right order.
+type SQLite struct {
+	db *sql.DB
+}
+
+func NewSQLite(db *sql.DB) *SQLite {
+	return &SQLite{db: db}
+}
+
+// sqlite converts Postgres query and its arguments to SQLite: $n becomes ?n.
+func sqlite(query string, args []interface{}) (string, []interface{}) {
+	for i, v := range args {
+		switch t := v.(type) {
+		case time.Time:
+			args[i] = t.UTC()
+		case *time.Time:
+			if t != nil {
+				args[i] = t.UTC()
+			}
+		}
+	}
+
+	return strings.ReplaceAll(query, "$", "?"), args
+}
+
+// utc returns order read from SQLite with times in UTC, the driver parses
+// them in the local zone.
+func utc(o domain.Order) domain.Order {
+	for _, t := range []**time.Time{&o.Time, &o.SentAt, &o.ReceivedAt} {
+		if *t != nil {
+			v := (*t).UTC()
+			*t = &v
+		}
+	}
+
+	return o
+}
+
+func (q *SQLite) SaveOrder(ctx context.Context, order domain.Order) error {
+	query, args := sqlite(saveOrder, orderArgs(order))
+
+	_, err := q.db.ExecContext(ctx, query, args...)
+	return err
+}
+
+func (q *SQLite) GetOrders(ctx context.Context, filter domain.OrderFilter) (*domain.OrdersResp, error) {
+	query, args, limit := pageQuery(filter)
+	query, args = sqlite(query, args)
+
+	rows, err := q.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orders := make([]domain.Order, 0)
+	err = scanOrders(rows, func(o domain.Order) error {
+		orders = append(orders, utc(o))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return page(orders, limit), nil
+}
+
+func (q *SQLite) EachOrder(ctx context.Context, filter domain.OrderFilter, fn func(domain.Order) error) error {
+	filter.Cursor = nil
+	query, args := sqlite(ordersQuery(filter))
+
+	rows, err := q.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	return scanOrders(rows, func(o domain.Order) error {
+		return fn(utc(o))
+	})
+}
+
+func (q *SQLite) SaveCandle(ctx context.Context, candle domain.CandleRecord) error {
+	query, args := sqlite(saveCandle, candleArgs(candle))
+
+	_, err := q.db.ExecContext(ctx, query, args...)
+	return err
+}
+
+func (q *SQLite) GetCandles(ctx context.Context, filter domain.CandleFilter) ([]domain.CandleRecord, error) {
+	query, args := sqlite(candlesQuery(filter))
+
+	rows, err := q.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanCandles(rows)
+}
+
+const saveSettingsSQLite = `INSERT INTO settings(market, data, updated_at) VALUES (?1, ?2, CURRENT_TIMESTAMP)
+	ON CONFLICT (market) DO UPDATE SET data = excluded.data, updated_at = excluded.updated_at`
+
+func (q *SQLite) SaveSettings(ctx context.Context, settings domain.MarketSettings) error {
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.db.ExecContext(ctx, saveSettingsSQLite, settings.Market, string(data))
+	return err
+}
+
+func (q *SQLite) GetSettings(ctx context.Context) ([]domain.MarketSettings, error) {
+	rows, err := q.db.QueryContext(ctx, getSettings)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanSettings(rows)
+}
@@ -3,10 +3,13 @@ package repository
 import (
 	"context"
 	"github.com/cgriceld/crypto-trade-bot/internal/domain"
+	"github.com/cgriceld/crypto-trade-bot/internal/repository/migrations"
 	"github.com/cgriceld/crypto-trade-bot/internal/repository/queries"
 	"github.com/cgriceld/crypto-trade-bot/pkg/log"
+	pgs "github.com/cgriceld/crypto-trade-bot/pkg/postgres"
 
 	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/sirupsen/logrus"
 )
 
 type repo struct {
@@ -23,14 +26,58 @@ func New(pool *pgxpool.Pool, logger log.Logger) *repo {
 	}
 }
 
+// Open connects to the database of dsn: SQLite for sqlite:// scheme, Postgres
+// otherwise. Schema is migrated to the latest version.
+func Open(ctx context.Context, l logrus.FieldLogger, logger log.Logger, dsn string) (Repository, error) {
+	if IsSQLite(dsn) {
+		return NewSQLite(ctx, dsn, logger)
+	}
+
+	pool, err := pgs.NewPool(l, dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	migrator, err := migrations.New(pool, logger)
+	if err == nil {
+		_, err = migrator.Up(ctx)
+	}
+	if err != nil {
+		pool.Close()
+		return nil, err
+	}
+
+	return New(pool, logger), nil
+}
+
 func (r *repo) Close() {
 	r.pool.Close()
 }
 
-func (r *repo) SaveOrder(order domain.Order) {
-	_ = r.Queries.SaveOrder(order)
+func (r *repo) SaveOrder(ctx context.Context, order domain.Order) error {
+	return r.Queries.SaveOrder(ctx, order)
+}
+
+func (r *repo) SaveSettings(ctx context.Context, settings domain.MarketSettings) error {
+	return r.Queries.SaveSettings(ctx, settings)
+}
+
+func (r *repo) GetSettings(ctx context.Context) ([]domain.MarketSettings, error) {
+	return r.Queries.GetSettings(ctx)
+}
+
+func (r *repo) EachOrder(ctx context.Context, filter domain.OrderFilter, fn func(domain.Order) error) error {
+	return r.Queries.EachOrder(ctx, filter, fn)
+}
+
+func (r *repo) GetOrders(ctx context.Context, filter domain.OrderFilter) (*domain.OrdersResp, error) {
+	return r.Queries.GetOrders(ctx, filter)
+}
+
+func (r *repo) SaveCandle(ctx context.Context, candle domain.CandleRecord) error {
+	return r.Queries.SaveCandle(ctx, candle)
 }
 
-func (r *repo) GetOrders(ctx context.Context) ([]domain.Order, error) {
-	return r.Queries.GetOrders(ctx)
+func (r *repo) GetCandles(ctx context.Context, filter domain.CandleFilter) ([]domain.CandleRecord, error) {
+	return r.Queries.GetCandles(ctx, filter)
 }
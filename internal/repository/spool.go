@@ -0,0 +1,410 @@
+package repository
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/cgriceld/crypto-trade-bot/internal/domain"
+	"github.com/cgriceld/crypto-trade-bot/pkg/log"
+
+	"github.com/jackc/pgconn"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+const (
+	SpoolBot  = "⚠️ Database is unavailable, writes are spooled"
+	ReplayBot = "✅ Spooled writes are saved to database"
+	RejectBot = "❌ Spooled writes are rejected by database"
+)
+
+// writeTimeout limits a write to database, so that an outage doesn't hang
+// the robot.
+const writeTimeout = 5 * time.Second
+
+// maxAttempts is the number of replays rejected by database after which a
+// spooled write is moved to the rejected file, so that it doesn't block the
+// spool forever.
+const maxAttempts = 3
+
+var (
+	FailSpool = errors.New("Fail to spool write")
+)
+
+type Repository interface {
+	SaveOrder(ctx context.Context, order domain.Order) error
+	GetOrders(ctx context.Context, filter domain.OrderFilter) (*domain.OrdersResp, error)
+	EachOrder(ctx context.Context, filter domain.OrderFilter, fn func(domain.Order) error) error
+	SaveSettings(ctx context.Context, settings domain.MarketSettings) error
+	GetSettings(ctx context.Context) ([]domain.MarketSettings, error)
+	SaveCandle(ctx context.Context, candle domain.CandleRecord) error
+	GetCandles(ctx context.Context, filter domain.CandleFilter) ([]domain.CandleRecord, error)
+	Close()
+}
+
+type Notifications interface {
+	Notify(m domain.Market, message string)
+}
+
+// entry is a write kept in spool file, one JSON per line.
+type entry struct {
+	Order    *domain.Order          `json:"order,omitempty"`
+	Settings *domain.MarketSettings `json:"settings,omitempty"`
+	Attempts int                    `json:"attempts,omitempty"`
+}
+
+// Spool is a repository which appends writes failed in the wrapped one to
+// an append-only file and replays them in the same order when the database
+// recovers. While the spool is not empty new writes are spooled as well, so
+// that they are not saved before the older ones. Only writes failed because of
+// unavailable database are spooled, the ones rejected by it (e.g. constraint
+// violation) are not retried forever.
+type Spool struct {
+	Repository
+	path    string
+	logger  log.Logger
+	notify  Notifications
+	mux     sync.Mutex
+	file    *os.File
+	pending int
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// NewSpool opens spool file at path and replays it every interval. Writes left
+// in the file since the previous run are replayed too.
+func NewSpool(r Repository, path string, every time.Duration, logger log.Logger, notify Notifications) (*Spool, error) {
+	s := &Spool{
+		Repository: r,
+		path:       path,
+		logger:     logger,
+		notify:     notify,
+		done:       make(chan struct{}),
+	}
+
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	entries, err := s.read()
+	if err != nil {
+		s.file.Close()
+		return nil, err
+	}
+	s.pending = len(entries)
+	if s.pending > 0 {
+		s.logger.Warnf("Spool: %v writes left in %v", s.pending, s.path)
+		s.notify.Notify("", fmt.Sprintf("%v: %v writes in %v", SpoolBot, s.pending, s.path))
+	}
+
+	ticker := time.NewTicker(every)
+	s.wg.Add(1)
+	go func() {
+		defer func() {
+			ticker.Stop()
+			s.wg.Done()
+		}()
+		for {
+			select {
+			case <-s.done:
+				return
+			case <-ticker.C:
+				s.replay()
+			}
+		}
+	}()
+
+	return s, nil
+}
+
+func (s *Spool) SaveOrder(ctx context.Context, order domain.Order) error {
+	return s.write(ctx, entry{Order: &order})
+}
+
+func (s *Spool) SaveSettings(ctx context.Context, settings domain.MarketSettings) error {
+	return s.write(ctx, entry{Settings: &settings})
+}
+
+// SaveCandle isn't spooled: candle history can be fetched from Kraken again,
+// and a candle is saved every interval of every running market.
+func (s *Spool) SaveCandle(ctx context.Context, candle domain.CandleRecord) error {
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+
+	return s.Repository.SaveCandle(ctx, candle)
+}
+
+// Pending returns the number of spooled writes.
+func (s *Spool) Pending() int {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.pending
+}
+
+// Close stops replaying, tries to replay the spool for the last time and
+// closes the wrapped repository.
+func (s *Spool) Close() {
+	close(s.done)
+	s.wg.Wait()
+
+	s.replay()
+
+	s.mux.Lock()
+	if err := s.file.Close(); err != nil {
+		s.logger.Errorf("Spool: %v", err)
+	}
+	s.mux.Unlock()
+
+	s.Repository.Close()
+}
+
+// write saves e to database or, if it is unavailable or the spool is not
+// empty, to the spool. Error is returned if the write is rejected by database
+// or lost.
+func (s *Spool) write(ctx context.Context, e entry) error {
+	s.mux.Lock()
+
+	if s.pending == 0 {
+		err := s.apply(ctx, e)
+		if err == nil {
+			s.mux.Unlock()
+			return nil
+		}
+		if !transient(err) {
+			s.mux.Unlock()
+			return err
+		}
+		s.logger.Errorf("Spool: fail to write to database: %v", err)
+	}
+
+	err := s.append(e)
+	if err == nil {
+		s.pending++
+	}
+	pending := s.pending
+	s.mux.Unlock()
+
+	if err != nil {
+		return fmt.Errorf("%v: %v", FailSpool, err)
+	}
+	if pending == 1 {
+		s.notify.Notify("", fmt.Sprintf("%v: %v writes in %v", SpoolBot, pending, s.path))
+	}
+
+	return nil
+}
+
+func (s *Spool) apply(ctx context.Context, e entry) error {
+	ctx, cancel := context.WithTimeout(ctx, writeTimeout)
+	defer cancel()
+
+	if e.Order != nil {
+		return s.Repository.SaveOrder(ctx, *e.Order)
+	}
+	if e.Settings != nil {
+		return s.Repository.SaveSettings(ctx, *e.Settings)
+	}
+
+	return nil
+}
+
+// transient reports whether err may go away by itself: connection failures,
+// timeouts, server shutdown or lack of resources. Errors of the write itself
+// are permanent.
+func transient(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code[:2] {
+		case "08", "40", "53", "57", "58":
+			return true
+		}
+		return false
+	}
+
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		// extended result codes keep the primary one in the low byte
+		code := sqliteErr.Code() & 0xff
+		return code == sqlite3.SQLITE_BUSY || code == sqlite3.SQLITE_LOCKED
+	}
+
+	return true
+}
+
+// replay saves spooled writes to database in order and removes saved ones
+// from the spool. A write rejected by database maxAttempts times is moved to
+// the rejected file.
+func (s *Spool) replay() {
+	s.mux.Lock()
+	if s.pending == 0 {
+		s.mux.Unlock()
+		return
+	}
+
+	entries, err := s.read()
+	if err != nil {
+		s.mux.Unlock()
+		s.logger.Errorf("Spool: %v", err)
+		return
+	}
+
+	var saved, rejected, i int
+	var attempted bool
+	for ; i < len(entries); i++ {
+		if err = s.apply(context.Background(), entries[i]); err == nil {
+			saved++
+			continue
+		}
+		if transient(err) {
+			break
+		}
+		if entries[i].Attempts++; entries[i].Attempts < maxAttempts {
+			s.logger.Errorf("Spool: write is rejected by database, attempt %v of %v: %v", entries[i].Attempts, maxAttempts, err)
+			attempted = true
+			break
+		}
+		if err := s.reject(entries[i]); err != nil {
+			s.logger.Errorf("Spool: %v", err)
+			break
+		}
+		s.logger.Errorf("Spool: write is rejected by database %v times, moved to %v: %v", maxAttempts, s.rejectedPath(), err)
+		rejected++
+	}
+	// saved writes stay in the spool if it is not rewritten, replaying them
+	// again is harmless as orders are deduplicated by cliOrdId
+	if i > 0 || attempted || len(entries) == 0 {
+		if err := s.rewrite(entries[i:]); err != nil {
+			s.logger.Errorf("Spool: %v", err)
+		} else {
+			s.pending = len(entries) - i
+		}
+	} else {
+		s.pending = len(entries)
+	}
+	pending := s.pending
+	s.mux.Unlock()
+
+	if rejected > 0 {
+		s.notify.Notify("", fmt.Sprintf("%v: %v writes moved to %v", RejectBot, rejected, s.rejectedPath()))
+	}
+	if saved == 0 {
+		return
+	}
+	s.logger.Infof("Spool: %v writes replayed, %v left", saved, pending)
+	if pending == 0 {
+		s.notify.Notify("", fmt.Sprintf("%v: %v writes", ReplayBot, saved))
+	}
+}
+
+func (s *Spool) open() error {
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+	s.file = file
+
+	return nil
+}
+
+func (s *Spool) append(e entry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	if _, err = s.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+
+	return s.file.Sync()
+}
+
+func (s *Spool) rejectedPath() string {
+	return s.path + ".rejected"
+}
+
+// reject appends e to the rejected file, which is kept for manual review.
+func (s *Spool) reject(e entry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(s.rejectedPath(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(append(data, '\n')); err == nil {
+		err = file.Sync()
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+
+	return err
+}
+
+// read returns spooled writes, lines which can't be parsed (e.g. cut by crash)
+// are skipped.
+func (s *Spool) read() ([]entry, error) {
+	file, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var res []entry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var e entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			s.logger.Errorf("Spool: skip broken write: %v", err)
+			continue
+		}
+		res = append(res, e)
+	}
+
+	return res, scanner.Err()
+}
+
+// rewrite atomically replaces spool file with entries.
+func (s *Spool) rewrite(entries []entry) error {
+	tmp := s.path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(file)
+	for _, e := range entries {
+		data, err := json.Marshal(e)
+		if err != nil {
+			file.Close()
+			return err
+		}
+		_, _ = w.Write(append(data, '\n'))
+	}
+	if err = w.Flush(); err == nil {
+		err = file.Sync()
+	}
+	if cerr := file.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+
+	s.file.Close()
+	return s.open()
+}
@@ -0,0 +1,199 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cgriceld/crypto-trade-bot/internal/domain"
+	"github.com/cgriceld/crypto-trade-bot/pkg/log"
+
+	"github.com/jackc/pgconn"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// database fails all writes while down and rejects orders of reject market.
+type database struct {
+	Repository
+	down   bool
+	reject string
+	writes []string
+}
+
+func (d *database) SaveOrder(ctx context.Context, order domain.Order) error {
+	if d.down {
+		return errors.New("connection refused")
+	}
+	if order.Market == d.reject {
+		return &pgconn.PgError{Severity: "ERROR", Code: "23502", Message: "null value violates not-null constraint"}
+	}
+	d.writes = append(d.writes, "order "+order.Market)
+	return nil
+}
+
+func (d *database) SaveSettings(ctx context.Context, settings domain.MarketSettings) error {
+	if d.down {
+		return errors.New("connection refused")
+	}
+	d.writes = append(d.writes, "settings "+settings.Market)
+	return nil
+}
+
+func (d *database) Close() {
+}
+
+type messages []string
+
+func (m *messages) Notify(market domain.Market, message string) {
+	*m = append(*m, message)
+}
+
+func TestSpool(t *testing.T) {
+	logger := log.NewLog(logrus.New(), logrus.DebugLevel, ioutil.Discard)
+	path := filepath.Join(t.TempDir(), "spool.jsonl")
+	db := &database{}
+	var notify messages
+
+	s, err := NewSpool(db, path, time.Hour, logger, &notify)
+	if !assert.NoError(t, err) {
+		t.Fatal()
+	}
+	ctx := context.Background()
+
+	// database is up
+	_ = s.SaveOrder(ctx, domain.Order{Market: "pi_xbtusd"})
+
+	// outage: writes are spooled, alert is sent once
+	db.down = true
+	_ = s.SaveOrder(ctx, domain.Order{Market: "pi_ethusd"})
+	_ = s.SaveSettings(ctx, domain.MarketSettings{Market: "pi_ethusd"})
+	s.replay()
+
+	if !assert.Equal(t, []string{"order pi_xbtusd"}, db.writes) ||
+		!assert.Equal(t, 2, s.Pending()) ||
+		!assert.Equal(t, messages{SpoolBot + ": 1 writes in " + path}, notify) {
+		t.Fatal()
+	}
+
+	// database recovered, but new writes wait for the spooled ones
+	db.down = false
+	_ = s.SaveOrder(ctx, domain.Order{Market: "pi_ltcusd"})
+	if !assert.Equal(t, []string{"order pi_xbtusd"}, db.writes) || !assert.Equal(t, 3, s.Pending()) {
+		t.Fatal()
+	}
+
+	s.replay()
+	if !assert.Equal(t, []string{"order pi_xbtusd", "order pi_ethusd", "settings pi_ethusd", "order pi_ltcusd"}, db.writes) ||
+		!assert.Equal(t, 0, s.Pending()) ||
+		!assert.Equal(t, ReplayBot+": 3 writes", notify[len(notify)-1]) {
+		t.Fatal()
+	}
+
+	_ = s.SaveOrder(ctx, domain.Order{Market: "pi_bchusd"})
+	if !assert.Equal(t, "order pi_bchusd", db.writes[len(db.writes)-1]) {
+		t.Fatal()
+	}
+	s.Close()
+}
+
+func TestSpoolRestart(t *testing.T) {
+	logger := log.NewLog(logrus.New(), logrus.DebugLevel, ioutil.Discard)
+	path := filepath.Join(t.TempDir(), "spool.jsonl")
+	db := &database{down: true}
+	var notify messages
+
+	s, _ := NewSpool(db, path, time.Hour, logger, &notify)
+	_ = s.SaveOrder(context.Background(), domain.Order{Market: "pi_ethusd", Price: 42})
+	s.Close()
+
+	// writes left in the spool are replayed after restart
+	s, err := NewSpool(db, path, time.Hour, logger, &notify)
+	if !assert.NoError(t, err) || !assert.Equal(t, 1, s.Pending()) ||
+		!assert.Equal(t, SpoolBot+": 1 writes in "+path, notify[len(notify)-1]) {
+		t.Fatal()
+	}
+
+	db.down = false
+	s.Close()
+	if !assert.Equal(t, []string{"order pi_ethusd"}, db.writes) {
+		t.Fatal()
+	}
+}
+
+func TestSpoolRewriteFailed(t *testing.T) {
+	logger := log.NewLog(logrus.New(), logrus.DebugLevel, ioutil.Discard)
+	path := filepath.Join(t.TempDir(), "spool.jsonl")
+	db := &database{down: true}
+	var notify messages
+
+	s, _ := NewSpool(db, path, time.Hour, logger, &notify)
+	defer s.Close()
+	ctx := context.Background()
+	_ = s.SaveOrder(ctx, domain.Order{Market: "pi_ethusd"})
+	_ = s.SaveOrder(ctx, domain.Order{Market: "pi_ltcusd"})
+
+	// spool can't be rewritten, so the saved writes are still pending
+	db.down = false
+	if !assert.NoError(t, os.Mkdir(path+".tmp", 0700)) {
+		t.Fatal()
+	}
+	s.replay()
+	if !assert.Equal(t, []string{"order pi_ethusd", "order pi_ltcusd"}, db.writes) || !assert.Equal(t, 2, s.Pending()) {
+		t.Fatal()
+	}
+
+	_ = os.Remove(path + ".tmp")
+	s.replay()
+	if !assert.Len(t, db.writes, 4) || !assert.Equal(t, 0, s.Pending()) {
+		t.Fatal()
+	}
+}
+
+func TestSpoolRejected(t *testing.T) {
+	logger := log.NewLog(logrus.New(), logrus.DebugLevel, ioutil.Discard)
+	path := filepath.Join(t.TempDir(), "spool.jsonl")
+	db := &database{reject: "pi_ethusd"}
+	var notify messages
+
+	s, _ := NewSpool(db, path, time.Hour, logger, &notify)
+	defer s.Close()
+	ctx := context.Background()
+
+	// rejected write isn't spooled
+	err := s.SaveOrder(ctx, domain.Order{Market: "pi_ethusd"})
+	if !assert.EqualError(t, err, "ERROR: null value violates not-null constraint (SQLSTATE 23502)") || !assert.Equal(t, 0, s.Pending()) {
+		t.Fatal()
+	}
+
+	db.down = true
+	_ = s.SaveOrder(ctx, domain.Order{Market: "pi_ethusd"})
+	_ = s.SaveOrder(ctx, domain.Order{Market: "pi_ltcusd"})
+
+	// rejected write blocks the spool until it is moved aside
+	db.down = false
+	for i := 1; i < maxAttempts; i++ {
+		s.replay()
+		if !assert.Empty(t, db.writes) || !assert.Equal(t, 2, s.Pending()) {
+			t.Fatal()
+		}
+	}
+	s.replay()
+	if !assert.Equal(t, []string{"order pi_ltcusd"}, db.writes) || !assert.Equal(t, 0, s.Pending()) ||
+		!assert.Equal(t, messages{
+			SpoolBot + ": 1 writes in " + path,
+			RejectBot + ": 1 writes moved to " + path + ".rejected",
+			ReplayBot + ": 1 writes",
+		}, notify) {
+		t.Fatal()
+	}
+
+	data, err := os.ReadFile(path + ".rejected")
+	if !assert.NoError(t, err) || !assert.Contains(t, string(data), `"market":"pi_ethusd"`) {
+		t.Fatal()
+	}
+}
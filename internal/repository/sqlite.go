@@ -0,0 +1,157 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/cgriceld/crypto-trade-bot/internal/repository/migrations"
+	"github.com/cgriceld/crypto-trade-bot/internal/repository/queries"
+	"github.com/cgriceld/crypto-trade-bot/pkg/log"
+
+	_ "modernc.org/sqlite"
+)
+
+// SQLiteScheme is DSN scheme of SQLite database, e.g. sqlite://robot.db
+// or sqlite:///var/lib/robot/robot.db.
+const SQLiteScheme = "sqlite://"
+
+type sqliteRepo struct {
+	db     *sql.DB
+	logger log.Logger
+	*queries.SQLite
+}
+
+// IsSQLite reports whether dsn points to SQLite database.
+func IsSQLite(dsn string) bool {
+	return strings.HasPrefix(dsn, SQLiteScheme)
+}
+
+// NewSQLite opens (or creates) SQLite database of dsn and migrates its schema.
+func NewSQLite(ctx context.Context, dsn string, logger log.Logger) (*sqliteRepo, error) {
+	file := strings.TrimPrefix(dsn, SQLiteScheme)
+	if file == "" {
+		return nil, fmt.Errorf("No SQLite file in dsn: %v", dsn)
+	}
+	if !strings.Contains(file, "?") {
+		file += "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	}
+	// times are written as text sorted in time order, see queries.SQLite
+	file += "&_time_format=sqlite"
+
+	db, err := sql.Open("sqlite", file)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite has a single writer, besides every connection to :memory: is
+	// a separate database
+	db.SetMaxOpenConns(1)
+
+	if err = migrateSQLite(ctx, db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &sqliteRepo{
+		db:     db,
+		logger: logger,
+		SQLite: queries.NewSQLite(db),
+	}, nil
+}
+
+func (r *sqliteRepo) Close() {
+	if err := r.db.Close(); err != nil {
+		r.logger.Errorf("SQLite: %v", err)
+	}
+}
+
+// legacySQLite maps user_version of databases created with the former
+// separate SQLite schema to the last shared migration they match.
+var legacySQLite = map[int]int{1: 4, 2: 5, 3: 6, 4: 7}
+
+const (
+	createMigrationsSQLite = `CREATE TABLE IF NOT EXISTS schema_migrations(version integer primary key, name text not null,
+	applied_at timestamp not null default current_timestamp)`
+	getMigrationsSQLite = `SELECT version FROM schema_migrations`
+	addMigrationSQLite  = `INSERT INTO schema_migrations(version, name) VALUES (?1, ?2)`
+)
+
+// migrateSQLite applies pending shared migrations, applied ones are recorded
+// in schema_migrations as in Postgres.
+func migrateSQLite(ctx context.Context, db *sql.DB) error {
+	list, err := migrations.Load(migrations.SQLite)
+	if err != nil {
+		return err
+	}
+	known := make(map[int]bool, len(list))
+	for _, m := range list {
+		known[m.Version] = true
+	}
+
+	if _, err = db.ExecContext(ctx, createMigrationsSQLite); err != nil {
+		return err
+	}
+	applied, err := appliedSQLite(ctx, db)
+	if err != nil {
+		return err
+	}
+	for version := range applied {
+		if !known[version] {
+			return fmt.Errorf("%v: %v", migrations.UnknownVersion, version)
+		}
+	}
+
+	var legacy int
+	if len(applied) == 0 {
+		if err = db.QueryRowContext(ctx, "PRAGMA user_version").Scan(&legacy); err != nil {
+			return err
+		}
+	}
+
+	for _, m := range list {
+		if applied[m.Version] {
+			continue
+		}
+
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		// the schema is already there, the migration is only recorded
+		if m.Version > legacySQLite[legacy] {
+			_, err = tx.ExecContext(ctx, m.Up)
+		}
+		if err == nil {
+			_, err = tx.ExecContext(ctx, addMigrationSQLite, m.Version, m.Name)
+		}
+		if err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("%04d_%v: %v", m.Version, m.Name, err)
+		}
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func appliedSQLite(ctx context.Context, db *sql.DB) (map[int]bool, error) {
+	rows, err := db.QueryContext(ctx, getMigrationsSQLite)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := make(map[int]bool)
+	for rows.Next() {
+		var version int
+		if err = rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		res[version] = true
+	}
+
+	return res, rows.Err()
+}
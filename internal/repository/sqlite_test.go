@@ -0,0 +1,171 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cgriceld/crypto-trade-bot/internal/domain"
+	"github.com/cgriceld/crypto-trade-bot/internal/repository/migrations"
+	"github.com/cgriceld/crypto-trade-bot/pkg/log"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSQLite(t *testing.T) {
+	logger := log.NewLog(logrus.New(), logrus.DebugLevel, ioutil.Discard)
+	dsn := SQLiteScheme + filepath.Join(t.TempDir(), "robot.db")
+	ctx := context.Background()
+
+	db, err := NewSQLite(ctx, dsn, logger)
+	if !assert.NoError(t, err) {
+		t.Fatal()
+	}
+
+	ts := func(h int) *time.Time {
+		v := time.Date(2021, 12, 1, h, 0, 0, 0, time.FixedZone("MSK", 3*60*60))
+		return &v
+	}
+	orders := []domain.Order{
+		{Time: ts(10), ID: "buy", Market: "pi_xbtusd", Typ: "buy", Price: 56980.5, Size: 1, ClientID: "c1",
+			Outcome: domain.OrderPlaced, Status: "placed", TriggerPrice: 56980, SentAt: ts(10)},
+		{Time: ts(11), ID: "sell", Market: "pi_ethusd", Typ: "sell", Price: 4100, Size: 2, Outcome: domain.OrderNoFunds,
+			Execution: domain.Execution{OrderType: domain.OrderStop, StopPrice: 4050, ReduceOnly: true, TriggerSignal: "mark"}},
+		{Time: ts(12), ID: "sell", Market: "pi_xbtusd", Typ: "sell", Price: 57410, Size: 1, Fee: 28.7, Paper: true,
+			ClientID: "c2", Outcome: domain.OrderPlaced},
+	}
+	for _, v := range orders {
+		if !assert.NoError(t, db.SaveOrder(ctx, v)) {
+			t.Fatal()
+		}
+	}
+	// replayed orders are saved once, paper ones too
+	for _, v := range []domain.Order{orders[0], orders[2]} {
+		if !assert.NoError(t, db.SaveOrder(ctx, v)) {
+			t.Fatal()
+		}
+	}
+
+	// times are returned in UTC
+	for i := range orders {
+		utc := orders[i].Time.UTC()
+		orders[i].Time = &utc
+		orders[i].RowID = int64(i + 1)
+	}
+	utc := orders[0].SentAt.UTC()
+	orders[0].SentAt = &utc
+
+	res, err := db.GetOrders(ctx, domain.OrderFilter{Market: "pi_xbtusd", Limit: 1})
+	if !assert.NoError(t, err) || !assert.Equal(t, []domain.Order{orders[0]}, res.Orders) ||
+		!assert.NotEmpty(t, res.NextCursor) {
+		t.Fatal()
+	}
+
+	cursor, _ := domain.ParseCursor(res.NextCursor)
+	res, err = db.GetOrders(ctx, domain.OrderFilter{Market: "pi_xbtusd", Limit: 1, Cursor: cursor})
+	if !assert.NoError(t, err) || !assert.Equal(t, []domain.Order{orders[2]}, res.Orders) ||
+		!assert.Empty(t, res.NextCursor) {
+		t.Fatal()
+	}
+
+	res, err = db.GetOrders(ctx, domain.OrderFilter{From: ts(11), Desc: true})
+	if !assert.NoError(t, err) || !assert.Equal(t, []domain.Order{orders[2], orders[1]}, res.Orders) {
+		t.Fatal()
+	}
+
+	var exported []domain.Order
+	err = db.EachOrder(ctx, domain.OrderFilter{Outcome: domain.OrderPlaced, To: ts(12)}, func(o domain.Order) error {
+		exported = append(exported, o)
+		return nil
+	})
+	if !assert.NoError(t, err) || !assert.Equal(t, []domain.Order{orders[0]}, exported) {
+		t.Fatal()
+	}
+
+	// candle updates are deduplicated by market, interval and time
+	candle := domain.CandleRecord{Market: "pi_xbtusd", Interval: "1m", Time: ts(10).UTC(), Open: 56980, High: 57000,
+		Low: 56950, Close: 56990}
+	_ = db.SaveCandle(ctx, candle)
+	candle.Close, candle.Volume = 56995.5, 7
+	for _, v := range []domain.CandleRecord{candle, {Market: "pi_xbtusd", Interval: "1m", Time: ts(11).UTC(), Close: 57100}} {
+		if !assert.NoError(t, db.SaveCandle(ctx, v)) {
+			t.Fatal()
+		}
+	}
+
+	candles, err := db.GetCandles(ctx, domain.CandleFilter{Market: "pi_xbtusd", Interval: "1m", To: ts(11)})
+	if !assert.NoError(t, err) || !assert.Equal(t, []domain.CandleRecord{candle}, candles) {
+		t.Fatal()
+	}
+	candles, err = db.GetCandles(ctx, domain.CandleFilter{Market: "pi_xbtusd", Limit: 1, Desc: true})
+	if !assert.NoError(t, err) || !assert.Len(t, candles, 1) || !assert.Equal(t, 57100.0, candles[0].Close) {
+		t.Fatal()
+	}
+
+	settings := domain.MarketSettings{Market: "pi_xbtusd", Strategy: "threshold", Orders: []domain.Order{}}
+	_ = db.SaveSettings(ctx, settings)
+	settings.Active = true
+	if !assert.NoError(t, db.SaveSettings(ctx, settings)) {
+		t.Fatal()
+	}
+	db.Close()
+
+	// schema is not migrated twice
+	db, err = NewSQLite(ctx, dsn, logger)
+	if !assert.NoError(t, err) {
+		t.Fatal()
+	}
+	defer db.Close()
+
+	saved, err := db.GetSettings(ctx)
+	if !assert.NoError(t, err) || !assert.Equal(t, []domain.MarketSettings{settings}, saved) {
+		t.Fatal()
+	}
+}
+
+func TestSQLiteLegacy(t *testing.T) {
+	logger := log.NewLog(logrus.New(), logrus.DebugLevel, ioutil.Discard)
+	file := filepath.Join(t.TempDir(), "robot.db")
+	ctx := context.Background()
+
+	// database migrated with the former separate SQLite schema
+	legacy, err := sql.Open("sqlite", file)
+	if !assert.NoError(t, err) {
+		t.Fatal()
+	}
+	_, err = legacy.ExecContext(ctx, `create table orders(id integer primary key autoincrement, ts timestamp, trigger_id text,
+	market text, type text, price numeric, size integer, fee numeric default 0, paper boolean default false, cli_ord_id text,
+	order_id text, outcome text not null default 'placed', status text, error text, trigger_price numeric, sent_at timestamp,
+	received_at timestamp, order_type text, stop_price numeric, reduce_only boolean, trigger_signal text);
+create index orders_outcome on orders(outcome);
+create index orders_ts_id on orders(ts, id);
+create index orders_market_ts on orders(market, ts);
+create unique index orders_cli_ord_id on orders(cli_ord_id);
+create table settings(market text primary key, data text not null, updated_at timestamp not null default current_timestamp);
+create table candles(market text not null, resolution text not null, ts timestamp not null, open numeric not null,
+	high numeric not null, low numeric not null, close numeric not null, volume numeric not null default 0,
+	primary key (market, resolution, ts));
+PRAGMA user_version = 4;`)
+	legacy.Close()
+	if !assert.NoError(t, err) {
+		t.Fatal()
+	}
+
+	// its schema is recorded as shared migrations instead of being created again
+	db, err := NewSQLite(ctx, SQLiteScheme+file, logger)
+	if !assert.NoError(t, err) {
+		t.Fatal()
+	}
+	defer db.Close()
+
+	list, _ := migrations.Load(migrations.SQLite)
+	var applied int
+	if err = db.db.QueryRowContext(ctx, "SELECT count(*) FROM schema_migrations").Scan(&applied); !assert.NoError(t, err) ||
+		!assert.Equal(t, len(list), applied) || !assert.NoError(t, db.SaveOrder(ctx, domain.Order{Market: "pi_xbtusd", ClientID: "c1"})) {
+		t.Fatal()
+	}
+}
@@ -0,0 +1,219 @@
+package robot
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/cgriceld/crypto-trade-bot/internal/domain"
+	"github.com/cgriceld/crypto-trade-bot/pkg/indicators"
+)
+
+// Book keeps inner orders of a market. Strategies fire orders from the book,
+// callers must hold the market lock.
+type Book struct {
+	market    domain.Market
+	triggers  []*Trigger
+	seq       int
+	oco       bool
+	cancelled []string
+}
+
+func (b *Book) find(id string) int {
+	for i, v := range b.triggers {
+		if v.id == id {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// get returns trigger with id, nil if there is no such trigger.
+func (b *Book) get(id string) *Trigger {
+	if i := b.find(id); i >= 0 {
+		return b.triggers[i]
+	}
+
+	return nil
+}
+
+// put replaces trigger with the same id or appends a new one.
+func (b *Book) put(trigger *Trigger) {
+	if i := b.find(trigger.id); i >= 0 {
+		b.triggers[i] = trigger
+		return
+	}
+
+	b.triggers = append(b.triggers, trigger)
+}
+
+func (b *Book) remove(i int) {
+	b.triggers = append(b.triggers[:i], b.triggers[i+1:]...)
+}
+
+// drop removes trigger if it's still in the book.
+func (b *Book) drop(t *Trigger) {
+	if i := b.find(t.id); i >= 0 && b.triggers[i] == t {
+		b.remove(i)
+	}
+}
+
+// exchange returns triggers of type typ resting on Kraken.
+func (b *Book) exchange(typ string) []*Trigger {
+	var res []*Trigger
+	for _, v := range b.triggers {
+		if v.typ == typ && v.orderID != "" {
+			res = append(res, v)
+		}
+	}
+
+	return res
+}
+
+// resting returns triggers of all types resting on Kraken.
+func (b *Book) resting() []*Trigger {
+	var res []*Trigger
+	for _, v := range b.triggers {
+		if v.orderID != "" {
+			res = append(res, v)
+		}
+	}
+
+	return res
+}
+
+// forget removes exchange triggers with order IDs in ids, which are no longer
+// on Kraken, and returns their number.
+func (b *Book) forget(ids map[string]bool) int {
+	var left []*Trigger
+	for _, v := range b.triggers {
+		if v.orderID == "" || !ids[v.orderID] {
+			left = append(left, v)
+		}
+	}
+
+	n := len(b.triggers) - len(left)
+	b.triggers = left
+
+	return n
+}
+
+// cancel removes all inner triggers of type typ and returns their number,
+// exchange orders are kept since they must be cancelled on Kraken.
+func (b *Book) cancel(typ string) int {
+	var left []*Trigger
+	for _, v := range b.triggers {
+		if v.typ != typ || v.orderID != "" {
+			left = append(left, v)
+		}
+	}
+
+	n := len(b.triggers) - len(left)
+	b.triggers = left
+
+	return n
+}
+
+func (b *Book) nextID() string {
+	for {
+		b.seq++
+		id := strconv.Itoa(b.seq)
+		if b.find(id) < 0 {
+			return id
+		}
+	}
+}
+
+// update feeds candle to conditions of all triggers, every trigger compares
+// indicators with the price of its side.
+func (b *Book) update(bar indicators.Bar, q Quote) {
+	for _, t := range b.triggers {
+		for _, cond := range t.conds {
+			cond.Update(bar, q.Side(t.typ))
+		}
+	}
+}
+
+// close feeds candle closed by a new one to conditions of all triggers, so
+// that indicators are computed on complete candles only.
+func (b *Book) close(candle domain.Candle, source string) error {
+	q, err := candlePrice(candle, source)
+	if err != nil {
+		return err
+	}
+	bar, _ := indicators.NewBar(candle)
+	b.update(bar, q)
+
+	return nil
+}
+
+// met reports whether all conditions of trigger hold on the last candle.
+func (t *Trigger) met() bool {
+	for _, cond := range t.conds {
+		if !cond.Met() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Fire removes triggers for which fired returns true and returns orders for
+// them at the price of quote q for their side. If the book is OCO, firing a
+// trigger cancels all inner triggers of the opposite type, exchange ones are
+// reported by Cancelled to be cancelled on Kraken. Exchange orders are
+// triggered by Kraken and never fire.
+func (b *Book) Fire(q Quote, fired func(t *Trigger) bool) []domain.Order {
+	var res []domain.Order
+	var left []*Trigger
+
+	ts := time.Now()
+	sides := make(map[string]bool)
+	for _, t := range b.triggers {
+		// linked order has already fired, t is cancelled below
+		if b.oco && sides[opposite(t.typ)] {
+			left = append(left, t)
+			continue
+		}
+		if t.orderID != "" || !fired(t) {
+			left = append(left, t)
+			continue
+		}
+
+		res = append(res, domain.Order{
+			Time:      &ts,
+			ID:        t.id,
+			Market:    string(b.market),
+			Typ:       t.typ,
+			Price:     q.Side(t.typ),
+			Size:      int(t.size),
+			Execution: t.exec,
+		})
+		sides[t.typ] = true
+	}
+	b.triggers = left
+
+	if b.oco {
+		for _, typ := range []string{"sell", "buy"} {
+			if sides[typ] && (b.cancel(opposite(typ)) > 0 || len(b.exchange(opposite(typ))) > 0) {
+				b.cancelled = append(b.cancelled, opposite(typ))
+			}
+		}
+	}
+
+	return res
+}
+
+// Cancelled returns types of orders cancelled by OCO since the last call.
+func (b *Book) Cancelled() []string {
+	res := b.cancelled
+	b.cancelled = nil
+	return res
+}
+
+func opposite(typ string) string {
+	if typ == "sell" {
+		return "buy"
+	}
+	return "sell"
+}
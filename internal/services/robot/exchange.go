@@ -0,0 +1,291 @@
+package robot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cgriceld/crypto-trade-bot/internal/domain"
+)
+
+const FilledExchangeBot = "📌 Order was executed on Kraken"
+
+var (
+	PaperExchange = errors.New("Exchange orders aren't available in paper trading")
+	FailExchange  = errors.New("Kraken didn't accept the request")
+)
+
+// SetExchange places (or replaces) the order named by its type as stop or take
+// profit order resting on Kraken at price, so that it protects the position
+// while the robot is down. The order of the same kind is edited on Kraken,
+// any other order with that name is cancelled first. If Kraken executes the
+// order at once, it's not kept in the book.
+func (r *Robot) SetExchange(ctx context.Context, m domain.Market, typ string, p domain.Price, s domain.Size,
+	exec domain.Execution) (domain.Order, error) {
+	if typ != "sell" && typ != "buy" {
+		return domain.Order{}, fmt.Errorf("%v: %v", WrongSide, typ)
+	}
+	exec.StopPrice = float64(p)
+	if !exec.Stop() {
+		return domain.Order{}, fmt.Errorf("%v: %v", WrongExec, exec.Kind())
+	}
+	if param := exec.Invalid(); param != "" {
+		return domain.Order{}, fmt.Errorf("%v: %v", WrongExec, param)
+	}
+	if err := r.checkOrder(m, p, s); err != nil {
+		return domain.Order{}, err
+	}
+
+	r.muxAll.RLock()
+	v, ok := r.trades[m]
+	r.muxAll.RUnlock()
+
+	if !ok {
+		return domain.Order{}, fmt.Errorf("%v: %v", NoMarket, m)
+	}
+
+	v.muxExchange.Lock()
+	defer v.muxExchange.Unlock()
+
+	// the previous order may be executed already
+	if err := r.reconcile(ctx, m, v); err != nil {
+		r.logger.Warnf("SetExchange: %v: %v", m, err)
+	}
+
+	v.muxTrade.RLock()
+	paper := v.paper != nil
+	prev := v.book.get(typ)
+	v.muxTrade.RUnlock()
+
+	if paper {
+		return domain.Order{}, fmt.Errorf("%v: %v", PaperExchange, m)
+	}
+
+	trigger := &Trigger{id: typ, typ: typ, price: p, size: s, exec: exec}
+	if prev != nil && prev.orderID != "" && sameKind(prev.exec, exec) {
+		if err := r.editExchange(ctx, m, prev.orderID, trigger); err != nil {
+			return domain.Order{}, err
+		}
+		trigger.orderID = prev.orderID
+		trigger.placed = prev.placed
+	} else {
+		if prev != nil && prev.orderID != "" {
+			if err := r.cancelExchange(ctx, m, prev); err != nil {
+				return domain.Order{}, err
+			}
+			v.muxTrade.Lock()
+			v.book.drop(prev)
+			v.muxTrade.Unlock()
+			r.save(m, v)
+		}
+
+		placed, err := r.placeExchange(ctx, m, trigger)
+		if err != nil {
+			return domain.Order{}, err
+		}
+		trigger.orderID = placed.OrderID
+		trigger.placed = placed.SentAt
+
+		// executed at once, the inner order it replaces is done as well
+		if placed.Outcome == domain.OrderPlaced {
+			v.muxTrade.Lock()
+			if prev != nil {
+				v.book.drop(prev)
+			}
+			v.muxTrade.Unlock()
+			r.save(m, v)
+
+			return placed, nil
+		}
+	}
+
+	v.muxTrade.Lock()
+	v.book.put(trigger)
+	res := activeOrder(m, trigger, v.book.oco)
+	v.muxTrade.Unlock()
+
+	r.save(m, v)
+
+	return res, nil
+}
+
+// sameKind reports whether Kraken order with execution a can be edited to b,
+// editorder changes only size and prices.
+func sameKind(a domain.Execution, b domain.Execution) bool {
+	return a.OrderType == b.OrderType && a.TriggerSignal == b.TriggerSignal && a.ReduceOnly == b.ReduceOnly
+}
+
+// placeExchange sends order of trigger to Kraken and records it in the ledger,
+// the order must be placed (open or executed) to be kept.
+func (r *Robot) placeExchange(ctx context.Context, m domain.Market, t *Trigger) (domain.Order, error) {
+	sent := time.Now()
+	order := domain.Order{
+		Time:         &sent,
+		ID:           t.id,
+		Market:       string(m),
+		Typ:          t.typ,
+		Price:        float64(t.price),
+		Size:         int(t.size),
+		Execution:    t.exec,
+		ClientID:     newClientID(),
+		TriggerPrice: float64(t.price),
+		SentAt:       &sent,
+	}
+
+	resp, err := r.kraken.SendOrder(ctx, order)
+	if err != nil {
+		r.logger.Errorf("placeExchange: %v: %v: %v", m, t.typ, err)
+		order.Outcome = domain.OrderFailed
+		order.Error = err.Error()
+		r.saveOrder(m, order)
+		return domain.Order{}, err
+	}
+
+	res := r.processOrder(resp, m, order)
+	if res.Outcome != domain.OrderOpen && res.Outcome != domain.OrderPlaced {
+		reason := res.Status
+		if res.Error != "" {
+			reason = res.Error
+		}
+		return domain.Order{}, fmt.Errorf("%v: %v: %v", FailExchange, m, reason)
+	}
+
+	return res, nil
+}
+
+// editExchange changes size and stop price of exchange order to the ones
+// of trigger.
+func (r *Robot) editExchange(ctx context.Context, m domain.Market, orderID string, t *Trigger) error {
+	order := domain.Order{Size: int(t.size), Execution: t.exec}
+
+	resp, err := r.kraken.EditOrder(ctx, orderID, order)
+	if err != nil {
+		r.logger.Errorf("editExchange: %v: %v: %v", m, orderID, err)
+		return err
+	}
+	if resp.Result != "success" {
+		return fmt.Errorf("%v: %v: %v", FailExchange, m, resp.Error)
+	}
+	if resp.Status.Stat != "edited" {
+		return fmt.Errorf("%v: %v: %v", FailExchange, m, resp.Status.Stat)
+	}
+
+	r.logger.Infof("%v %v order %v on %v is edited, price: %.2f, size: %v", t.exec.Kind(), t.typ, orderID, m,
+		t.exec.StopPrice, t.size)
+	return nil
+}
+
+// cancelExchange cancels exchange order of trigger. Orders which are already
+// gone from the order book count as cancelled, fills of executed ones are
+// recorded. Caller must hold muxExchange of the market.
+func (r *Robot) cancelExchange(ctx context.Context, m domain.Market, t *Trigger) error {
+	resp, err := r.kraken.CancelOrder(ctx, t.orderID)
+	if err != nil {
+		r.logger.Errorf("cancelExchange: %v: %v: %v", m, t.orderID, err)
+		return err
+	}
+	if resp.Result != "success" {
+		return fmt.Errorf("%v: %v: %v", FailExchange, m, resp.Error)
+	}
+
+	switch resp.Status.Stat {
+	case "cancelled":
+		r.logger.Infof("%v %v order %v on %v is cancelled", t.exec.Kind(), t.typ, t.orderID, m)
+	case "notFound", "filled":
+		r.logger.Warnf("cancelExchange: %v: %v: order is %v on Kraken", m, t.orderID, resp.Status.Stat)
+		fills, err := r.fills(ctx, t.placed)
+		if err != nil {
+			r.logger.Errorf("cancelExchange: %v: %v: %v", m, t.orderID, err)
+			break
+		}
+		if r.settle(m, r.trades[m], t, fills) > 0 {
+			r.notify.Notify(m, fmt.Sprintf("%v: %v: %v %v order", FilledExchangeBot, m, t.exec.Kind(), t.typ))
+		}
+	default:
+		return fmt.Errorf("%v: %v: %v", FailExchange, m, resp.Status.Stat)
+	}
+
+	return nil
+}
+
+// OpenOrders returns orders of the account resting on Kraken.
+func (r *Robot) OpenOrders(ctx context.Context) ([]domain.OpenOrder, error) {
+	return r.kraken.OpenOrders(ctx)
+}
+
+// OpenPositions returns open positions of the account on Kraken.
+func (r *Robot) OpenPositions(ctx context.Context) ([]domain.OpenPosition, error) {
+	return r.kraken.OpenPositions(ctx)
+}
+
+// Fills returns the last fills of the account on Kraken before time before,
+// the latest ones if it's nil.
+func (r *Robot) Fills(ctx context.Context, before *time.Time) ([]domain.Fill, error) {
+	return r.kraken.Fills(ctx, before)
+}
+
+// CancelOrder cancels order with orderID on Kraken, the order may be placed
+// outside of the robot. Exchange trigger of the order is removed from its book.
+func (r *Robot) CancelOrder(ctx context.Context, orderID string) (*domain.CancelStatus, error) {
+	resp, err := r.kraken.CancelOrder(ctx, orderID)
+	if err != nil {
+		r.logger.Errorf("CancelOrder: %v: %v", orderID, err)
+		return nil, err
+	}
+	if resp.Result != "success" {
+		return nil, fmt.Errorf("%v: %w: %v", FailExchange, domain.UnsuccessfulResponse, resp.Error)
+	}
+
+	if resp.Status.Stat == "cancelled" || resp.Status.Stat == "filled" {
+		r.forget(map[string]bool{orderID: true})
+	}
+
+	return &resp.Status, nil
+}
+
+// CancelAllOrders cancels all orders on Kraken of market m, of all markets
+// if m is empty. Exchange triggers of cancelled orders are removed from books.
+func (r *Robot) CancelAllOrders(ctx context.Context, m domain.Market) (*domain.CancelAllStatus, error) {
+	resp, err := r.kraken.CancelAllOrders(ctx, m)
+	if err != nil {
+		r.logger.Errorf("CancelAllOrders: %v: %v", m, err)
+		return nil, err
+	}
+
+	ids := make(map[string]bool)
+	for _, v := range resp.Orders {
+		ids[v.OrderID] = true
+	}
+	r.forget(ids)
+
+	return resp, nil
+}
+
+// forget removes exchange triggers of orders with ids from books of all
+// markets, those orders are already gone from Kraken.
+func (r *Robot) forget(ids map[string]bool) {
+	if len(ids) == 0 {
+		return
+	}
+
+	r.muxAll.RLock()
+	trades := make(map[domain.Market]*Trade, len(r.trades))
+	for m, v := range r.trades {
+		trades[m] = v
+	}
+	r.muxAll.RUnlock()
+
+	for m, v := range trades {
+		v.muxExchange.Lock()
+		v.muxTrade.Lock()
+		n := v.book.forget(ids)
+		v.muxTrade.Unlock()
+
+		if n > 0 {
+			r.save(m, v)
+			r.logger.Infof("%v: %v exchange orders are removed, they were cancelled on Kraken", m, n)
+		}
+		v.muxExchange.Unlock()
+	}
+}
@@ -0,0 +1,144 @@
+package robot
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cgriceld/crypto-trade-bot/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetExchange(t *testing.T) {
+	ctx := context.Background()
+	m := domain.Market("pi_xbtusd")
+	ex := newExchangeMock(krak)
+	rep := NewRepMock()
+	r := New(ex, rep, logger, notify)
+	r.SetMarket(ctx, m)
+
+	tp := domain.Execution{OrderType: domain.OrderTakeProfit}
+	order, err := r.SetExchange(ctx, m, "sell", 60000, 2, tp)
+	if !assert.NoError(t, err) || !assert.Equal(t, "o1", order.OrderID) || !assert.Equal(t, 60000.0, order.StopPrice) {
+		t.Fatal()
+	}
+	page, _ := rep.GetOrders(ctx, domain.OrderFilter{})
+	if !assert.Len(t, page.Orders, 1) || !assert.Equal(t, domain.OrderOpen, page.Orders[0].Outcome) {
+		t.Fatal()
+	}
+
+	// the same kind is edited
+	order, err = r.SetExchange(ctx, m, "sell", 61000, 3, tp)
+	if !assert.NoError(t, err) || !assert.Equal(t, "o1", order.OrderID) || !assert.Len(t, ex.orders(), 1) ||
+		!assert.Equal(t, 61000.0, ex.orders()["o1"].StopPrice) || !assert.Equal(t, 3, ex.orders()["o1"].Size) {
+		t.Fatal()
+	}
+
+	// another kind replaces the order
+	order, err = r.SetExchange(ctx, m, "sell", 55000, 3, domain.Execution{OrderType: domain.OrderStop, ReduceOnly: true})
+	if !assert.NoError(t, err) || !assert.Equal(t, "o2", order.OrderID) || !assert.Len(t, ex.orders(), 1) ||
+		!assert.True(t, ex.orders()["o2"].ReduceOnly) {
+		t.Fatal()
+	}
+
+	// exchange orders are triggered by Kraken
+	fired := r.trades[m].book.Fire(flat(50000), func(t *Trigger) bool { return true })
+	if !assert.Empty(t, fired) {
+		t.Fatal()
+	}
+
+	// inner order replaces exchange one
+	if err = r.SetSell(ctx, m, 62000, 1); !assert.NoError(t, err) || !assert.Empty(t, ex.orders()) ||
+		!assert.Equal(t, "", r.trades[m].book.get("sell").orderID) {
+		t.Fatal()
+	}
+
+	// exchange order replaces inner one
+	order, err = r.SetExchange(ctx, m, "sell", 63000, 1, tp)
+	if !assert.NoError(t, err) || !assert.Equal(t, "o3", order.OrderID) || !assert.Len(t, r.trades[m].book.triggers, 1) {
+		t.Fatal()
+	}
+
+	_, _ = r.SetExchange(ctx, m, "buy", 50000, 1, tp)
+	if err = r.UnsetBuy(ctx, m); !assert.NoError(t, err) || !assert.Len(t, ex.orders(), 1) ||
+		!assert.Nil(t, r.trades[m].book.get("buy")) {
+		t.Fatal()
+	}
+	if err = r.CancelTrigger(ctx, m, "sell"); !assert.NoError(t, err) || !assert.Empty(t, ex.orders()) ||
+		!assert.Empty(t, r.trades[m].book.triggers) {
+		t.Fatal()
+	}
+
+	_, err = r.SetExchange(ctx, m, "sell", 60000, 1, domain.Execution{OrderType: domain.OrderLimit})
+	if !assert.EqualError(t, err, "Wrong Kraken order type or its parameters: lmt") {
+		t.Fatal()
+	}
+
+	_ = r.SetPaper(ctx, m, domain.Paper{Enabled: true})
+	_, err = r.SetExchange(ctx, m, "sell", 60000, 1, tp)
+	if !assert.EqualError(t, err, "Exchange orders aren't available in paper trading: pi_xbtusd") {
+		t.Fatal()
+	}
+}
+
+func TestRestoreExchange(t *testing.T) {
+	ctx := context.Background()
+	m := domain.Market("pi_xbtusd")
+	ex := newExchangeMock(krak)
+	rep := NewRepMock()
+	r := New(ex, rep, logger, notify)
+	r.SetMarket(ctx, m)
+	_, _ = r.SetExchange(ctx, m, "buy", 50000, 1, domain.Execution{OrderType: domain.OrderStop, TriggerSignal: "last"})
+
+	restored := New(ex, rep, logger, notify)
+	if err := restored.Restore(ctx, false); !assert.NoError(t, err) {
+		t.Fatal()
+	}
+
+	res, _ := restored.GetActive(ctx, m)
+	if !assert.Len(t, res, 1) || !assert.Equal(t, "o1", res[0].OrderID) || !assert.Equal(t, "last", res[0].TriggerSignal) {
+		t.Fatal()
+	}
+
+	// restored order is cancelled on Kraken
+	if err := restored.UnsetBuy(ctx, m); !assert.NoError(t, err) || !assert.Empty(t, ex.orders()) {
+		t.Fatal()
+	}
+}
+
+func TestCancelOnKraken(t *testing.T) {
+	ctx := context.Background()
+	m1, m2 := domain.Market("pi_xbtusd"), domain.Market("pi_bchusd")
+	ex := newExchangeMock(krak)
+	r := New(ex, NewRepMock(), logger, notify)
+	r.SetMarket(ctx, m1)
+	r.SetMarket(ctx, m2)
+
+	tp := domain.Execution{OrderType: domain.OrderTakeProfit}
+	_, _ = r.SetExchange(ctx, m1, "sell", 60000, 1, tp)
+	_, _ = r.SetExchange(ctx, m1, "buy", 50000, 1, tp)
+	_, _ = r.SetExchange(ctx, m2, "sell", 700, 1, tp)
+	_ = r.SetBuy(ctx, m2, 500, 1)
+
+	status, err := r.CancelOrder(ctx, "o1")
+	if !assert.NoError(t, err) || !assert.Equal(t, "cancelled", status.Stat) ||
+		!assert.Nil(t, r.trades[m1].book.get("sell")) || !assert.NotNil(t, r.trades[m1].book.get("buy")) {
+		t.Fatal()
+	}
+	status, err = r.CancelOrder(ctx, "o1")
+	if !assert.NoError(t, err) || !assert.Equal(t, "notFound", status.Stat) {
+		t.Fatal()
+	}
+
+	all, err := r.CancelAllOrders(ctx, m2)
+	if !assert.NoError(t, err) || !assert.Len(t, all.Orders, 1) || !assert.Nil(t, r.trades[m2].book.get("sell")) ||
+		!assert.NotNil(t, r.trades[m2].book.get("buy")) || !assert.NotNil(t, r.trades[m1].book.get("buy")) {
+		t.Fatal()
+	}
+
+	all, err = r.CancelAllOrders(ctx, "")
+	if !assert.NoError(t, err) || !assert.Len(t, all.Orders, 1) || !assert.Empty(t, ex.orders()) ||
+		!assert.Nil(t, r.trades[m1].book.get("buy")) {
+		t.Fatal()
+	}
+}
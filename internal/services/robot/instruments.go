@@ -0,0 +1,144 @@
+package robot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/cgriceld/crypto-trade-bot/internal/domain"
+)
+
+var (
+	UnknownMarket = errors.New("Unknown market")
+	NotTradeable  = errors.New("Market isn't tradeable")
+	WrongTick     = errors.New("Price isn't a multiple of tick size")
+	WrongStep     = errors.New("Size isn't a multiple of contract size step")
+	PositionLimit = errors.New("Size is out of position size limits")
+)
+
+// LoadInstruments replaces instruments markets and orders are validated with
+// by the ones listed on Kraken. Until they are loaded, any market is accepted.
+func (r *Robot) LoadInstruments(ctx context.Context) error {
+	list, err := r.kraken.Instruments(ctx)
+	if err != nil {
+		return err
+	}
+	if len(list) == 0 {
+		return nil
+	}
+
+	instruments := make(map[domain.Market]domain.Instrument, len(list))
+	for _, v := range list {
+		instruments[domain.Market(v.Symbol)] = v
+	}
+
+	r.muxInstruments.Lock()
+	r.instruments = instruments
+	r.muxInstruments.Unlock()
+
+	r.logger.Infof("%v instruments are loaded from Kraken", len(list))
+	return nil
+}
+
+// StartInstruments reloads instruments every interval until the robot is
+// closed, failures keep the previous list.
+func (r *Robot) StartInstruments(every time.Duration) {
+	r.muxInstruments.Lock()
+	if r.refresh != nil {
+		r.muxInstruments.Unlock()
+		return
+	}
+	r.refresh = make(chan struct{})
+	done := r.refresh
+	r.muxInstruments.Unlock()
+
+	ticker := time.NewTicker(every)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if err := r.LoadInstruments(context.Background()); err != nil {
+					r.logger.Warnf("StartInstruments: Fail to refresh instruments: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+func (r *Robot) stopInstruments() {
+	r.muxInstruments.Lock()
+	if r.refresh != nil {
+		close(r.refresh)
+		r.refresh = nil
+	}
+	r.muxInstruments.Unlock()
+}
+
+// instrument returns the instrument of market, ok is false if instruments
+// weren't loaded.
+func (r *Robot) instrument(m domain.Market) (v domain.Instrument, found bool, ok bool) {
+	r.muxInstruments.RLock()
+	defer r.muxInstruments.RUnlock()
+
+	if len(r.instruments) == 0 {
+		return domain.Instrument{}, false, false
+	}
+	v, found = r.instruments[m]
+
+	return v, found, true
+}
+
+// CheckMarket returns error if market isn't listed on Kraken or can't be traded.
+func (r *Robot) CheckMarket(m domain.Market) error {
+	v, found, ok := r.instrument(m)
+	if !ok {
+		return nil
+	}
+	if !found {
+		return fmt.Errorf("%v: %v", UnknownMarket, m)
+	}
+	if !v.Tradeable {
+		return fmt.Errorf("%v: %v", NotTradeable, m)
+	}
+
+	return nil
+}
+
+// checkOrder returns error if Kraken won't accept order of market with price p
+// and size s.
+func (r *Robot) checkOrder(m domain.Market, p domain.Price, s domain.Size) error {
+	if err := r.CheckMarket(m); err != nil {
+		return err
+	}
+	v, found, _ := r.instrument(m)
+	if !found {
+		return nil
+	}
+
+	switch {
+	case v.InvalidPrice(p):
+		return fmt.Errorf("%v: %v: %v", WrongTick, m, v.TickSize)
+	case v.InvalidSize(s):
+		return fmt.Errorf("%v: %v: %v", WrongStep, m, v.Step())
+	case v.PositionLimit(s):
+		return fmt.Errorf("%v: %v: %v-%v", PositionLimit, m, v.Step(), v.MaxPositionSize)
+	}
+
+	return nil
+}
+
+// roundPrice rounds price of market to its tick size, so that Kraken accepts
+// computed prices (e.g. of trailing orders). Prices are kept as is until
+// instruments are loaded.
+func (r *Robot) roundPrice(m domain.Market, p float64) float64 {
+	v, found, _ := r.instrument(m)
+	if !found {
+		return p
+	}
+
+	return v.RoundPrice(p)
+}
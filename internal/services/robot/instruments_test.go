@@ -0,0 +1,81 @@
+package robot
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cgriceld/crypto-trade-bot/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstruments(t *testing.T) {
+	ctx := context.Background()
+	m := domain.Market("pi_xbtusd")
+	ex := newExchangeMock(krak)
+	r := New(ex, NewRepMock(), logger, notify)
+
+	// any market is accepted until instruments are loaded
+	if err := r.LoadInstruments(ctx); !assert.NoError(t, err) || !assert.NoError(t, r.CheckMarket("pi_xbtsd")) {
+		t.Fatal()
+	}
+
+	ex.instruments = []domain.Instrument{
+		{Symbol: "pi_xbtusd", Tradeable: true, TickSize: 0.5, ContractSize: 1, Precision: 0, MaxPositionSize: 1000},
+		{Symbol: "pi_ethusd", Tradeable: true, TickSize: 0.05, ContractSize: 1, Precision: -1},
+		{Symbol: "pi_bchusd", Tradeable: false, TickSize: 0.1, ContractSize: 1},
+	}
+	if err := r.LoadInstruments(ctx); !assert.NoError(t, err) {
+		t.Fatal()
+	}
+	r.SetMarket(ctx, m)
+	r.SetMarket(ctx, "pi_ethusd")
+
+	tests := []struct {
+		name string
+		err  error
+		msg  string
+	}{
+		{"Unknown market", r.CheckMarket("pi_xbtsd"), "Unknown market: pi_xbtsd"},
+		{"Not tradeable", r.CheckMarket("pi_bchusd"), "Market isn't tradeable: pi_bchusd"},
+		{"Wrong tick", r.SetSell(ctx, m, 60000.3, 1), "Price isn't a multiple of tick size: pi_xbtusd: 0.5"},
+		{"Wrong step", r.SetBuy(ctx, "pi_ethusd", 4000.05, 15), "Size isn't a multiple of contract size step: pi_ethusd: 10"},
+		{"Over max size", r.SetBuy(ctx, m, 50000, 1001), "Size is out of position size limits: pi_xbtusd: 1-1000"},
+		{"Trailing", r.SetTrailing(ctx, m, "sell", domain.Trailing{Distance: 100}, 1001),
+			"Size is out of position size limits: pi_xbtusd: 1-1000"},
+		{"Added order", func() error {
+			_, err := r.AddTrigger(ctx, m, domain.Order{Typ: "buy", Price: 50000.3, Size: 1})
+			return err
+		}(), "Price isn't a multiple of tick size: pi_xbtusd: 0.5"},
+		{"Added stop order", func() error {
+			_, err := r.AddTrigger(ctx, m, domain.Order{Typ: "sell", Price: 50000, Size: 1,
+				Execution: domain.Execution{OrderType: domain.OrderStop, StopPrice: 49000.2}})
+			return err
+		}(), "Price isn't a multiple of tick size: pi_xbtusd: 0.5"},
+		{"Exchange order", func() error {
+			_, err := r.SetExchange(ctx, m, "sell", 55000.25, 1, domain.Execution{OrderType: domain.OrderStop})
+			return err
+		}(), "Price isn't a multiple of tick size: pi_xbtusd: 0.5"},
+	}
+	for _, test := range tests {
+		if !assert.EqualError(t, test.err, test.msg, test.name) {
+			t.Fatal()
+		}
+	}
+
+	if !assert.NoError(t, r.CheckMarket(m)) || !assert.NoError(t, r.SetSell(ctx, m, 60000.5, 1000)) ||
+		!assert.NoError(t, r.SetBuy(ctx, "pi_ethusd", 4000.05, 20)) {
+		t.Fatal()
+	}
+
+	// computed prices are rounded to the tick size when sent
+	orders := make(chan domain.Order, 1)
+	orders <- domain.Order{ID: "l1", Market: string(m), Typ: "buy", Price: 60000.3, Size: 1,
+		Execution: domain.Execution{OrderType: domain.OrderLimit}}
+	close(orders)
+	r.trades[m].wg.Add(1)
+	r.sendOrder(m, orders)
+	if !assert.Equal(t, 60000.5, ex.orders()["o1"].Price) {
+		t.Fatal()
+	}
+}
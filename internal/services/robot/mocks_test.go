@@ -2,43 +2,122 @@ package robot
 
 import (
 	"context"
+	"fmt"
+	"sync"
+	"time"
+
 	"github.com/cgriceld/crypto-trade-bot/internal/domain"
 
 	"github.com/cgriceld/crypto-trade-bot/pkg/log"
 )
 
 type RepMock interface {
-	SaveOrder(order domain.Order)
-	GetOrders(ctx context.Context) ([]domain.Order, error)
+	SaveOrder(ctx context.Context, order domain.Order) error
+	GetOrders(ctx context.Context, filter domain.OrderFilter) (*domain.OrdersResp, error)
+	EachOrder(ctx context.Context, filter domain.OrderFilter, fn func(domain.Order) error) error
+	SaveSettings(ctx context.Context, settings domain.MarketSettings) error
+	GetSettings(ctx context.Context) ([]domain.MarketSettings, error)
+	SaveCandle(ctx context.Context, candle domain.CandleRecord) error
+	GetCandles(ctx context.Context, filter domain.CandleFilter) ([]domain.CandleRecord, error)
 	Close()
 }
 
 type OrdersInMemory map[string]domain.Order
 
 type ordersStorage struct {
-	orders OrdersInMemory
+	orders   OrdersInMemory
+	settings map[string]domain.MarketSettings
+	candles  []domain.CandleRecord
 }
 
 func NewRepMock() RepMock {
 	return &ordersStorage{
-		orders: make(OrdersInMemory),
+		orders:   make(OrdersInMemory),
+		settings: make(map[string]domain.MarketSettings),
 	}
 }
 
-func (s *ordersStorage) SaveOrder(order domain.Order) {
+func (s *ordersStorage) SaveOrder(ctx context.Context, order domain.Order) error {
 	s.orders[order.Market] = order
+	return nil
 }
 
-func (s *ordersStorage) GetOrders(ctx context.Context) ([]domain.Order, error) {
+func (s *ordersStorage) GetOrders(ctx context.Context, filter domain.OrderFilter) (*domain.OrdersResp, error) {
 	var res []domain.Order
 
 	for _, v := range s.orders {
+		if filter.Outcome != "" && v.Outcome != filter.Outcome ||
+			filter.Market != "" && v.Market != filter.Market ||
+			filter.Side != "" && v.Typ != filter.Side {
+			continue
+		}
+		res = append(res, v)
+	}
+
+	return &domain.OrdersResp{Orders: res}, nil
+}
+
+func (s *ordersStorage) EachOrder(ctx context.Context, filter domain.OrderFilter, fn func(domain.Order) error) error {
+	res, _ := s.GetOrders(ctx, filter)
+
+	for _, v := range res.Orders {
+		if err := fn(v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *ordersStorage) SaveSettings(ctx context.Context, settings domain.MarketSettings) error {
+	s.settings[settings.Market] = settings
+	return nil
+}
+
+func (s *ordersStorage) GetSettings(ctx context.Context) ([]domain.MarketSettings, error) {
+	var res []domain.MarketSettings
+
+	for _, v := range s.settings {
 		res = append(res, v)
 	}
 
 	return res, nil
 }
 
+func (s *ordersStorage) SaveCandle(ctx context.Context, candle domain.CandleRecord) error {
+	for i, v := range s.candles {
+		if v.Market == candle.Market && v.Interval == candle.Interval && v.Time.Equal(candle.Time) {
+			s.candles[i] = candle
+			return nil
+		}
+	}
+	s.candles = append(s.candles, candle)
+	return nil
+}
+
+func (s *ordersStorage) GetCandles(ctx context.Context, filter domain.CandleFilter) ([]domain.CandleRecord, error) {
+	res := make([]domain.CandleRecord, 0)
+
+	for _, v := range s.candles {
+		if filter.Market != "" && v.Market != filter.Market ||
+			filter.Interval != "" && v.Interval != filter.Interval ||
+			filter.From != nil && v.Time.Before(*filter.From) ||
+			filter.To != nil && !v.Time.Before(*filter.To) {
+			continue
+		}
+		if filter.Desc {
+			res = append([]domain.CandleRecord{v}, res...)
+		} else {
+			res = append(res, v)
+		}
+	}
+	if filter.Limit > 0 && len(res) > filter.Limit {
+		res = res[:filter.Limit]
+	}
+
+	return res, nil
+}
+
 func (s *ordersStorage) Close() {
 }
 
@@ -68,3 +147,166 @@ func NewTgMock(logger log.Logger, id int, url string) *messStorage {
 func (tg *messStorage) Notify(m domain.Market, message string) {
 	tg.mess = append(tg.mess, message)
 }
+
+// ============================
+
+// exchangeMock places orders in memory instead of Kraken, they rest in the
+// order book until cancelled. Other calls go to Kraken.
+type exchangeMock struct {
+	Kraken
+	mux         sync.Mutex
+	seq         int
+	book        map[string]domain.Order
+	fills       []domain.Fill
+	instruments []domain.Instrument
+	// contracts of limit orders executed at once
+	partial int
+	// fills returned at once, all if 0
+	page int
+}
+
+func newExchangeMock(k Kraken) *exchangeMock {
+	return &exchangeMock{
+		Kraken: k,
+		book:   make(map[string]domain.Order),
+	}
+}
+
+func (e *exchangeMock) SendOrder(ctx context.Context, order domain.Order) (*domain.RespOrder, error) {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+
+	e.seq++
+	id := fmt.Sprintf("o%d", e.seq)
+	status := domain.SendStatus{OrderID: id, Stat: "placed"}
+	if !order.Resting() {
+		status.Events = []domain.OrderEvent{{Type: "EXECUTION", Price: order.Price, Amount: float64(order.Size)}}
+		return &domain.RespOrder{Result: "success", Status: status}, nil
+	}
+
+	if e.partial > 0 && !order.Stop() {
+		fill := domain.Fill{FillID: fmt.Sprintf("f%d", len(e.fills)+1), Symbol: order.Market, Side: order.Typ, OrderID: id,
+			Size: float64(e.partial), Price: order.Price, FillTime: time.Now().UTC().Format("2006-01-02T15:04:05.000Z")}
+		e.fills = append(e.fills, fill)
+		status.Events = []domain.OrderEvent{{Type: "EXECUTION", Price: fill.Price, Amount: fill.Size, ExecutionID: fill.FillID}}
+		order.Size -= e.partial
+	}
+	e.book[id] = order
+
+	return &domain.RespOrder{Result: "success", Status: status}, nil
+}
+
+func (e *exchangeMock) EditOrder(ctx context.Context, orderID string, order domain.Order) (*domain.RespEdit, error) {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+
+	v, ok := e.book[orderID]
+	if !ok {
+		return &domain.RespEdit{Result: "success", Status: domain.EditStatus{Stat: "orderForEditNotFound"}}, nil
+	}
+	v.Size, v.StopPrice = order.Size, order.StopPrice
+	e.book[orderID] = v
+
+	return &domain.RespEdit{Result: "success", Status: domain.EditStatus{OrderID: orderID, Stat: "edited"}}, nil
+}
+
+func (e *exchangeMock) CancelOrder(ctx context.Context, orderID string) (*domain.RespCancel, error) {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+
+	if _, ok := e.book[orderID]; !ok {
+		return &domain.RespCancel{Result: "success", Status: domain.CancelStatus{Stat: "notFound"}}, nil
+	}
+	delete(e.book, orderID)
+
+	return &domain.RespCancel{Result: "success", Status: domain.CancelStatus{OrderID: orderID, Stat: "cancelled"}}, nil
+}
+
+func (e *exchangeMock) CancelAllOrders(ctx context.Context, m domain.Market) (*domain.CancelAllStatus, error) {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+
+	res := &domain.CancelAllStatus{Stat: "cancelled"}
+	for k, v := range e.book {
+		if m == "" || v.Market == string(m) {
+			res.Orders = append(res.Orders, domain.CancelledOrder{OrderID: k})
+			delete(e.book, k)
+		}
+	}
+	if len(res.Orders) == 0 {
+		res.Stat = "noOrdersToCancel"
+	}
+
+	return res, nil
+}
+
+func (e *exchangeMock) OpenOrders(ctx context.Context) ([]domain.OpenOrder, error) {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+
+	var res []domain.OpenOrder
+	for k, v := range e.book {
+		res = append(res, domain.OpenOrder{OrderID: k, Symbol: v.Market, Side: v.Typ, UnfilledSize: float64(v.Size)})
+	}
+
+	return res, nil
+}
+
+func (e *exchangeMock) Fills(ctx context.Context, before *time.Time) ([]domain.Fill, error) {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+
+	// the latest fills before time before, newest first like Kraken
+	var res []domain.Fill
+	for i := len(e.fills) - 1; i >= 0 && (e.page == 0 || len(res) < e.page); i-- {
+		ts, _ := time.Parse(time.RFC3339, e.fills[i].FillTime)
+		if before == nil || ts.Before(*before) {
+			res = append(res, e.fills[i])
+		}
+	}
+
+	return res, nil
+}
+
+// execute fills size contracts of order with id at price, the order leaves
+// the order book when it's filled completely.
+func (e *exchangeMock) execute(id string, price float64, size int) {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+
+	v := e.book[id]
+	e.fills = append(e.fills, domain.Fill{
+		FillID:   fmt.Sprintf("f%d", len(e.fills)+1),
+		Symbol:   v.Market,
+		Side:     v.Typ,
+		OrderID:  id,
+		Size:     float64(size),
+		Price:    price,
+		FillTime: time.Now().Add(time.Duration(len(e.fills)+1) * time.Millisecond).UTC().Format("2006-01-02T15:04:05.000Z"),
+	})
+	v.Size -= size
+	if v.Size <= 0 {
+		delete(e.book, id)
+		return
+	}
+	e.book[id] = v
+}
+
+func (e *exchangeMock) Instruments(ctx context.Context) ([]domain.Instrument, error) {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+
+	return e.instruments, nil
+}
+
+func (e *exchangeMock) orders() map[string]domain.Order {
+	e.mux.Lock()
+	defer e.mux.Unlock()
+
+	res := make(map[string]domain.Order)
+	for k, v := range e.book {
+		res[k] = v
+	}
+
+	return res
+}
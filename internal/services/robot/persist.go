@@ -0,0 +1,119 @@
+package robot
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cgriceld/crypto-trade-bot/internal/domain"
+	"github.com/cgriceld/crypto-trade-bot/pkg/simulator"
+)
+
+// save persists settings of market, caller must not hold the market lock.
+// Snapshots are saved in the order they are taken.
+func (r *Robot) save(m domain.Market, v *Trade) {
+	v.muxSave.Lock()
+	v.muxTrade.RLock()
+	settings := v.settings(m)
+	v.muxTrade.RUnlock()
+
+	err := r.repo.SaveSettings(context.Background(), settings)
+	v.muxSave.Unlock()
+
+	if err != nil {
+		r.logger.Errorf("save: %v: %v", m, err)
+		r.notify.Notify(m, fmt.Sprintf("%v: %v: settings: %v", FailSaveBot, m, err))
+	}
+}
+
+func (t *Trade) settings(m domain.Market) domain.MarketSettings {
+	res := domain.MarketSettings{
+		Market:   string(m),
+		Strategy: t.strategyName,
+		OCO:      t.book.oco,
+		Feed:     t.feed,
+		Active:   t.active,
+		Seq:      t.book.seq,
+		Orders:   []domain.Order{},
+	}
+	if t.paper != nil {
+		res.Paper = &domain.Paper{Enabled: true, Slippage: t.paper.Slippage, Fee: t.paper.Fee}
+	}
+	for _, v := range t.book.triggers {
+		res.Orders = append(res.Orders, activeOrder(m, v, t.book.oco))
+	}
+
+	return res
+}
+
+func restoreTrade(m domain.Market, s domain.MarketSettings) (*Trade, error) {
+	newStrategy, ok := strategies[s.Strategy]
+	if !ok {
+		return nil, fmt.Errorf("%v: %v", UnknownStrategy, s.Strategy)
+	}
+
+	t := &Trade{
+		book:         Book{market: m, oco: s.OCO, seq: s.Seq},
+		strategy:     newStrategy(),
+		strategyName: s.Strategy,
+		feed:         s.Feed,
+	}
+	if s.Paper != nil && s.Paper.Enabled {
+		t.paper = &simulator.Executor{Slippage: s.Paper.Slippage, Fee: s.Paper.Fee}
+	}
+
+	for _, order := range s.Orders {
+		trigger, err := newTrigger(order)
+		if err != nil {
+			return nil, err
+		}
+		// keep tracking from the best price seen before restart
+		if order.Trailing != nil {
+			trigger.trail.Best = order.Trailing.Best
+		}
+		t.book.put(trigger)
+	}
+
+	return t, nil
+}
+
+// Restore loads persisted settings of markets. If resume is set, markets
+// which were running at shutdown are started again.
+func (r *Robot) Restore(ctx context.Context, resume bool) error {
+	settings, err := r.repo.GetSettings(ctx)
+	if err != nil {
+		return fmt.Errorf("Fail to load settings: %w", err)
+	}
+
+	var running []domain.Market
+	for _, s := range settings {
+		m := domain.Market(s.Market)
+		t, err := restoreTrade(m, s)
+		if err != nil {
+			r.logger.Errorf("Restore: %v: %v", m, err)
+			continue
+		}
+
+		r.muxAll.Lock()
+		r.trades[m] = t
+		r.muxAll.Unlock()
+		r.logger.Infof("Restore: %v: %v orders", m, len(s.Orders))
+
+		if s.Active {
+			running = append(running, m)
+		}
+	}
+
+	for _, m := range running {
+		if !resume {
+			r.save(m, r.trades[m])
+			continue
+		}
+
+		if _, err := r.StartMarket(ctx, m); err != nil {
+			r.logger.Errorf("Restore: %v: Fail to resume: %v", m, err)
+			r.notify.Notify(m, fmt.Sprintf("%v: %v: %v", FailResumeBot, m, err))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,71 @@
+package robot
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cgriceld/crypto-trade-bot/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRestore(t *testing.T) {
+	ctx := context.Background()
+	m := domain.Market("pi_xbtusd")
+	rep := NewRepMock()
+
+	r := New(krak, rep, logger, notify)
+	r.SetMarket(ctx, m)
+	_ = r.SetSell(ctx, m, domain.Price(60000), domain.Size(1))
+	_, _ = r.AddTrigger(ctx, m, domain.Order{Typ: "buy", Size: 2, Conditions: []string{"rsi(14) < 30"}})
+	_, _ = r.AddTrigger(ctx, m, domain.Order{ID: "trail", Typ: "sell", Size: 1, Trailing: &domain.Trailing{Distance: 2, Percent: true}})
+	_ = r.CancelTrigger(ctx, m, "sell")
+	_ = r.SetOCO(ctx, m, true)
+	_ = r.SetStrategy(ctx, m, "breakout")
+	_ = r.SetPaper(ctx, m, domain.Paper{Enabled: true, Fee: 0.05})
+	_ = r.SetFeed(ctx, m, domain.Feed{Interval: "5m", Source: "close"})
+	_ = r.algo(m, domain.Candle{}, flat(50000))
+
+	// the robot was running at shutdown
+	r.trades[m].active = true
+	r.save(m, r.trades[m])
+
+	restored := New(krak, rep, logger, notify)
+	if err := restored.Restore(ctx, false); !assert.NoError(t, err) {
+		t.Fatal()
+	}
+
+	exp, _ := r.GetActive(ctx, m)
+	res, _ := restored.GetActive(ctx, m)
+	if !assert.Equal(t, exp, res) {
+		t.Fatal()
+	}
+
+	v := restored.trades[m]
+	if !assert.Equal(t, "breakout", v.strategyName) || !assert.Equal(t, &threshold{breakout: true}, v.strategy) ||
+		!assert.Equal(t, r.trades[m].paper, v.paper) || !assert.False(t, v.active) {
+		t.Fatal()
+	}
+
+	// not resumed markets are saved as stopped
+	settings, _ := rep.GetSettings(ctx)
+	if !assert.Len(t, settings, 1) || !assert.False(t, settings[0].Active) {
+		t.Fatal()
+	}
+
+	// generated IDs continue after restart
+	order, _ := restored.AddTrigger(ctx, m, domain.Order{Typ: "buy", Price: 40000, Size: 1})
+	if !assert.Equal(t, "2", order.ID) {
+		t.Fatal()
+	}
+}
+
+func TestRestoreUnknownStrategy(t *testing.T) {
+	rep := NewRepMock()
+	rep.SaveSettings(context.Background(), domain.MarketSettings{Market: "pi_ethusd", Strategy: "martingale"})
+
+	r := New(krak, rep, logger, notify)
+	if err := r.Restore(context.Background(), true); !assert.NoError(t, err) || !assert.Empty(t, r.trades) {
+		t.Fatal()
+	}
+}
@@ -0,0 +1,326 @@
+package robot
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cgriceld/crypto-trade-bot/internal/domain"
+)
+
+const (
+	SummaryBot = "📊 Daily summary"
+)
+
+// position is a net position of market built from executed orders.
+// Positive size is long, negative is short.
+type position struct {
+	size     int
+	avg      float64
+	realized float64
+	fees     float64
+	last     float64
+	trades   int
+	contract contract
+}
+
+// contract tells how PnL of market is computed: inverse contracts realize
+// size*value*(1/entry - 1/exit) in the base coin, linear ones
+// size*value*(exit - entry) in USD. Zero contract is linear one of value 1.
+type contract struct {
+	inverse  bool
+	value    float64
+	currency string
+}
+
+// pnl returns PnL of size contracts (negative for short) opened at entry and
+// closed at exit.
+func (c contract) pnl(size float64, entry float64, exit float64) float64 {
+	value := c.value
+	if value == 0 {
+		value = 1
+	}
+	if !c.inverse {
+		return size * value * (exit - entry)
+	}
+	if entry == 0 || exit == 0 {
+		return 0
+	}
+
+	return size * value * (1/entry - 1/exit)
+}
+
+// apply adds executed order to the position. Closing part of the order
+// realizes PnL against the average entry price, the rest opens (or extends)
+// the position and moves the average entry.
+func (p *position) apply(order domain.Order) {
+	qty := order.Size
+	if order.Typ == "sell" {
+		qty = -qty
+	}
+
+	if p.size != 0 && (p.size > 0) != (qty > 0) {
+		closed := min(abs(qty), abs(p.size))
+		sign := 1.0
+		if p.size < 0 {
+			sign = -1
+		}
+		p.realized += p.contract.pnl(sign*float64(closed), p.avg, order.Price)
+
+		p.size += qty
+		switch {
+		case p.size == 0:
+			p.avg = 0
+		case (p.size > 0) == (qty > 0):
+			// position flipped, the rest is opened at the order price
+			p.avg = order.Price
+		}
+	} else {
+		p.avg = (p.avg*float64(abs(p.size)) + order.Price*float64(abs(qty))) / float64(abs(p.size)+abs(qty))
+		p.size += qty
+	}
+
+	p.fees += order.Fee
+	p.trades++
+	if p.last == 0 {
+		p.last = order.Price
+	}
+}
+
+// unrealized returns PnL of the open position marked at the last price.
+func (p *position) unrealized() float64 {
+	if p.size == 0 {
+		return 0
+	}
+	return p.contract.pnl(float64(p.size), p.avg, p.last)
+}
+
+func (p *position) report(m domain.Market, paper bool) domain.Position {
+	return domain.Position{
+		Market:      string(m),
+		Paper:       paper,
+		Size:        p.size,
+		AvgPrice:    round(p.avg),
+		LastPrice:   round(p.last),
+		Realized:    round(p.realized),
+		Unrealized:  round(p.unrealized()),
+		Fees:        round(p.fees),
+		Trades:      p.trades,
+		PnLCurrency: p.contract.currency,
+	}
+}
+
+// contract returns contract of market by its instrument. Until instruments
+// are loaded, pi_ and fi_ markets are taken for inverse ones.
+func (r *Robot) contract(m domain.Market) contract {
+	c := contract{value: 1, currency: "USD"}
+	if v, found, _ := r.instrument(m); found {
+		c.inverse = v.Inverse()
+		if v.ContractSize > 0 {
+			c.value = v.ContractSize
+		}
+	} else {
+		c.inverse = strings.HasPrefix(string(m), "pi_") || strings.HasPrefix(string(m), "fi_")
+	}
+	if c.inverse {
+		// pi_xbtusd and fi_xbtusd_211231 are settled in XBT
+		parts := strings.SplitN(strings.ToLower(string(m)), "_", 3)
+		symbol := parts[len(parts)-1]
+		if len(parts) > 1 {
+			symbol = parts[1]
+		}
+		c.currency = strings.ToUpper(strings.TrimSuffix(symbol, "usd"))
+	}
+
+	return c
+}
+
+// position returns position of real or paper orders, paper fills never
+// change the real position.
+func (t *Trade) position(paper bool) *position {
+	if paper {
+		return &t.paperPos
+	}
+	return &t.pos
+}
+
+// track updates position of market with executed order.
+func (r *Robot) track(m domain.Market, order domain.Order) {
+	c := r.contract(m)
+	r.trades[m].muxTrade.Lock()
+	p := r.trades[m].position(order.Paper)
+	p.contract = c
+	p.apply(order)
+	r.trades[m].muxTrade.Unlock()
+}
+
+// Tracker builds position of market from executed orders outside of
+// the robot (e.g. in backtest) with the same contract and PnL as Positions.
+type Tracker struct {
+	market domain.Market
+	pos    position
+}
+
+// Tracker returns an empty position tracker of market.
+func (r *Robot) Tracker(m domain.Market) *Tracker {
+	return &Tracker{market: m, pos: position{contract: r.contract(m)}}
+}
+
+// Apply adds executed order to the position.
+func (t *Tracker) Apply(order domain.Order) {
+	t.pos.apply(order)
+}
+
+// Mark returns the position marked at price.
+func (t *Tracker) Mark(price float64) domain.Position {
+	t.pos.last = price
+	return t.pos.report(t.market, false)
+}
+
+// Positions returns positions of markets with at least one executed order,
+// paper positions are reported separately after the real ones.
+func (r *Robot) Positions(ctx context.Context) []domain.Position {
+	res := make([]domain.Position, 0)
+
+	r.muxAll.RLock()
+	for m, v := range r.trades {
+		v.muxTrade.RLock()
+		for _, paper := range []bool{false, true} {
+			if p := v.position(paper); p.trades > 0 {
+				res = append(res, p.report(m, paper))
+			}
+		}
+		v.muxTrade.RUnlock()
+	}
+	r.muxAll.RUnlock()
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Market != res[j].Market {
+			return res[i].Market < res[j].Market
+		}
+		return !res[i].Paper && res[j].Paper
+	})
+
+	return res
+}
+
+// ExportOrders passes executed orders of time range, market and side of filter
+// to fn in time order with PnL every order realized. PnL is computed from
+// the first order of market, so orders before the time range and of the other
+// side are read but not passed. Paper orders realize PnL against paper ones only.
+func (r *Robot) ExportOrders(ctx context.Context, filter domain.OrderFilter, fn func(domain.TradeRecord) error) error {
+	type key struct {
+		market string
+		paper  bool
+	}
+	from := filter.From
+	positions := make(map[key]*position)
+
+	query := domain.OrderFilter{Outcome: domain.OrderPlaced, Market: filter.Market, To: filter.To}
+	return r.repo.EachOrder(ctx, query, func(o domain.Order) error {
+		k := key{o.Market, o.Paper}
+		p, ok := positions[k]
+		if !ok {
+			p = &position{contract: r.contract(domain.Market(o.Market))}
+			positions[k] = p
+		}
+		realized := p.realized
+		p.apply(o)
+
+		if from != nil && o.Time != nil && o.Time.Before(*from) || filter.Side != "" && o.Typ != filter.Side {
+			return nil
+		}
+
+		return fn(domain.TradeRecord{
+			Time:        o.Time,
+			OrderID:     o.OrderID,
+			Market:      o.Market,
+			Side:        o.Typ,
+			Price:       o.Price,
+			Size:        o.Size,
+			Fee:         o.Fee,
+			Realized:    round(p.realized - realized),
+			Paper:       o.Paper,
+			PnLCurrency: p.contract.currency,
+		})
+	})
+}
+
+// StartSummary sends positions summary to Telegram every interval until the
+// robot is closed.
+func (r *Robot) StartSummary(every time.Duration) {
+	r.muxAll.Lock()
+	if r.summary != nil {
+		r.muxAll.Unlock()
+		return
+	}
+	r.summary = make(chan struct{})
+	done := r.summary
+	r.muxAll.Unlock()
+
+	ticker := time.NewTicker(every)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				r.notify.Notify("", r.summaryMessage(context.Background()))
+			}
+		}
+	}()
+}
+
+func (r *Robot) stopSummary() {
+	r.muxAll.Lock()
+	if r.summary != nil {
+		close(r.summary)
+		r.summary = nil
+	}
+	r.muxAll.Unlock()
+}
+
+func (r *Robot) summaryMessage(ctx context.Context) string {
+	positions := r.Positions(ctx)
+	if len(positions) == 0 {
+		return fmt.Sprintf("%v: no trades", SummaryBot)
+	}
+
+	var b strings.Builder
+	b.WriteString(SummaryBot)
+	// PnL of inverse contracts is a fraction of coin
+	pnl := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	for _, p := range positions {
+		market := p.Market
+		if p.Paper {
+			market += " (paper)"
+		}
+		fmt.Fprintf(&b, "\n%v: position %d @ %.2f, last %.2f, realized %v %v, unrealized %v %v, fees %.2f",
+			market, p.Size, p.AvgPrice, p.LastPrice, pnl(p.Realized), p.PnLCurrency, pnl(p.Unrealized), p.PnLCurrency, p.Fees)
+	}
+
+	return b.String()
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func min(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func round(v float64) float64 {
+	return math.Round(v*1e8) / 1e8
+}
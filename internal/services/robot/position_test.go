@@ -0,0 +1,162 @@
+package robot
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cgriceld/crypto-trade-bot/internal/domain"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPositionApply(t *testing.T) {
+	tests := []struct {
+		name     string
+		contract contract
+		orders   []domain.Order
+		last     float64
+		exp      domain.Position
+	}{
+		{"Open long", contract{}, []domain.Order{
+			{Typ: "buy", Price: 100, Size: 2, Fee: 1},
+			{Typ: "buy", Price: 130, Size: 1, Fee: 1},
+		}, 120, domain.Position{Market: "pi_ethusd", Size: 3, AvgPrice: 110, LastPrice: 120,
+			Unrealized: 30, Fees: 2, Trades: 2}},
+		{"Partial close", contract{}, []domain.Order{
+			{Typ: "buy", Price: 100, Size: 3},
+			{Typ: "sell", Price: 110, Size: 1},
+		}, 90, domain.Position{Market: "pi_ethusd", Size: 2, AvgPrice: 100, LastPrice: 90,
+			Realized: 10, Unrealized: -20, Trades: 2}},
+		{"Close short", contract{}, []domain.Order{
+			{Typ: "sell", Price: 100, Size: 2},
+			{Typ: "buy", Price: 90, Size: 2},
+		}, 95, domain.Position{Market: "pi_ethusd", LastPrice: 95, Realized: 20, Trades: 2}},
+		{"Flip", contract{}, []domain.Order{
+			{Typ: "buy", Price: 100, Size: 1},
+			{Typ: "sell", Price: 120, Size: 3},
+		}, 110, domain.Position{Market: "pi_ethusd", Size: -2, AvgPrice: 120, LastPrice: 110,
+			Realized: 20, Unrealized: 20, Trades: 2}},
+		{"Inverse", contract{inverse: true, value: 1, currency: "XBT"}, []domain.Order{
+			{Typ: "buy", Price: 50000, Size: 2},
+			{Typ: "sell", Price: 62500, Size: 1},
+		}, 40000, domain.Position{Market: "pi_ethusd", Size: 1, AvgPrice: 50000, LastPrice: 40000,
+			Realized: 0.000004, Unrealized: -0.000005, Trades: 2, PnLCurrency: "XBT"}},
+	}
+
+	for _, test := range tests {
+		p := position{contract: test.contract}
+		for _, order := range test.orders {
+			p.apply(order)
+		}
+		p.last = test.last
+
+		res := p.report("pi_ethusd", false)
+		if !assert.Equal(t, test.exp, res, "%v: Expect: %v, Got: %v", test.name, test.exp, res) {
+			t.Fatal()
+		}
+	}
+}
+
+func TestPositions(t *testing.T) {
+	r := New(krak, NewRepMock(), logger, notify)
+	r.SetMarket(context.Background(), "pi_xbtusd")
+	r.SetMarket(context.Background(), "pi_ethusd")
+
+	if !assert.Equal(t, []domain.Position{}, r.Positions(context.Background())) ||
+		!assert.Equal(t, SummaryBot+": no trades", r.summaryMessage(context.Background())) {
+		t.Fatal()
+	}
+
+	r.processOrder(&testResp[3], "pi_xbtusd", domain.Order{Market: "pi_xbtusd", Typ: "buy", Price: 50000, Size: 2})
+	r.processOrder(&testResp[3], "pi_xbtusd", domain.Order{Market: "pi_xbtusd", Typ: "sell", Price: 52000, Size: 1, Paper: true})
+	r.algo("pi_xbtusd", domain.Candle{}, flat(51000))
+
+	// pi_ contracts are inverse, PnL is in the base coin, paper fills are
+	// kept apart from the real position
+	exp := []domain.Position{
+		{Market: "pi_xbtusd", Size: 2, AvgPrice: 50000, LastPrice: 51000, Unrealized: 0.00000078, Trades: 1, PnLCurrency: "XBT"},
+		{Market: "pi_xbtusd", Size: -1, AvgPrice: 52000, LastPrice: 51000, Unrealized: 0.00000038, Trades: 1, PnLCurrency: "XBT",
+			Paper: true},
+	}
+	res := r.Positions(context.Background())
+	summary := r.summaryMessage(context.Background())
+	if !assert.Equal(t, exp, res, "%v: Expect: %v, Got: %v", "positions", exp, res) ||
+		!assert.True(t, strings.Contains(summary, "pi_xbtusd: position 2 @ 50000.00, last 51000.00, realized 0 XBT, unrealized 0.00000078 XBT")) ||
+		!assert.True(t, strings.Contains(summary, "pi_xbtusd (paper): position -1 @ 52000.00")) {
+		t.Fatal()
+	}
+}
+
+// ledger keeps all orders in memory in the order they were saved.
+type ledger struct {
+	RepMock
+	orders []domain.Order
+}
+
+func (l *ledger) EachOrder(ctx context.Context, filter domain.OrderFilter, fn func(domain.Order) error) error {
+	for _, v := range l.orders {
+		if filter.Market != "" && v.Market != filter.Market || filter.Outcome != "" && v.Outcome != filter.Outcome {
+			continue
+		}
+		if err := fn(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestExportOrders(t *testing.T) {
+	ts := func(h int) *time.Time {
+		v := time.Date(2021, 12, 1, h, 0, 0, 0, time.UTC)
+		return &v
+	}
+	rep := &ledger{RepMock: NewRepMock(), orders: []domain.Order{
+		{Time: ts(10), Market: "pf_ethusd", Typ: "buy", Price: 100, Size: 2, Outcome: domain.OrderPlaced},
+		{Time: ts(11), Market: "pi_xbtusd", Typ: "sell", Price: 50000, Size: 1, Outcome: domain.OrderPlaced},
+		{Time: ts(11), Market: "pf_ethusd", Typ: "sell", Price: 200, Size: 2, Paper: true, Outcome: domain.OrderPlaced},
+		{Time: ts(12), Market: "pf_ethusd", Typ: "sell", Price: 110, Size: 1, Fee: 0.5, Outcome: domain.OrderPlaced},
+		{Time: ts(13), Market: "pf_ethusd", Typ: "sell", Price: 120, Size: 1, Outcome: domain.OrderRejected},
+		{Time: ts(14), Market: "pf_ethusd", Typ: "sell", Price: 90, Size: 2, Outcome: domain.OrderPlaced},
+		{Time: ts(15), Market: "pf_ethusd", Typ: "buy", Price: 150, Size: 2, Paper: true, Outcome: domain.OrderPlaced},
+	}}
+	r := New(krak, rep, logger, notify)
+
+	tests := []struct {
+		name   string
+		filter domain.OrderFilter
+		exp    []domain.TradeRecord
+	}{
+		{"All", domain.OrderFilter{}, []domain.TradeRecord{
+			{Time: ts(10), Market: "pf_ethusd", Side: "buy", Price: 100, Size: 2, PnLCurrency: "USD"},
+			{Time: ts(11), Market: "pi_xbtusd", Side: "sell", Price: 50000, Size: 1, PnLCurrency: "XBT"},
+			{Time: ts(11), Market: "pf_ethusd", Side: "sell", Price: 200, Size: 2, PnLCurrency: "USD", Paper: true},
+			{Time: ts(12), Market: "pf_ethusd", Side: "sell", Price: 110, Size: 1, Fee: 0.5, Realized: 10, PnLCurrency: "USD"},
+			{Time: ts(14), Market: "pf_ethusd", Side: "sell", Price: 90, Size: 2, Realized: -10, PnLCurrency: "USD"},
+			{Time: ts(15), Market: "pf_ethusd", Side: "buy", Price: 150, Size: 2, Realized: 100, PnLCurrency: "USD", Paper: true},
+		}},
+		{"From keeps PnL", domain.OrderFilter{Market: "pf_ethusd", From: ts(12)}, []domain.TradeRecord{
+			{Time: ts(12), Market: "pf_ethusd", Side: "sell", Price: 110, Size: 1, Fee: 0.5, Realized: 10, PnLCurrency: "USD"},
+			{Time: ts(14), Market: "pf_ethusd", Side: "sell", Price: 90, Size: 2, Realized: -10, PnLCurrency: "USD"},
+			{Time: ts(15), Market: "pf_ethusd", Side: "buy", Price: 150, Size: 2, Realized: 100, PnLCurrency: "USD", Paper: true},
+		}},
+		{"Side keeps PnL", domain.OrderFilter{Market: "pf_ethusd", Side: "sell"}, []domain.TradeRecord{
+			{Time: ts(11), Market: "pf_ethusd", Side: "sell", Price: 200, Size: 2, PnLCurrency: "USD", Paper: true},
+			{Time: ts(12), Market: "pf_ethusd", Side: "sell", Price: 110, Size: 1, Fee: 0.5, Realized: 10, PnLCurrency: "USD"},
+			{Time: ts(14), Market: "pf_ethusd", Side: "sell", Price: 90, Size: 2, Realized: -10, PnLCurrency: "USD"},
+		}},
+	}
+
+	for _, test := range tests {
+		var res []domain.TradeRecord
+		err := r.ExportOrders(context.Background(), test.filter, func(v domain.TradeRecord) error {
+			res = append(res, v)
+			return nil
+		})
+
+		if !assert.NoError(t, err, test.name) ||
+			!assert.Equal(t, test.exp, res, "%v: Expect: %v, Got: %v", test.name, test.exp, res) {
+			t.Fatal()
+		}
+	}
+}
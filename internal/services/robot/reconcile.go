@@ -0,0 +1,257 @@
+package robot
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/cgriceld/crypto-trade-bot/internal/domain"
+)
+
+const CancelledExchangeBot = "📌 Order was cancelled on Kraken"
+
+// StartReconcile checks orders resting on Kraken every interval until
+// the robot is closed, see Reconcile.
+func (r *Robot) StartReconcile(every time.Duration) {
+	r.muxAll.Lock()
+	if r.polling != nil {
+		r.muxAll.Unlock()
+		return
+	}
+	r.polling = make(chan struct{})
+	done := r.polling
+	r.muxAll.Unlock()
+
+	ticker := time.NewTicker(every)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				r.Reconcile(context.Background())
+			}
+		}
+	}()
+}
+
+func (r *Robot) stopReconcile() {
+	r.muxAll.Lock()
+	if r.polling != nil {
+		close(r.polling)
+		r.polling = nil
+	}
+	r.muxAll.Unlock()
+}
+
+// Reconcile records fills of orders resting on Kraken in the ledger and
+// position of their markets and removes orders which are no longer open.
+// Failures are logged, orders are checked again next time.
+func (r *Robot) Reconcile(ctx context.Context) {
+	r.muxAll.RLock()
+	trades := make(map[domain.Market]*Trade, len(r.trades))
+	for m, v := range r.trades {
+		trades[m] = v
+	}
+	r.muxAll.RUnlock()
+
+	for m, v := range trades {
+		v.muxExchange.Lock()
+		if err := r.reconcile(ctx, m, v); err != nil {
+			r.logger.Warnf("Reconcile: %v: %v", m, err)
+		}
+		v.muxExchange.Unlock()
+	}
+}
+
+// reconcile checks orders of market resting on Kraken against its open orders
+// and fills. Executed order of OCO market cancels the opposite orders. Caller
+// must hold muxExchange of the market.
+func (r *Robot) reconcile(ctx context.Context, m domain.Market, v *Trade) error {
+	v.muxTrade.RLock()
+	resting := v.book.resting()
+	v.muxTrade.RUnlock()
+
+	if len(resting) == 0 {
+		return nil
+	}
+
+	// open orders go first, so that orders executed in between are in fills
+	open, err := r.kraken.OpenOrders(ctx)
+	if err != nil {
+		return err
+	}
+	fills, err := r.fills(ctx, placedSince(resting))
+	if err != nil {
+		return err
+	}
+
+	isOpen := make(map[string]bool, len(open))
+	for _, o := range open {
+		isOpen[o.OrderID] = true
+	}
+
+	var changed bool
+	for _, t := range resting {
+		executed := r.settle(m, v, t, fills)
+
+		v.muxTrade.Lock()
+		left := t.size
+		done := !isOpen[t.orderID] || left <= 0
+		if done {
+			v.book.drop(t)
+		}
+		oco := v.book.oco
+		v.muxTrade.Unlock()
+
+		if !done {
+			continue
+		}
+		changed = true
+
+		if left > 0 && executed == 0 {
+			r.logger.Warnf("reconcile: %v: %v %v order %v is cancelled on Kraken", m, t.exec.Kind(), t.typ, t.orderID)
+			r.notify.Notify(m, fmt.Sprintf("%v: %v: %v %v order", CancelledExchangeBot, m, t.exec.Kind(), t.typ))
+			continue
+		}
+		r.logger.Infof("%v %v order %v on %v is executed", t.exec.Kind(), t.typ, t.orderID, m)
+		if executed > 0 && oco && r.cancelLinked(ctx, m, v, opposite(t.typ)) > 0 {
+			r.logger.Infof("%v: %v orders cancelled by OCO", m, opposite(t.typ))
+			r.notify.Notify(m, fmt.Sprintf("%v: %v: %v", CancelOCOBot, m, opposite(t.typ)))
+		}
+	}
+
+	if changed {
+		r.save(m, v)
+	}
+
+	return nil
+}
+
+// placedSince returns the time the oldest of triggers was placed on Kraken,
+// nil if it's unknown for all of them.
+func placedSince(triggers []*Trigger) *time.Time {
+	var res *time.Time
+	for _, t := range triggers {
+		if t.placed != nil && (res == nil || t.placed.Before(*res)) {
+			res = t.placed
+		}
+	}
+
+	return res
+}
+
+// fills returns fills of the account on Kraken back to time since. Kraken
+// returns a limited number of the latest fills, so older ones are paged with
+// lastFillTime until a page starts before since. Without since only
+// the latest fills are returned.
+func (r *Robot) fills(ctx context.Context, since *time.Time) ([]domain.Fill, error) {
+	var res []domain.Fill
+	var before *time.Time
+	seen := make(map[string]bool)
+	for {
+		page, err := r.kraken.Fills(ctx, before)
+		if err != nil {
+			return nil, err
+		}
+
+		var oldest *time.Time
+		for _, f := range page {
+			if !seen[f.FillID] {
+				seen[f.FillID] = true
+				res = append(res, f)
+			}
+			if ts, err := time.Parse(time.RFC3339, f.FillTime); err == nil && (oldest == nil || ts.Before(*oldest)) {
+				oldest = &ts
+			}
+		}
+
+		// a page without progress is the last one as well
+		if since == nil || oldest == nil || oldest.Before(*since) || before != nil && !oldest.Before(*before) {
+			return res, nil
+		}
+		before = oldest
+	}
+}
+
+// settle records fills of resting order t which aren't in the ledger yet,
+// oldest first, and returns the executed size. Every fill is recorded as
+// an executed order with the fill ID as client order ID.
+func (r *Robot) settle(m domain.Market, v *Trade, t *Trigger, fills []domain.Fill) domain.Size {
+	v.muxTrade.RLock()
+	recorded := make(map[string]bool, len(t.fills))
+	for _, id := range t.fills {
+		recorded[id] = true
+	}
+	v.muxTrade.RUnlock()
+
+	var fresh []domain.Fill
+	for _, f := range fills {
+		if f.OrderID == t.orderID && !recorded[f.FillID] {
+			fresh = append(fresh, f)
+		}
+	}
+	sort.Slice(fresh, func(i, j int) bool { return fresh[i].FillTime < fresh[j].FillTime })
+
+	var executed domain.Size
+	for _, f := range fresh {
+		v.muxTrade.Lock()
+		order := domain.Order{
+			ID:           t.id,
+			Market:       string(m),
+			Typ:          t.typ,
+			Price:        float64(t.price),
+			Size:         int(t.size),
+			Execution:    t.exec,
+			ClientID:     f.FillID,
+			TriggerPrice: float64(t.price),
+		}
+		t.fills = append(t.fills, f.FillID)
+		t.size -= domain.Size(f.Size)
+		v.muxTrade.Unlock()
+
+		now := time.Now()
+		order.Time = &now
+		resp := &domain.RespOrder{
+			Result: "success",
+			Status: domain.SendStatus{
+				OrderID:  t.orderID,
+				Stat:     "placed",
+				Received: f.FillTime,
+				Events:   []domain.OrderEvent{{Type: "EXECUTION", Price: f.Price, Amount: f.Size, ExecutionID: f.FillID}},
+			},
+		}
+		r.processOrder(resp, m, order)
+		executed += domain.Size(f.Size)
+	}
+
+	return executed
+}
+
+// cancelLinked cancels orders of type typ linked by OCO, exchange ones are
+// cancelled on Kraken. It returns the number of cancelled orders. Caller must
+// hold muxExchange of the market.
+func (r *Robot) cancelLinked(ctx context.Context, m domain.Market, v *Trade, typ string) int {
+	v.muxTrade.Lock()
+	n := v.book.cancel(typ)
+	legs := v.book.exchange(typ)
+	v.muxTrade.Unlock()
+
+	for _, t := range legs {
+		if err := r.cancelExchange(ctx, m, t); err != nil {
+			r.logger.Errorf("cancelLinked: %v: %v: %v", m, t.orderID, err)
+			continue
+		}
+		v.muxTrade.Lock()
+		v.book.drop(t)
+		v.muxTrade.Unlock()
+		n++
+	}
+	if len(legs) > 0 {
+		r.save(m, v)
+	}
+
+	return n
+}
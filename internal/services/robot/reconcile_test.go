@@ -0,0 +1,135 @@
+package robot
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cgriceld/crypto-trade-bot/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReconcile(t *testing.T) {
+	ctx := context.Background()
+	m := domain.Market("pi_xbtusd")
+	ex := newExchangeMock(krak)
+	rep := NewRepMock()
+	r := New(ex, rep, logger, notify)
+	r.SetMarket(ctx, m)
+	_ = r.SetOCO(ctx, m, true)
+
+	_, _ = r.SetExchange(ctx, m, "sell", 60000, 2, domain.Execution{OrderType: domain.OrderTakeProfit})
+	_, _ = r.SetExchange(ctx, m, "buy", 50000, 1, domain.Execution{OrderType: domain.OrderStop})
+
+	// partial fill is recorded once, the rest keeps resting
+	ex.execute("o1", 60000, 1)
+	r.Reconcile(ctx)
+	r.Reconcile(ctx)
+	page, _ := rep.GetOrders(ctx, domain.OrderFilter{})
+	sell := r.trades[m].book.get("sell")
+	if !assert.NotNil(t, sell) || !assert.Equal(t, domain.Size(1), sell.size) || !assert.Equal(t, []string{"f1"}, sell.fills) ||
+		!assert.Len(t, page.Orders, 1) || !assert.Equal(t, "f1", page.Orders[0].ClientID) ||
+		!assert.Equal(t, domain.OrderPlaced, page.Orders[0].Outcome) || !assert.Equal(t, 1, page.Orders[0].Size) ||
+		!assert.Equal(t, -1, r.Positions(ctx)[0].Size) {
+		t.Fatal()
+	}
+
+	// executed order cancels the linked one on Kraken
+	ex.execute("o1", 60010, 1)
+	r.Reconcile(ctx)
+	if !assert.Empty(t, r.trades[m].book.triggers) || !assert.Empty(t, ex.orders()) ||
+		!assert.Equal(t, -2, r.Positions(ctx)[0].Size) {
+		t.Fatal()
+	}
+
+	// order cancelled outside of the robot is removed
+	_, _ = r.SetExchange(ctx, m, "buy", 50000, 1, domain.Execution{OrderType: domain.OrderStop})
+	_, _ = ex.CancelOrder(ctx, "o3")
+	r.Reconcile(ctx)
+	if !assert.Empty(t, r.trades[m].book.triggers) || !assert.Equal(t, -2, r.Positions(ctx)[0].Size) {
+		t.Fatal()
+	}
+
+	// executed order is replaced instead of edited
+	_, _ = r.SetExchange(ctx, m, "buy", 50000, 1, domain.Execution{OrderType: domain.OrderStop})
+	ex.execute("o4", 50000, 1)
+	order, err := r.SetExchange(ctx, m, "buy", 49000, 1, domain.Execution{OrderType: domain.OrderStop})
+	if !assert.NoError(t, err) || !assert.Equal(t, "o5", order.OrderID) || !assert.Equal(t, -1, r.Positions(ctx)[0].Size) {
+		t.Fatal()
+	}
+
+	// inner order cancels linked exchange order on Kraken
+	_ = r.SetSell(ctx, m, 60000, 1)
+	if res := r.algo(m, domain.Candle{}, flat(61000)); !assert.Len(t, res, 1) || !assert.Empty(t, ex.orders()) ||
+		!assert.Empty(t, r.trades[m].book.triggers) {
+		t.Fatal()
+	}
+}
+
+func TestReconcilePages(t *testing.T) {
+	ctx := context.Background()
+	m := domain.Market("pi_xbtusd")
+	ex := newExchangeMock(krak)
+	ex.page = 1
+	r := New(ex, NewRepMock(), logger, notify)
+	r.SetMarket(ctx, m)
+
+	_, _ = r.SetExchange(ctx, m, "sell", 60000, 3, domain.Execution{OrderType: domain.OrderTakeProfit})
+
+	// fills of the order are older than the latest page
+	for i := 0; i < 3; i++ {
+		ex.execute("o1", 60000, 1)
+	}
+	r.Reconcile(ctx)
+	if !assert.Empty(t, r.trades[m].book.triggers) || !assert.Equal(t, -3, r.Positions(ctx)[0].Size) {
+		t.Fatal()
+	}
+}
+
+func TestKeepResting(t *testing.T) {
+	ctx := context.Background()
+	m := domain.Market("pi_xbtusd")
+	ex := newExchangeMock(krak)
+	r := New(ex, NewRepMock(), logger, notify)
+	r.SetMarket(ctx, m)
+
+	send := func(order domain.Order) {
+		orders := make(chan domain.Order, 1)
+		orders <- order
+		close(orders)
+		r.trades[m].wg.Add(1)
+		r.sendOrder(m, orders)
+	}
+
+	send(domain.Order{ID: "l1", Market: string(m), Typ: "buy", Price: 100, Size: 4,
+		Execution: domain.Execution{OrderType: domain.OrderLimit}})
+	l1 := r.trades[m].book.get("l1")
+	if !assert.NotNil(t, l1) || !assert.Equal(t, "o1", l1.orderID) || !assert.Equal(t, domain.Size(4), l1.size) ||
+		!assert.Empty(t, r.Positions(ctx)) {
+		t.Fatal()
+	}
+
+	// the executed part is recorded once
+	ex.partial = 3
+	send(domain.Order{ID: "l2", Market: string(m), Typ: "buy", Price: 100, Size: 4,
+		Execution: domain.Execution{OrderType: domain.OrderPost}})
+	r.Reconcile(ctx)
+	l2 := r.trades[m].book.get("l2")
+	if !assert.NotNil(t, l2) || !assert.Equal(t, domain.Size(1), l2.size) || !assert.Equal(t, []string{"f1"}, l2.fills) ||
+		!assert.Equal(t, 3, r.Positions(ctx)[0].Size) {
+		t.Fatal()
+	}
+
+	ex.execute("o2", 100, 1)
+	ex.execute("o1", 100, 4)
+	r.Reconcile(ctx)
+	if !assert.Empty(t, r.trades[m].book.triggers) || !assert.Equal(t, 8, r.Positions(ctx)[0].Size) {
+		t.Fatal()
+	}
+
+	// ioc orders don't rest
+	send(domain.Order{ID: "i1", Market: string(m), Typ: "buy", Price: 100, Size: 1})
+	if !assert.Empty(t, r.trades[m].book.triggers) || !assert.Equal(t, 9, r.Positions(ctx)[0].Size) {
+		t.Fatal()
+	}
+}
@@ -2,9 +2,11 @@ package robot
 
 import (
 	"context"
+	"crypto/rand"
 	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/cgriceld/crypto-trade-bot/internal/domain"
 )
@@ -12,6 +14,9 @@ import (
 const (
 	FailSendOrderBot = "❌ Fail to place order"
 	FailExecOrderBot = "❌ Fail to execute order"
+	CancelOCOBot     = "🔗 Cancel linked order"
+	FailResumeBot    = "❌ Fail to resume market"
+	FailSaveBot      = "❌ Fail to save to database"
 )
 
 var (
@@ -21,11 +26,19 @@ var (
 
 type Kraken interface {
 	SetMarket(ctx context.Context, m domain.Market)
-	Subscribe(ctx context.Context, m domain.Market) (int, error)
+	Subscribe(ctx context.Context, m domain.Market, interval string) (int, error)
 	Start(m domain.Market) <-chan domain.CandleSub
 	Stop(ctx context.Context, m domain.Market)
-	SendOrder(order domain.Order) (*domain.RespOrder, error)
+	SendOrder(ctx context.Context, order domain.Order) (*domain.RespOrder, error)
+	EditOrder(ctx context.Context, orderID string, order domain.Order) (*domain.RespEdit, error)
+	CancelOrder(ctx context.Context, orderID string) (*domain.RespCancel, error)
+	CancelAllOrders(ctx context.Context, m domain.Market) (*domain.CancelAllStatus, error)
+	OpenOrders(ctx context.Context) ([]domain.OpenOrder, error)
+	OpenPositions(ctx context.Context) ([]domain.OpenPosition, error)
+	Fills(ctx context.Context, before *time.Time) ([]domain.Fill, error)
 	Accounts(ctx context.Context) (*domain.AccountsResp, error)
+	Instruments(ctx context.Context) ([]domain.Instrument, error)
+	History(ctx context.Context, m domain.Market, interval string, from time.Time, to time.Time) ([]domain.Candle, error)
 }
 
 type Notifications interface {
@@ -33,13 +46,29 @@ type Notifications interface {
 }
 
 type Repository interface {
-	SaveOrder(rder domain.Order)
-	GetOrders(ctx context.Context) ([]domain.Order, error)
+	SaveOrder(ctx context.Context, order domain.Order) error
+	GetOrders(ctx context.Context, filter domain.OrderFilter) (*domain.OrdersResp, error)
+	EachOrder(ctx context.Context, filter domain.OrderFilter, fn func(domain.Order) error) error
+	SaveSettings(ctx context.Context, settings domain.MarketSettings) error
+	GetSettings(ctx context.Context) ([]domain.MarketSettings, error)
+	SaveCandle(ctx context.Context, candle domain.CandleRecord) error
+	GetCandles(ctx context.Context, filter domain.CandleFilter) ([]domain.CandleRecord, error)
 	Close()
 }
 
+// Close stops all markets without saving it, so that running markets can be
+// resumed after restart.
 func (r *Robot) Close() {
-	r.StopAll(context.Background())
+	r.stopSummary()
+	r.stopReconcile()
+	r.stopInstruments()
+
+	r.muxAll.RLock()
+	for m := range r.trades {
+		r.stopMarket(context.Background(), m)
+	}
+	r.muxAll.RUnlock()
+
 	r.repo.Close()
 }
 
@@ -58,7 +87,7 @@ func (r *Robot) isValidStart(ctx context.Context, m domain.Market) error {
 	if v.active {
 		return fmt.Errorf("%v: %v", RunSubscription, m)
 	}
-	if !v.sellActive && !v.buyActive {
+	if len(v.book.triggers) == 0 {
 		return fmt.Errorf("%v: %v: orders", NotSet, m)
 	}
 
@@ -72,14 +101,17 @@ func (r *Robot) StartMarket(ctx context.Context, m domain.Market) (int, error) {
 
 	r.trades[m].muxTrade.Lock()
 	r.trades[m].active = true
+	feed := r.trades[m].candleFeed()
 	r.trades[m].muxTrade.Unlock()
 
-	status, err := r.kraken.Subscribe(ctx, m)
+	status, err := r.kraken.Subscribe(ctx, m, feed.Interval)
 	if err != nil {
 		r.kraken.Stop(ctx, m)
 		r.deactivate(m)
 		return status, err
 	}
+	r.save(m, r.trades[m])
+	r.prefill(ctx, m)
 
 	candles := r.kraken.Start(m)
 	orders := r.trade(m, candles)
@@ -90,13 +122,23 @@ func (r *Robot) StartMarket(ctx context.Context, m domain.Market) (int, error) {
 	return 0, nil
 }
 
+// trade passes the first update of every candle to the strategy. The last
+// update of candle is saved to the candle history when the next one starts.
 func (r *Robot) trade(m domain.Market, candles <-chan domain.CandleSub) <-chan domain.Order {
 	var ts float64
+	var last domain.Candle
 	orders := make(chan domain.Order)
 
+	r.trades[m].muxTrade.RLock()
+	interval := r.trades[m].candleFeed().Interval
+	r.trades[m].muxTrade.RUnlock()
+
 	r.trades[m].wg.Add(1)
 	go func() {
 		defer func() {
+			if ts != 0 {
+				r.saveCandle(m, interval, last)
+			}
 			close(orders)
 			r.trades[m].wg.Done()
 		}()
@@ -104,16 +146,28 @@ func (r *Robot) trade(m domain.Market, candles <-chan domain.CandleSub) <-chan d
 		ts = 0
 		for candle := range candles {
 			if ts == candle.Cand.Time {
+				last = candle.Cand
 				continue
 			}
+			r.trades[m].muxTrade.RLock()
+			feed := r.trades[m].candleFeed()
+			r.trades[m].muxTrade.RUnlock()
+
+			// indicators see a candle once it is closed, not its first tick
+			if ts != 0 {
+				r.saveCandle(m, interval, last)
+				r.closeCandle(m, last, feed.Source)
+			}
 			ts = candle.Cand.Time
-			price, err := r.avgPrice(candle)
+			last = candle.Cand
+
+			price, err := candlePrice(candle.Cand, feed.Source)
 			if err != nil {
-				r.logger.Errorf("avgPrice: %v: Fail to convert price to float64: %v", m, err)
+				r.logger.Errorf("candlePrice: %v: Fail to convert price to float64: %v", m, err)
 				continue
 			}
-			r.logger.Infof("%v: average 1m price: %v", m, price)
-			res := r.algo(m, price)
+			r.logger.Infof("%v: %v %v price: %+v", m, feed.Interval, feed.Source, price)
+			res := r.algo(m, candle.Cand, price)
 			for _, order := range res {
 				orders <- order
 			}
@@ -127,41 +181,183 @@ func (r *Robot) sendOrder(m domain.Market, orders <-chan domain.Order) {
 	defer r.trades[m].wg.Done()
 
 	for v := range orders {
-		resp, err := r.kraken.SendOrder(v)
+		r.trades[m].muxTrade.RLock()
+		paper := r.trades[m].paper
+		r.trades[m].muxTrade.RUnlock()
+
+		sent := time.Now()
+		v.ClientID = newClientID()
+		v.TriggerPrice = v.Price
+		v.SentAt = &sent
+
+		if paper != nil {
+			fill := paper.Fill(v)
+			fill.Paper = true
+			r.processOrder(&domain.RespOrder{Result: "success", Status: domain.SendStatus{Stat: "placed"}}, m, fill)
+			continue
+		}
+
+		v.Price = r.roundPrice(m, v.Price)
+		v.StopPrice = r.roundPrice(m, v.StopPrice)
+		resp, err := r.kraken.SendOrder(context.Background(), v)
 		if err != nil {
 			r.logger.Errorf("sendOrder: %v: %v: %v", m, v.Typ, err)
 			r.notify.Notify(m, fmt.Sprintf("%v: %v: %v: server error", FailSendOrderBot, m, v.Typ))
+
+			v.Outcome = domain.OrderFailed
+			v.Error = err.Error()
+			r.saveOrder(m, v)
+			continue
 		}
 
-		r.processOrder(resp, m, v)
+		res := r.processOrder(resp, m, v)
+		r.keepResting(m, res, v.Size, resp.Status.Executions())
 	}
 }
 
-func (r *Robot) processOrder(respOrder *domain.RespOrder, m domain.Market, v domain.Order) {
+// keepResting puts the part of sent order which rests in the Kraken order book
+// back to the book of market with its Kraken order ID, so that its later
+// executions are recorded by reconcile. Executions already recorded from
+// the response are skipped.
+func (r *Robot) keepResting(m domain.Market, order domain.Order, size int, executions []string) {
+	left := size
+	switch {
+	case order.Outcome == domain.OrderOpen:
+	case order.Outcome == domain.OrderPlaced && order.Resting() && order.Size < size:
+		left -= order.Size
+	default:
+		return
+	}
+
+	v := r.trades[m]
+	v.muxExchange.Lock()
+	defer v.muxExchange.Unlock()
+
+	trigger := &Trigger{
+		id:      order.ID,
+		typ:     order.Typ,
+		price:   domain.Price(order.TriggerPrice),
+		size:    domain.Size(left),
+		exec:    order.Execution,
+		orderID: order.OrderID,
+		fills:   executions,
+		placed:  order.SentAt,
+	}
+
+	v.muxTrade.Lock()
+	// the name was taken by a new order since the order fired
+	if trigger.id == "" || v.book.find(trigger.id) >= 0 {
+		trigger.id = v.book.nextID()
+	}
+	v.book.put(trigger)
+	v.muxTrade.Unlock()
+
+	r.save(m, v)
+	r.logger.Infof("%v: %v %v order %v rests on Kraken, size: %v", m, order.Kind(), order.Typ, order.OrderID, left)
+}
+
+// processOrder records the order with Kraken response in the ledger and,
+// if it was executed, passes it to the strategy and position of market.
+// Orders resting in the order book are recorded as open. The recorded
+// order is returned, the size of partially executed order is the executed one.
+func (r *Robot) processOrder(respOrder *domain.RespOrder, m domain.Market, v domain.Order) domain.Order {
+	v.OrderID = respOrder.Status.OrderID
+	v.Status = respOrder.Status.Stat
+	v.ReceivedAt = respOrder.Status.ReceivedTime()
+	price, amount := respOrder.Status.Executed()
+
 	switch {
 	// "result":"error"
 	case respOrder.Result != "success":
 		r.logger.Errorf("processOrder: %v: %v: Fail to send order: %v", m, v.Typ, respOrder.Error)
 		r.notify.Notify(m, fmt.Sprintf("%v: %v: %v: server error", FailSendOrderBot, m, v.Typ))
+		v.Outcome = domain.OrderFailed
+		v.Error = respOrder.Error
 
 	// balance error
 	case respOrder.Status.Stat == "insufficientAvailableFunds":
 		r.logger.Warnf("processOrder: %v: %v: Fail to send order: %v", m, v.Typ, respOrder.Status.Stat)
 		r.notify.Notify(m, fmt.Sprintf("%v: %v: %v: insufficient funds", FailExecOrderBot, m, v.Typ))
+		v.Outcome = domain.OrderNoFunds
 
 	// order was rejected
 	case respOrder.Status.Stat != "placed":
 		r.logger.Warnf("processOrder: %v: %v: Fail to send order: %v", m, v.Typ, respOrder.Status.Stat)
 		r.notify.Notify(m, fmt.Sprintf("%v: %v: %v", FailExecOrderBot, m, v.Typ))
+		v.Outcome = domain.OrderRejected
+		v.Error = respOrder.Error
+
+	// limit or stop order rests on the exchange
+	case !v.Paper && v.Resting() && amount == 0:
+		v.Outcome = domain.OrderOpen
+		level := v.Price
+		if v.Stop() {
+			level = v.StopPrice
+		}
+		r.logger.Infof("%v %v order on %v is open, price: %.2f", v.Kind(), v.Typ, m, level)
+		r.notify.Notify(m, fmt.Sprintf("📌 Place %v %v order on %v. Price: %.2f", v.Kind(), v.Typ, m, level))
 
 	// ok
 	default:
-		r.repo.SaveOrder(v)
-		r.logger.Infof(fmt.Sprintf("%s order on %v, price: %.2f", v.Typ, m, v.Price))
-		r.notify.Notify(m, fmt.Sprintf("📌 Make %s order on %v. Price: %.2f", v.Typ, m, v.Price))
+		v.Outcome = domain.OrderPlaced
+		if amount > 0 {
+			v.Price = price
+			// the rest of partially executed limit order stays open
+			if int(amount) > 0 && int(amount) < v.Size {
+				r.logger.Infof("%v: %v: %v of %v contracts executed", m, v.Typ, int(amount), v.Size)
+				v.Size = int(amount)
+			}
+		}
+
+		r.saveOrder(m, v)
+		r.fill(m, v)
+		r.track(m, v)
+		r.save(m, r.trades[m])
+		typ := v.Typ
+		if v.Paper {
+			typ = "paper " + typ
+		}
+		r.logger.Infof(fmt.Sprintf("%s order on %v, price: %.2f", typ, m, v.Price))
+		r.notify.Notify(m, fmt.Sprintf("📌 Make %s order on %v. Price: %.2f", typ, m, v.Price))
+		return v
+	}
+
+	r.saveOrder(m, v)
+	return v
+}
+
+// saveOrder records order in the ledger, the failure is reported to Telegram
+// since the order is lost.
+func (r *Robot) saveOrder(m domain.Market, v domain.Order) {
+	if err := r.repo.SaveOrder(context.Background(), v); err != nil {
+		r.logger.Errorf("saveOrder: %v: %v: %v", m, v.Typ, err)
+		r.notify.Notify(m, fmt.Sprintf("%v: %v: %v order: %v", FailSaveBot, m, v.Typ, err))
+	}
+}
+
+// saveCandle saves candle to the candle history. Failures are only logged:
+// history can be fetched from Kraken again and a notification every candle
+// would flood the chat.
+func (r *Robot) saveCandle(m domain.Market, interval string, c domain.Candle) {
+	candle, err := domain.NewCandleRecord(m, interval, c)
+	if err == nil {
+		err = r.repo.SaveCandle(context.Background(), candle)
+	}
+	if err != nil {
+		r.logger.Errorf("saveCandle: %v: %v: %v", m, interval, err)
 	}
 }
 
+// newClientID generates order ID which is sent to Kraken as cliOrdId.
+func newClientID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
 func (r *Robot) deactivate(m domain.Market) {
 	r.trades[m].muxTrade.Lock()
 	r.trades[m].active = false
@@ -177,19 +373,30 @@ func (r *Robot) StopMarket(ctx context.Context, m domain.Market) error {
 		return fmt.Errorf("%v: %v", NoMarket, m)
 	}
 
+	if r.stopMarket(ctx, m) {
+		r.save(m, v)
+	}
+
+	return nil
+}
+
+// stopMarket stops the robot on market and reports whether it was running.
+func (r *Robot) stopMarket(ctx context.Context, m domain.Market) bool {
+	v := r.trades[m]
+
 	v.muxTrade.RLock()
 	status := v.active
 	v.muxTrade.RUnlock()
 
 	if !status {
-		return nil
+		return false
 	}
 
 	r.kraken.Stop(ctx, m)
-	r.trades[m].wg.Wait()
+	v.wg.Wait()
 	r.deactivate(m)
 
-	return nil
+	return true
 }
 
 func (r *Robot) StopAll(ctx context.Context) []domain.MarketsResp {
@@ -236,6 +443,10 @@ func (r *Robot) StartAll(ctx context.Context) []domain.MarketsResp {
 	return res
 }
 
-func (r *Robot) GetOrders(ctx context.Context) ([]domain.Order, error) {
-	return r.repo.GetOrders(ctx)
+func (r *Robot) GetOrders(ctx context.Context, filter domain.OrderFilter) (*domain.OrdersResp, error) {
+	return r.repo.GetOrders(ctx, filter)
+}
+
+func (r *Robot) GetCandles(ctx context.Context, filter domain.CandleFilter) ([]domain.CandleRecord, error) {
+	return r.repo.GetCandles(ctx, filter)
 }
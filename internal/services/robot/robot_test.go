@@ -48,8 +48,8 @@ type SetMarket struct {
 
 func TestSetMarket(t *testing.T) {
 	tests := []SetMarket{
-		{"First Set", "pi_ethusd", Trade{}},
-		{"Repeat Set", "pi_ethusd", Trade{}},
+		{"First Set", "pi_ethusd", Trade{book: Book{market: "pi_ethusd"}, strategy: &threshold{}, strategyName: DefaultStrategy}},
+		{"Repeat Set", "pi_ethusd", Trade{book: Book{market: "pi_ethusd"}, strategy: &threshold{}, strategyName: DefaultStrategy}},
 	}
 
 	for _, test := range tests {
@@ -89,6 +89,7 @@ var (
 	ordersSample = []domain.Order{
 		{
 			Time:   &timeOrders,
+			ID:     "sell",
 			Market: "pi_ethusd",
 			Typ:    "sell",
 			Price:  42.2,
@@ -96,6 +97,7 @@ var (
 		},
 		{
 			Time:   &timeOrders,
+			ID:     "buy",
 			Market: "pi_ethusd",
 			Typ:    "buy",
 			Price:  21.4,
@@ -142,17 +144,306 @@ func TestTradeAlgo(t *testing.T) {
 	}
 }
 
+func TestTradeCandles(t *testing.T) {
+	m := domain.Market("pi_ethusd")
+	r := New(krak, NewRepMock(), logger, notify)
+	r.SetMarket(context.Background(), m)
+
+	candles := make(chan domain.CandleSub)
+	orders := r.trade(m, candles)
+	go func() {
+		for _, sample := range candlesSample {
+			candles <- sample
+		}
+		close(candles)
+	}()
+	for range orders {
+	}
+
+	// the last update of every candle is saved
+	expect := []float64{42.2, 24.1}
+	res, err := r.GetCandles(context.Background(), domain.CandleFilter{Market: string(m), Interval: domain.DefaultInterval})
+	if !assert.NoError(t, err) || !assert.Len(t, res, len(expect)) {
+		t.Fatal()
+	}
+	for i, v := range res {
+		if !assert.Equal(t, expect[i], v.Close, "Expect: %v, Got: %v", expect[i], v.Close) {
+			t.Fatal()
+		}
+	}
+}
+
+func TestWarmUp(t *testing.T) {
+	ctx := context.Background()
+	m := domain.Market("pi_ltcusd")
+	r := New(krak, NewRepMock(), logger, notify)
+	r.SetMarket(ctx, m)
+	r.SetWarmUp(3)
+	_, _ = r.AddTrigger(ctx, m, domain.Order{ID: "sma", Typ: "buy", Size: 1, Conditions: []string{"sma(3) > 150"}})
+
+	now := time.Now()
+	last := now.Truncate(time.Minute).Add(-time.Minute)
+	for i, v := range []float64{140, 150, 160, 170} {
+		_ = r.repo.SaveCandle(ctx, domain.CandleRecord{Market: string(m), Interval: "1m", Time: last.Add(time.Duration(i-3) * time.Minute),
+			Open: v, High: v, Low: v, Close: v})
+	}
+
+	// the last 3 closed candles are stored
+	candles, source, err := r.history(ctx, m, "1m", 3, now)
+	if !assert.NoError(t, err) || !assert.Equal(t, "database", source) || !assert.Len(t, candles, 3) ||
+		!assert.Equal(t, "170", candles[2].Close) {
+		t.Fatal()
+	}
+
+	r.prefill(ctx, m)
+	if !assert.True(t, r.trades[m].book.triggers[0].met()) {
+		t.Fatal()
+	}
+
+	// live closed candles continue the prefilled history: sma(160, 170, 100)
+	r.closeCandle(m, domain.Candle{Open: "100", High: "100", Low: "100", Close: "100"}, domain.DefaultSource)
+	if !assert.False(t, r.trades[m].book.triggers[0].met()) {
+		t.Fatal()
+	}
+}
+
+type TrailingAlgo struct {
+	name   string
+	typ    string
+	trail  domain.Trailing
+	prices []float64
+	fired  float64
+}
+
+func TestTrailingAlgo(t *testing.T) {
+	tests := []TrailingAlgo{
+		{"Sell absolute", "sell", domain.Trailing{Distance: 10}, []float64{100, 120, 115, 111, 109, 90}, 109},
+		{"Sell percent", "sell", domain.Trailing{Distance: 10, Percent: true}, []float64{100, 200, 185, 179, 150}, 179},
+		{"Buy absolute", "buy", domain.Trailing{Distance: 5}, []float64{100, 90, 80, 84, 85, 100}, 85},
+		{"Not fired", "buy", domain.Trailing{Distance: 5}, []float64{100, 99, 98, 97}, 0},
+	}
+
+	m := domain.Market("pi_ethusd")
+	for _, test := range tests {
+		r := New(krak, NewRepMock(), logger, notify)
+		r.SetMarket(context.Background(), m)
+		_ = r.SetTrailing(context.Background(), m, test.typ, test.trail, domain.Size(1))
+
+		var fired float64
+		for _, p := range test.prices {
+			for _, o := range r.algo(m, domain.Candle{}, flat(p)) {
+				fired = o.Price
+			}
+		}
+
+		if !assert.Equal(t, test.fired, fired, "%v: Expect: %v, Got: %v", test.name, test.fired, fired) {
+			t.Fatal()
+		}
+	}
+}
+
+type OCOAlgo struct {
+	name   string
+	oco    bool
+	prices []float64
+	orders []string
+	active []domain.Order
+}
+
+func TestOCOAlgo(t *testing.T) {
+	tests := []OCOAlgo{
+		{"Linked", true, []float64{30, 45, 10}, []string{"sell"}, nil},
+		{"Not linked", false, []float64{30, 45, 10}, []string{"sell", "buy"}, nil},
+		{"Linked not fired", true, []float64{30, 35}, nil, []domain.Order{
+			{ID: "sell", Market: "pi_ethusd", Typ: "sell", Price: 40, Size: 1, OCO: true, Interval: "1m", Source: "ohlc4"},
+			{ID: "buy", Market: "pi_ethusd", Typ: "buy", Price: 20, Size: 1, OCO: true, Interval: "1m", Source: "ohlc4"},
+		}},
+	}
+
+	m := domain.Market("pi_ethusd")
+	for _, test := range tests {
+		r := New(krak, NewRepMock(), logger, notify)
+		r.SetMarket(context.Background(), m)
+		_ = r.SetSell(context.Background(), m, domain.Price(40), domain.Size(1))
+		_ = r.SetBuy(context.Background(), m, domain.Price(20), domain.Size(1))
+		_ = r.SetOCO(context.Background(), m, test.oco)
+
+		var orders []string
+		for _, p := range test.prices {
+			for _, o := range r.algo(m, domain.Candle{}, flat(p)) {
+				orders = append(orders, o.Typ)
+			}
+		}
+		active, _ := r.GetActive(context.Background(), m)
+
+		if !assert.Equal(t, test.orders, orders, "%v: Expect: %v, Got: %v", test.name, test.orders, orders) ||
+			!assert.Equal(t, test.active, active, "%v: Expect: %v, Got: %v", test.name, test.active, active) {
+			t.Fatal()
+		}
+	}
+}
+
+type StrategyAlgo struct {
+	name     string
+	strategy string
+	sell     domain.Price
+	buy      domain.Price
+	prices   []float64
+	orders   []string
+}
+
+func TestStrategyAlgo(t *testing.T) {
+	tests := []StrategyAlgo{
+		{"Stop-loss", "stoploss", 40, 20, []float64{30, 45, 10}, []string{"sell", "buy"}},
+		{"Breakout", "breakout", 20, 40, []float64{30, 45, 10}, []string{"buy", "sell"}},
+		{"Breakout not fired", "breakout", 20, 40, []float64{30, 35}, nil},
+	}
+
+	m := domain.Market("pi_ethusd")
+	for _, test := range tests {
+		r := New(krak, NewRepMock(), logger, notify)
+		r.SetMarket(context.Background(), m)
+		_ = r.SetStrategy(context.Background(), m, test.strategy)
+		_ = r.SetSell(context.Background(), m, test.sell, domain.Size(1))
+		_ = r.SetBuy(context.Background(), m, test.buy, domain.Size(1))
+
+		var orders []string
+		for _, p := range test.prices {
+			for _, o := range r.algo(m, domain.Candle{}, flat(p)) {
+				orders = append(orders, o.Typ)
+			}
+		}
+
+		if !assert.Equal(t, test.orders, orders, "%v: Expect: %v, Got: %v", test.name, test.orders, orders) {
+			t.Fatal()
+		}
+	}
+
+	r := New(krak, NewRepMock(), logger, notify)
+	r.SetMarket(context.Background(), m)
+	err := r.SetStrategy(context.Background(), m, "unknown")
+	if !assert.Equal(t, fmt.Errorf("%v: %v", UnknownStrategy, "unknown"), err) ||
+		!assert.Equal(t, []string{"breakout", "stoploss"}, r.Strategies(context.Background())) {
+		t.Fatal()
+	}
+}
+
+func TestCandlePrice(t *testing.T) {
+	candle := domain.Candle{Open: "10", High: "16", Low: "4", Close: "14"}
+	tests := []struct {
+		source string
+		res    Quote
+	}{
+		{"close", Quote{Sell: 14, Buy: 14}},
+		{"ohlc4", Quote{Sell: 11, Buy: 11}},
+		{"hlc3", Quote{Sell: 34.0 / 3, Buy: 34.0 / 3}},
+		{"hilo", Quote{Sell: 16, Buy: 4}},
+	}
+
+	for _, test := range tests {
+		res, err := candlePrice(candle, test.source)
+		if !assert.NoError(t, err) || !assert.Equal(t, test.res, res, "%v: Expect: %v, Got: %v", test.source, test.res, res) {
+			t.Fatal()
+		}
+	}
+
+	_, err := candlePrice(domain.Candle{Open: "x"}, "close")
+	if !assert.Error(t, err) {
+		t.Fatal()
+	}
+}
+
+func TestHiLoAlgo(t *testing.T) {
+	m := domain.Market("pi_ethusd")
+	r := New(krak, NewRepMock(), logger, notify)
+	r.SetMarket(context.Background(), m)
+	_ = r.SetSell(context.Background(), m, domain.Price(15), domain.Size(1))
+	_ = r.SetBuy(context.Background(), m, domain.Price(5), domain.Size(1))
+
+	q, _ := candlePrice(domain.Candle{Open: "10", High: "16", Low: "4", Close: "14"}, "hilo")
+	orders := r.algo(m, domain.Candle{}, q)
+
+	if !assert.Len(t, orders, 2) ||
+		!assert.Equal(t, 16.0, orders[0].Price) || !assert.Equal(t, 4.0, orders[1].Price) {
+		t.Fatal()
+	}
+}
+
+func TestConditionAlgo(t *testing.T) {
+	m := domain.Market("pi_ethusd")
+	r := New(krak, NewRepMock(), logger, notify)
+	r.SetMarket(context.Background(), m)
+	_, _ = r.AddTrigger(context.Background(), m, domain.Order{ID: "cross", Typ: "buy", Size: 1,
+		Conditions: []string{"price crosses_above sma(2)"}})
+	_, _ = r.AddTrigger(context.Background(), m, domain.Order{ID: "tp", Typ: "sell", Price: 100, Size: 1,
+		Conditions: []string{"rsi(2) > 80"}})
+	_, err := r.AddTrigger(context.Background(), m, domain.Order{Typ: "sell", Price: 100, Size: 1,
+		Conditions: []string{"rsi > 70"}})
+	if !assert.Error(t, err) {
+		t.Fatal()
+	}
+
+	// conditions are evaluated on closed candles, so crossing on 110 fires
+	// on the first tick of the next candle
+	var fired []string
+	var last *domain.Candle
+	for _, c := range []string{"100", "90", "80", "110", "105"} {
+		if last != nil {
+			r.closeCandle(m, *last, "close")
+		}
+		candle := domain.Candle{Open: c, High: c, Low: c, Close: c}
+		q, _ := candlePrice(candle, "close")
+		for _, o := range r.algo(m, candle, q) {
+			fired = append(fired, fmt.Sprintf("%v@%v", o.ID, o.Price))
+		}
+		last = &candle
+	}
+
+	if !assert.Equal(t, []string{"cross@105"}, fired) {
+		t.Fatal()
+	}
+}
+
+func TestPaperOrder(t *testing.T) {
+	m := domain.Market("pi_ethusd")
+	rep := NewRepMock()
+	r := New(krak, rep, logger, notify)
+	r.SetMarket(context.Background(), m)
+	_ = r.SetPaper(context.Background(), m, domain.Paper{Enabled: true, Slippage: 1, Fee: 0.5})
+
+	orders := make(chan domain.Order, 1)
+	orders <- domain.Order{Market: "pi_ethusd", Typ: "buy", Price: 100, Size: 2}
+	close(orders)
+
+	r.trades[m].wg.Add(1)
+	r.sendOrder(m, orders)
+
+	page, _ := rep.GetOrders(context.Background(), domain.OrderFilter{})
+	res := page.Orders
+	if len(res) == 1 && res[0].ClientID != "" && res[0].SentAt != nil {
+		res[0].ClientID, res[0].SentAt = "", nil
+	}
+	paper := []domain.Order{{Market: "pi_ethusd", Typ: "buy", Price: 101, Size: 2, Fee: 1.01, Paper: true,
+		Outcome: domain.OrderPlaced, Status: "placed", TriggerPrice: 100}}
+	if !assert.Equal(t, paper, res, "%v: Expect: %v, Got: %v", "paper", paper, res) {
+		t.Fatal()
+	}
+}
+
 var (
 	testResp = []domain.RespOrder{
 		{
 			Result: "fail",
+			Error:  "apiLimitExceeded",
 		},
 		{
+			Result: "success",
 			Status: domain.SendStatus{
 				Stat: "insufficientAvailableFunds",
 			},
 		},
 		{
+			Result: "success",
 			Status: domain.SendStatus{
 				Stat: "not placed",
 			},
@@ -163,7 +454,20 @@ var (
 				Stat: "placed",
 			},
 		},
+		{
+			Result: "success",
+			Status: domain.SendStatus{
+				OrderID:  "61ca5732-3478-42fe-8362-abbfd9465294",
+				Stat:     "placed",
+				Received: "2022-01-28T13:34:02.556Z",
+				Events: []domain.OrderEvent{
+					{Type: "EXECUTION", Price: 101, Amount: 1},
+					{Type: "EXECUTION", Price: 103, Amount: 3},
+				},
+			},
+		},
 	}
+	receivedTime = time.Date(2022, 1, 28, 13, 34, 2, 556000000, time.UTC)
 )
 
 type SendOrders struct {
@@ -175,25 +479,29 @@ type SendOrders struct {
 
 func TestProcessOrder(t *testing.T) {
 	tests := []SendOrders{
-		{"Fail", domain.Market("pi_ethusd"), testResp[0], nil},
-		{"No Balance", domain.Market("pi_ethusd"), testResp[1], nil},
-		{"Not Placed", domain.Market("pi_ethusd"), testResp[2], nil},
+		{"Fail", domain.Market("pi_ethusd"), testResp[0], []domain.Order{
+			{Time: &timeOrders, Outcome: domain.OrderFailed, Error: "apiLimitExceeded"},
+		}},
+		{"No Balance", domain.Market("pi_ethusd"), testResp[1], []domain.Order{
+			{Time: &timeOrders, Outcome: domain.OrderNoFunds, Status: "insufficientAvailableFunds"},
+		}},
+		{"Not Placed", domain.Market("pi_ethusd"), testResp[2], []domain.Order{
+			{Time: &timeOrders, Outcome: domain.OrderRejected, Status: "not placed"},
+		}},
 		{"Placed", domain.Market("pi_ethusd"), testResp[3], []domain.Order{
-			{
-				Time:   &timeOrders,
-				Market: "",
-				Typ:    "",
-				Price:  0.0,
-				Size:   0,
-			},
-		},
-		},
+			{Time: &timeOrders, Outcome: domain.OrderPlaced, Status: "placed"},
+		}},
+		{"Executed", domain.Market("pi_ethusd"), testResp[4], []domain.Order{
+			{Time: &timeOrders, Price: 102.5, Outcome: domain.OrderPlaced, Status: "placed",
+				OrderID: "61ca5732-3478-42fe-8362-abbfd9465294", ReceivedAt: &receivedTime},
+		}},
 	}
 
 	for _, test := range tests {
 		robot.processOrder(&test.resp, test.market, domain.Order{})
 
-		res, _ := robot.repo.GetOrders(context.Background())
+		page, _ := robot.repo.GetOrders(context.Background(), domain.OrderFilter{Outcome: test.res[0].Outcome})
+		res := page.Orders
 		if res != nil {
 			res[0].Time = &timeOrders
 		}
@@ -204,23 +512,58 @@ func TestProcessOrder(t *testing.T) {
 	}
 }
 
+func TestRestingOrder(t *testing.T) {
+	m := domain.Market("pi_ethusd")
+	rep := NewRepMock()
+	r := New(krak, rep, logger, notify)
+	r.SetMarket(context.Background(), m)
+
+	limit := domain.Order{Market: string(m), Typ: "buy", Price: 100, Size: 4, Execution: domain.Execution{OrderType: "lmt"}}
+	r.processOrder(&testResp[3], m, limit)
+
+	page, _ := rep.GetOrders(context.Background(), domain.OrderFilter{})
+	if !assert.Len(t, page.Orders, 1) || !assert.Equal(t, domain.OrderOpen, page.Orders[0].Outcome) ||
+		!assert.Empty(t, r.Positions(context.Background()), "open order is not executed") {
+		t.Fatal()
+	}
+
+	partial := domain.RespOrder{Result: "success", Status: domain.SendStatus{Stat: "placed",
+		Events: []domain.OrderEvent{{Type: "EXECUTION", Price: 99.5, Amount: 3}}}}
+	r.processOrder(&partial, m, limit)
+
+	page, _ = rep.GetOrders(context.Background(), domain.OrderFilter{})
+	pos := r.Positions(context.Background())
+	if !assert.Len(t, page.Orders, 1) || !assert.Equal(t, domain.OrderPlaced, page.Orders[0].Outcome) ||
+		!assert.Equal(t, 3, page.Orders[0].Size) || !assert.Len(t, pos, 1) || !assert.Equal(t, 3, pos[0].Size) {
+		t.Fatal()
+	}
+}
+
+func TestClientID(t *testing.T) {
+	id := newClientID()
+	if !assert.Regexp(t, "^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$", id) ||
+		!assert.NotEqual(t, id, newClientID()) {
+		t.Fatal()
+	}
+}
+
 type SellOrders struct {
 	name   string
 	market domain.Market
 	price  domain.Price
 	size   domain.Size
-	res    Sell
+	res    Trigger
 }
 
 func TestSetSell(t *testing.T) {
 	tests := []SellOrders{
 		{"Right Set", domain.Market("pi_ethusd"), domain.Price(42), domain.Size(21),
-			Sell{
-				sellActive: true, sellPrice: domain.Price(42), sellSize: domain.Size(21),
+			Trigger{
+				id: "sell", typ: "sell", price: domain.Price(42), size: domain.Size(21),
 			}},
 		{"No Such Market", domain.Market("wrong"), domain.Price(42), domain.Size(21),
-			Sell{
-				sellActive: true, sellPrice: domain.Price(42), sellSize: domain.Size(21),
+			Trigger{
+				id: "sell", typ: "sell", price: domain.Price(42), size: domain.Size(21),
 			}},
 	}
 
@@ -228,9 +571,10 @@ func TestSetSell(t *testing.T) {
 
 	for _, test := range tests {
 		_ = robot.SetSell(context.Background(), test.market, test.price, test.size)
+		sell := *s.book.triggers[s.book.find("sell")]
 
-		if !assert.Equal(t, test.res, s.Sell) {
-			t.Fatalf("%v: Expect: %v, Got: %v", test.name, test.res, s.Sell)
+		if !assert.Equal(t, test.res, sell) {
+			t.Fatalf("%v: Expect: %v, Got: %v", test.name, test.res, sell)
 		}
 	}
 }
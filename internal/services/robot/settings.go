@@ -5,44 +5,71 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"time"
 
 	"github.com/cgriceld/crypto-trade-bot/internal/domain"
+	"github.com/cgriceld/crypto-trade-bot/pkg/indicators"
 	"github.com/cgriceld/crypto-trade-bot/pkg/log"
+	"github.com/cgriceld/crypto-trade-bot/pkg/simulator"
 )
 
 var (
-	NoMarket = errors.New("No market was set")
+	NoMarket    = errors.New("No market was set")
+	WrongSide   = errors.New("Unknown order type")
+	NoTrigger   = errors.New("No such order")
+	DuplicateID = errors.New("Order already exists")
+	WrongFeed   = errors.New("Unknown candle interval or price source")
+	RunningFeed = errors.New("Fail to change candle interval, the robot is running")
+	WrongExec   = errors.New("Wrong Kraken order type or its parameters")
 )
 
-type Buy struct {
-	buyActive bool
-	buyPrice  domain.Price
-	buySize   domain.Size
-}
-
-type Sell struct {
-	sellActive bool
-	sellPrice  domain.Price
-	sellSize   domain.Size
+// Trigger is an inner order which is sent to Kraken when its price is triggered
+// and all its conditions are met. Triggers with orderID are stop orders resting
+// on Kraken, the robot only keeps track of them.
+type Trigger struct {
+	id      string
+	typ     string
+	price   domain.Price
+	size    domain.Size
+	trail   *domain.Trailing
+	conds   []*indicators.Condition
+	exec    domain.Execution
+	orderID string
+	fills   []string
+	placed  *time.Time
 }
 
 type Trade struct {
-	Sell
-	Buy
-	muxTrade sync.RWMutex
-	wg       sync.WaitGroup
-	active   bool
+	book         Book
+	strategy     Strategy
+	strategyName string
+	paper        *simulator.Executor
+	feed         domain.Feed
+	pos          position
+	paperPos     position
+	muxTrade     sync.RWMutex
+	muxSave      sync.Mutex
+	muxExchange  sync.Mutex
+	wg           sync.WaitGroup
+	active       bool
 }
 
 type TradePool map[domain.Market]*Trade
 
 type Robot struct {
-	kraken Kraken
-	logger log.Logger
-	repo   Repository
-	notify Notifications
-	muxAll sync.RWMutex
-	trades TradePool
+	kraken  Kraken
+	logger  log.Logger
+	repo    Repository
+	notify  Notifications
+	muxAll  sync.RWMutex
+	trades  TradePool
+	summary chan struct{}
+	polling chan struct{}
+	warmUp  int
+
+	muxInstruments sync.RWMutex
+	instruments    map[domain.Market]domain.Instrument
+	refresh        chan struct{}
 }
 
 func New(kraken Kraken, repo Repository, logger log.Logger, notify Notifications) *Robot {
@@ -52,6 +79,7 @@ func New(kraken Kraken, repo Repository, logger log.Logger, notify Notifications
 		logger: logger,
 		notify: notify,
 		trades: make(TradePool),
+		warmUp: DefaultWarmUp,
 	}
 
 	return r
@@ -59,14 +87,25 @@ func New(kraken Kraken, repo Repository, logger log.Logger, notify Notifications
 
 func (r *Robot) SetMarket(ctx context.Context, m domain.Market) {
 	r.muxAll.Lock()
-	_, ok := r.trades[m]
+	v, ok := r.trades[m]
 	if !ok {
-		r.trades[m] = &Trade{}
+		v = &Trade{
+			book:         Book{market: m},
+			strategy:     strategies[DefaultStrategy](),
+			strategyName: DefaultStrategy,
+		}
+		r.trades[m] = v
 	}
 	r.muxAll.Unlock()
+
+	if !ok {
+		r.save(m, v)
+	}
 }
 
-func (r *Robot) SetSell(ctx context.Context, m domain.Market, p domain.Price, s domain.Size) error {
+// setTrigger puts trigger to the book, exchange order it replaces is cancelled
+// on Kraken first.
+func (r *Robot) setTrigger(ctx context.Context, m domain.Market, trigger *Trigger) error {
 	r.muxAll.RLock()
 	v, ok := r.trades[m]
 	r.muxAll.RUnlock()
@@ -75,16 +114,190 @@ func (r *Robot) SetSell(ctx context.Context, m domain.Market, p domain.Price, s
 		return fmt.Errorf("%v: %v", NoMarket, m)
 	}
 
+	v.muxExchange.Lock()
+	defer v.muxExchange.Unlock()
+
+	v.muxTrade.RLock()
+	prev := v.book.get(trigger.id)
+	v.muxTrade.RUnlock()
+
+	if prev != nil && prev.orderID != "" {
+		if err := r.cancelExchange(ctx, m, prev); err != nil {
+			return err
+		}
+	}
+
 	v.muxTrade.Lock()
-	v.sellPrice = p
-	v.sellSize = s
-	v.sellActive = true
+	v.book.put(trigger)
 	v.muxTrade.Unlock()
 
+	r.save(m, v)
+
 	return nil
 }
 
+// unsetTriggers removes all triggers of type typ, exchange orders are removed
+// only if they were cancelled on Kraken.
+func (r *Robot) unsetTriggers(ctx context.Context, m domain.Market, typ string) error {
+	r.muxAll.RLock()
+	v, ok := r.trades[m]
+	r.muxAll.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("%v: %v", NoMarket, m)
+	}
+
+	v.muxExchange.Lock()
+	defer v.muxExchange.Unlock()
+
+	v.muxTrade.RLock()
+	resting := v.book.exchange(typ)
+	v.muxTrade.RUnlock()
+
+	var res error
+	var cancelled []*Trigger
+	for _, t := range resting {
+		if err := r.cancelExchange(ctx, m, t); err != nil {
+			res = err
+			continue
+		}
+		cancelled = append(cancelled, t)
+	}
+
+	v.muxTrade.Lock()
+	for _, t := range cancelled {
+		v.book.drop(t)
+	}
+	v.book.cancel(typ)
+	v.muxTrade.Unlock()
+
+	r.save(m, v)
+
+	return res
+}
+
+// SetSell sets (or replaces) the sell order named "sell".
+func (r *Robot) SetSell(ctx context.Context, m domain.Market, p domain.Price, s domain.Size) error {
+	if err := r.checkOrder(m, p, s); err != nil {
+		return err
+	}
+
+	return r.setTrigger(ctx, m, &Trigger{id: "sell", typ: "sell", price: p, size: s})
+}
+
+// UnsetSell cancels all sell orders on market.
 func (r *Robot) UnsetSell(ctx context.Context, m domain.Market) error {
+	return r.unsetTriggers(ctx, m, "sell")
+}
+
+// SetBuy sets (or replaces) the buy order named "buy".
+func (r *Robot) SetBuy(ctx context.Context, m domain.Market, p domain.Price, s domain.Size) error {
+	if err := r.checkOrder(m, p, s); err != nil {
+		return err
+	}
+
+	return r.setTrigger(ctx, m, &Trigger{id: "buy", typ: "buy", price: p, size: s})
+}
+
+// UnsetBuy cancels all buy orders on market.
+func (r *Robot) UnsetBuy(ctx context.Context, m domain.Market) error {
+	return r.unsetTriggers(ctx, m, "buy")
+}
+
+// SetTrailing sets (or replaces) the trailing order named by its type.
+func (r *Robot) SetTrailing(ctx context.Context, m domain.Market, typ string, t domain.Trailing, s domain.Size) error {
+	if typ != "sell" && typ != "buy" {
+		return fmt.Errorf("%v: %v", WrongSide, typ)
+	}
+	// the price of trailing order is rounded to the tick size when it's sent
+	if err := r.checkOrder(m, 0, s); err != nil {
+		return err
+	}
+
+	t.Best = 0
+	return r.setTrigger(ctx, m, &Trigger{id: typ, typ: typ, size: s, trail: &t})
+}
+
+// AddTrigger adds a new order to market. If order ID is empty, it is generated.
+func (r *Robot) AddTrigger(ctx context.Context, m domain.Market, order domain.Order) (domain.Order, error) {
+	if order.Typ != "sell" && order.Typ != "buy" {
+		return domain.Order{}, fmt.Errorf("%v: %v", WrongSide, order.Typ)
+	}
+	if err := r.checkOrder(m, domain.Price(order.Price), domain.Size(order.Size)); err != nil {
+		return domain.Order{}, err
+	}
+	if order.Stop() {
+		if err := r.checkOrder(m, domain.Price(order.StopPrice), domain.Size(order.Size)); err != nil {
+			return domain.Order{}, err
+		}
+	}
+
+	r.muxAll.RLock()
+	v, ok := r.trades[m]
+	r.muxAll.RUnlock()
+
+	if !ok {
+		return domain.Order{}, fmt.Errorf("%v: %v", NoMarket, m)
+	}
+
+	trigger, err := newTrigger(order)
+	if err != nil {
+		return domain.Order{}, err
+	}
+
+	v.muxTrade.Lock()
+	if trigger.id == "" {
+		trigger.id = v.book.nextID()
+	} else if v.book.find(trigger.id) >= 0 {
+		v.muxTrade.Unlock()
+		return domain.Order{}, fmt.Errorf("%v: %v: %v", DuplicateID, m, trigger.id)
+	}
+	v.book.put(trigger)
+	res := activeOrder(m, trigger, v.book.oco)
+	v.muxTrade.Unlock()
+
+	r.save(m, v)
+
+	return res, nil
+}
+
+// newTrigger makes trigger from order, trailing orders start tracking
+// the best price from scratch.
+func newTrigger(order domain.Order) (*Trigger, error) {
+	if param := order.Execution.Invalid(); param != "" {
+		return nil, fmt.Errorf("%v: %v", WrongExec, param)
+	}
+
+	trigger := &Trigger{
+		id:      order.ID,
+		typ:     order.Typ,
+		price:   domain.Price(order.Price),
+		size:    domain.Size(order.Size),
+		exec:    order.Execution,
+		orderID: order.OrderID,
+		fills:   order.Fills,
+		placed:  order.SentAt,
+	}
+	if order.Trailing != nil {
+		trail := *order.Trailing
+		trail.Best = 0
+		trigger.price = 0
+		trigger.trail = &trail
+	}
+	for _, expr := range order.Conditions {
+		cond, err := indicators.Parse(expr)
+		if err != nil {
+			return nil, err
+		}
+		trigger.conds = append(trigger.conds, cond)
+	}
+
+	return trigger, nil
+}
+
+// CancelTrigger cancels order with passed ID on market, exchange order is
+// cancelled on Kraken as well.
+func (r *Robot) CancelTrigger(ctx context.Context, m domain.Market, id string) error {
 	r.muxAll.RLock()
 	v, ok := r.trades[m]
 	r.muxAll.RUnlock()
@@ -93,14 +306,34 @@ func (r *Robot) UnsetSell(ctx context.Context, m domain.Market) error {
 		return fmt.Errorf("%v: %v", NoMarket, m)
 	}
 
+	v.muxExchange.Lock()
+	defer v.muxExchange.Unlock()
+
+	v.muxTrade.RLock()
+	t := v.book.get(id)
+	v.muxTrade.RUnlock()
+
+	if t == nil {
+		return fmt.Errorf("%v: %v: %v", NoTrigger, m, id)
+	}
+	if t.orderID != "" {
+		if err := r.cancelExchange(ctx, m, t); err != nil {
+			return err
+		}
+	}
+
 	v.muxTrade.Lock()
-	v.sellActive = false
+	v.book.drop(t)
 	v.muxTrade.Unlock()
 
+	r.save(m, v)
+
 	return nil
 }
 
-func (r *Robot) SetBuy(ctx context.Context, m domain.Market, p domain.Price, s domain.Size) error {
+// SetOCO links (or unlinks) sell and buy orders on market, so that
+// triggering one of them cancels the others.
+func (r *Robot) SetOCO(ctx context.Context, m domain.Market, oco bool) error {
 	r.muxAll.RLock()
 	v, ok := r.trades[m]
 	r.muxAll.RUnlock()
@@ -110,15 +343,22 @@ func (r *Robot) SetBuy(ctx context.Context, m domain.Market, p domain.Price, s d
 	}
 
 	v.muxTrade.Lock()
-	v.buyPrice = p
-	v.buySize = s
-	v.buyActive = true
+	v.book.oco = oco
 	v.muxTrade.Unlock()
 
+	r.save(m, v)
+
 	return nil
 }
 
-func (r *Robot) UnsetBuy(ctx context.Context, m domain.Market) error {
+// SetStrategy switches market to the strategy registered under name.
+// Inner orders of the market are kept.
+func (r *Robot) SetStrategy(ctx context.Context, m domain.Market, name string) error {
+	newStrategy, ok := strategies[name]
+	if !ok {
+		return fmt.Errorf("%v: %v", UnknownStrategy, name)
+	}
+
 	r.muxAll.RLock()
 	v, ok := r.trades[m]
 	r.muxAll.RUnlock()
@@ -128,22 +368,104 @@ func (r *Robot) UnsetBuy(ctx context.Context, m domain.Market) error {
 	}
 
 	v.muxTrade.Lock()
-	v.buyActive = false
+	v.strategy = newStrategy()
+	v.strategyName = name
 	v.muxTrade.Unlock()
 
+	r.save(m, v)
+
+	return nil
+}
+
+// SetPaper switches market to paper trading or back to Kraken.
+func (r *Robot) SetPaper(ctx context.Context, m domain.Market, p domain.Paper) error {
+	r.muxAll.RLock()
+	v, ok := r.trades[m]
+	r.muxAll.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("%v: %v", NoMarket, m)
+	}
+
+	v.muxTrade.Lock()
+	v.paper = nil
+	if p.Enabled {
+		v.paper = &simulator.Executor{Slippage: p.Slippage, Fee: p.Fee}
+	}
+	v.muxTrade.Unlock()
+
+	r.save(m, v)
+
 	return nil
 }
 
+// SetFeed changes candle interval and (or) price source of market, empty
+// fields of feed are left unchanged. Price source may be changed while the
+// robot is running, candle interval may not.
+func (r *Robot) SetFeed(ctx context.Context, m domain.Market, feed domain.Feed) error {
+	if feed.Interval != "" && !domain.Contains(domain.Intervals, feed.Interval) {
+		return fmt.Errorf("%v: %v", WrongFeed, feed.Interval)
+	}
+	if feed.Source != "" && !domain.Contains(domain.PriceSources, feed.Source) {
+		return fmt.Errorf("%v: %v", WrongFeed, feed.Source)
+	}
+
+	r.muxAll.RLock()
+	v, ok := r.trades[m]
+	r.muxAll.RUnlock()
+
+	if !ok {
+		return fmt.Errorf("%v: %v", NoMarket, m)
+	}
+
+	v.muxTrade.Lock()
+	if feed.Interval != "" && feed.Interval != v.candleFeed().Interval {
+		if v.active {
+			v.muxTrade.Unlock()
+			return fmt.Errorf("%v: %v", RunningFeed, m)
+		}
+		v.feed.Interval = feed.Interval
+	}
+	if feed.Source != "" {
+		v.feed.Source = feed.Source
+	}
+	v.muxTrade.Unlock()
+
+	r.save(m, v)
+
+	return nil
+}
+
+// candleFeed returns feed of the trade with defaults for unset fields.
+func (t *Trade) candleFeed() domain.Feed {
+	feed := t.feed
+	if feed.Interval == "" {
+		feed.Interval = domain.DefaultInterval
+	}
+	if feed.Source == "" {
+		feed.Source = domain.DefaultSource
+	}
+
+	return feed
+}
+
 func (r *Robot) UnsetAll(ctx context.Context) []domain.MarketsResp {
 	var res []domain.MarketsResp
 
 	r.muxAll.RLock()
 	for m := range r.trades {
-		_ = r.UnsetSell(ctx, m)
-		_ = r.UnsetBuy(ctx, m)
+		status := "ok"
+		// exchange orders which failed to be cancelled are kept
+		err := r.UnsetSell(ctx, m)
+		if e := r.UnsetBuy(ctx, m); err == nil {
+			err = e
+		}
+		if err != nil {
+			status = err.Error()
+		}
 		res = append(res, domain.MarketsResp{
 			Market: string(m),
-			Status: "ok",
+			Status: status,
 		})
 	}
 	r.muxAll.RUnlock()
@@ -163,28 +485,44 @@ func (r *Robot) GetActive(ctx context.Context, m domain.Market) ([]domain.Order,
 	var res []domain.Order
 
 	status.muxTrade.RLock()
-	if status.sellActive {
-		res = append(res, domain.Order{
-			Market: string(m),
-			Typ:    "sell",
-			Price:  float64(status.sellPrice),
-			Size:   int(status.sellSize),
-		})
-	}
-
-	if status.buyActive {
-		res = append(res, domain.Order{
-			Market: string(m),
-			Typ:    "buy",
-			Price:  float64(status.buyPrice),
-			Size:   int(status.buySize),
-		})
+	feed := status.candleFeed()
+	for _, v := range status.book.triggers {
+		order := activeOrder(m, v, status.book.oco)
+		order.Interval = feed.Interval
+		order.Source = feed.Source
+		res = append(res, order)
 	}
 	status.muxTrade.RUnlock()
 
 	return res, nil
 }
 
+func activeOrder(m domain.Market, t *Trigger, oco bool) domain.Order {
+	order := domain.Order{
+		ID:        t.id,
+		Market:    string(m),
+		Typ:       t.typ,
+		Price:     float64(t.price),
+		Size:      int(t.size),
+		OCO:       oco,
+		Execution: t.exec,
+		Fills:     t.fills,
+		OrderID:   t.orderID,
+		SentAt:    t.placed,
+	}
+
+	if t.trail != nil {
+		trail := *t.trail
+		order.Price = trail.Level(t.typ)
+		order.Trailing = &trail
+	}
+	for _, cond := range t.conds {
+		order.Conditions = append(order.Conditions, cond.String())
+	}
+
+	return order
+}
+
 func (r *Robot) GetActiveAll(ctx context.Context) []domain.Order {
 	var res []domain.Order
 
@@ -209,6 +547,7 @@ func (r *Robot) Running(ctx context.Context) []domain.MarketsResp {
 			run = domain.MarketsResp{
 				Market: string(m),
 				Status: "running",
+				Paper:  v.paper != nil,
 			}
 
 			res = append(res, run)
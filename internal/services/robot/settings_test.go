@@ -2,6 +2,7 @@ package robot
 
 import (
 	"context"
+	"fmt"
 	"testing"
 
 	"github.com/cgriceld/crypto-trade-bot/internal/domain"
@@ -14,18 +15,18 @@ type BuyOrders struct {
 	market domain.Market
 	price  domain.Price
 	size   domain.Size
-	res    Buy
+	res    Trigger
 }
 
 func TestSetBuy(t *testing.T) {
 	tests := []BuyOrders{
 		{"Right set", domain.Market("pi_ethusd"), domain.Price(42), domain.Size(21),
-			Buy{
-				buyActive: true, buyPrice: domain.Price(42), buySize: domain.Size(21),
+			Trigger{
+				id: "buy", typ: "buy", price: domain.Price(42), size: domain.Size(21),
 			}},
 		{"No such market", domain.Market("wrong"), domain.Price(42), domain.Size(21),
-			Buy{
-				buyActive: true, buyPrice: domain.Price(42), buySize: domain.Size(21),
+			Trigger{
+				id: "buy", typ: "buy", price: domain.Price(42), size: domain.Size(21),
 			}},
 	}
 
@@ -33,9 +34,10 @@ func TestSetBuy(t *testing.T) {
 
 	for _, test := range tests {
 		_ = robot.SetBuy(context.Background(), test.market, test.price, test.size)
+		buy := *s.book.triggers[s.book.find("buy")]
 
-		if !assert.Equal(t, test.res, s.Buy) {
-			t.Fatalf("%v: Expect: %v, Got: %v", test.name, test.res, s.Buy)
+		if !assert.Equal(t, test.res, buy) {
+			t.Fatalf("%v: Expect: %v, Got: %v", test.name, test.res, buy)
 		}
 	}
 }
@@ -43,16 +45,22 @@ func TestSetBuy(t *testing.T) {
 func TestGetActiveAll(t *testing.T) {
 	res := []domain.Order{
 		{
-			Market: "pi_ethusd",
-			Typ:    "sell",
-			Price:  42,
-			Size:   21,
+			ID:       "sell",
+			Market:   "pi_ethusd",
+			Typ:      "sell",
+			Price:    42,
+			Size:     21,
+			Interval: "1m",
+			Source:   "ohlc4",
 		},
 		{
-			Market: "pi_ethusd",
-			Typ:    "buy",
-			Price:  42,
-			Size:   21,
+			ID:       "buy",
+			Market:   "pi_ethusd",
+			Typ:      "buy",
+			Price:    42,
+			Size:     21,
+			Interval: "1m",
+			Source:   "ohlc4",
 		},
 	}
 
@@ -98,3 +106,103 @@ func TestUnsetAll(t *testing.T) {
 		t.Fatalf("%v: Expect: %v, Got: %v", "unset all", res, unset)
 	}
 }
+
+func TestGetActiveTrailing(t *testing.T) {
+	m := domain.Market("pi_ethusd")
+	r := New(krak, NewRepMock(), logger, notify)
+	r.SetMarket(context.Background(), m)
+	_ = r.SetTrailing(context.Background(), m, "sell", domain.Trailing{Distance: 2, Percent: true}, domain.Size(3))
+	_ = r.algo(m, domain.Candle{}, flat(200))
+
+	res := []domain.Order{
+		{
+			ID:       "sell",
+			Market:   "pi_ethusd",
+			Typ:      "sell",
+			Price:    196,
+			Size:     3,
+			Trailing: &domain.Trailing{Distance: 2, Percent: true, Best: 200},
+			Interval: "1m",
+			Source:   "ohlc4",
+		},
+	}
+
+	active, _ := r.GetActive(context.Background(), m)
+
+	if !assert.Equal(t, res, active) {
+		t.Fatalf("%v: Expect: %v, Got: %v", "active trailing", res, active)
+	}
+
+	err := r.SetTrailing(context.Background(), m, "hold", domain.Trailing{Distance: 2}, domain.Size(3))
+	if !assert.Equal(t, fmt.Errorf("%v: %v", WrongSide, "hold"), err) {
+		t.Fatal()
+	}
+}
+
+func TestLadder(t *testing.T) {
+	m := domain.Market("pi_ethusd")
+	r := New(krak, NewRepMock(), logger, notify)
+	r.SetMarket(context.Background(), m)
+
+	for _, p := range []float64{4000, 4200, 4500} {
+		_, _ = r.AddTrigger(context.Background(), m, domain.Order{Typ: "sell", Price: p, Size: 1})
+	}
+	named, _ := r.AddTrigger(context.Background(), m, domain.Order{ID: "tp", Typ: "sell", Price: 5000, Size: 2})
+	_, err := r.AddTrigger(context.Background(), m, domain.Order{ID: "tp", Typ: "sell", Price: 5500, Size: 2})
+	if !assert.Equal(t, fmt.Errorf("%v: %v: %v", DuplicateID, m, "tp"), err) ||
+		!assert.Equal(t, domain.Order{ID: "tp", Market: "pi_ethusd", Typ: "sell", Price: 5000, Size: 2}, named) {
+		t.Fatal()
+	}
+
+	_ = r.CancelTrigger(context.Background(), m, "2")
+	err = r.CancelTrigger(context.Background(), m, "2")
+	if !assert.Equal(t, fmt.Errorf("%v: %v: %v", NoTrigger, m, "2"), err) {
+		t.Fatal()
+	}
+
+	var fired []string
+	for _, p := range []float64{4100, 4600} {
+		for _, o := range r.algo(m, domain.Candle{}, flat(p)) {
+			fired = append(fired, o.ID)
+		}
+	}
+	active, _ := r.GetActive(context.Background(), m)
+
+	res := []domain.Order{{ID: "tp", Market: "pi_ethusd", Typ: "sell", Price: 5000, Size: 2, Interval: "1m", Source: "ohlc4"}}
+	if !assert.Equal(t, []string{"1", "3"}, fired) || !assert.Equal(t, res, active) {
+		t.Fatalf("%v: Expect: %v, Got: %v", "ladder", res, active)
+	}
+}
+
+func TestSetFeed(t *testing.T) {
+	m := domain.Market("pi_ethusd")
+	r := New(krak, NewRepMock(), logger, notify)
+	r.SetMarket(context.Background(), m)
+
+	tests := []struct {
+		name string
+		feed domain.Feed
+		err  error
+		res  domain.Feed
+	}{
+		{"Interval", domain.Feed{Interval: "15m"}, nil, domain.Feed{Interval: "15m", Source: "ohlc4"}},
+		{"Source", domain.Feed{Source: "close"}, nil, domain.Feed{Interval: "15m", Source: "close"}},
+		{"Wrong interval", domain.Feed{Interval: "2m"}, fmt.Errorf("%v: %v", WrongFeed, "2m"), domain.Feed{Interval: "15m", Source: "close"}},
+		{"Wrong source", domain.Feed{Source: "avg"}, fmt.Errorf("%v: %v", WrongFeed, "avg"), domain.Feed{Interval: "15m", Source: "close"}},
+	}
+
+	for _, test := range tests {
+		err := r.SetFeed(context.Background(), m, test.feed)
+		res := r.trades[m].candleFeed()
+		if !assert.Equal(t, test.err, err, test.name) || !assert.Equal(t, test.res, res, test.name) {
+			t.Fatal()
+		}
+	}
+
+	r.trades[m].active = true
+	err := r.SetFeed(context.Background(), m, domain.Feed{Interval: "1h", Source: "hlc3"})
+	if !assert.Equal(t, fmt.Errorf("%v: %v", RunningFeed, m), err) ||
+		!assert.Equal(t, domain.Feed{Interval: "15m", Source: "close"}, r.trades[m].candleFeed()) {
+		t.Fatal()
+	}
+}
@@ -0,0 +1,72 @@
+package robot
+
+import (
+	"context"
+	"errors"
+	"sort"
+
+	"github.com/cgriceld/crypto-trade-bot/internal/domain"
+)
+
+const DefaultStrategy = "stoploss"
+
+var (
+	UnknownStrategy = errors.New("Unknown strategy")
+)
+
+// Strategy decides when inner orders of a market are sent to Kraken.
+// Every market runs its own instance, methods are called under the market lock.
+type Strategy interface {
+	// Candle is called on every new candle with its price and returns orders to send.
+	Candle(book *Book, candle domain.Candle, q Quote) []domain.Order
+	// Fill is called after order was successfully placed on Kraken.
+	Fill(book *Book, order domain.Order)
+}
+
+// strategies maps strategy names to constructors of new instances.
+var strategies = map[string]func() Strategy{
+	"stoploss": func() Strategy { return &threshold{} },
+	"breakout": func() Strategy { return &threshold{breakout: true} },
+}
+
+// Strategies returns names of all registered strategies.
+func (r *Robot) Strategies(ctx context.Context) []string {
+	var res []string
+	for name := range strategies {
+		res = append(res, name)
+	}
+	sort.Strings(res)
+
+	return res
+}
+
+// threshold compares price with fixed order prices. By default sell order
+// is triggered when price rises to its price (take-profit) and buy order when
+// price falls to it (stop-loss), breakout inverts both. Trailing orders are
+// always triggered on retracement. Orders without price and trailing are
+// triggered by their conditions only, conditions of other orders must hold
+// as well.
+type threshold struct {
+	breakout bool
+}
+
+func (s *threshold) Candle(book *Book, candle domain.Candle, q Quote) []domain.Order {
+	return book.Fire(q, func(t *Trigger) bool {
+		price := q.Side(t.typ)
+		if t.trail != nil {
+			return triggered(t.trail, t.typ, price, 0) && t.met()
+		}
+		if t.price == 0 {
+			return len(t.conds) > 0 && t.met()
+		}
+
+		typ := t.typ
+		if s.breakout {
+			typ = opposite(typ)
+		}
+		return triggered(nil, typ, price, float64(t.price)) && t.met()
+	})
+}
+
+func (s *threshold) Fill(book *Book, order domain.Order) {
+}
@@ -1,63 +1,114 @@
 package robot
 
 import (
-	"strconv"
-	"time"
+	"context"
+	"fmt"
 
 	"github.com/cgriceld/crypto-trade-bot/internal/domain"
+	"github.com/cgriceld/crypto-trade-bot/pkg/indicators"
 )
 
-func (r *Robot) avgPrice(candle domain.CandleSub) (float64, error) {
-	close, err := strconv.ParseFloat(candle.Cand.Close, 64)
-	if err != nil {
-		return 0, err
+// Quote is a candle price orders are triggered with, sell and buy orders
+// may use different prices of the same candle.
+type Quote struct {
+	Sell float64
+	Buy  float64
+}
+
+// flat returns quote with the same price for both sides.
+func flat(v float64) Quote {
+	return Quote{Sell: v, Buy: v}
+}
+
+// Side returns the price for orders of type typ.
+func (q Quote) Side(typ string) float64 {
+	if typ == "sell" {
+		return q.Sell
 	}
+	return q.Buy
+}
 
-	open, err := strconv.ParseFloat(candle.Cand.Open, 64)
+// candlePrice returns the price of candle by source (see domain.PriceSources).
+func candlePrice(candle domain.Candle, source string) (Quote, error) {
+	bar, err := indicators.NewBar(candle)
 	if err != nil {
-		return 0, err
+		return Quote{}, err
 	}
 
-	high, err := strconv.ParseFloat(candle.Cand.High, 64)
-	if err != nil {
-		return 0, err
+	switch source {
+	case "close":
+		return flat(bar.Close), nil
+	case "hlc3":
+		return flat((bar.High + bar.Low + bar.Close) / 3), nil
+	case "hilo":
+		return Quote{Sell: bar.High, Buy: bar.Low}, nil
+	default:
+		return flat((bar.Close + bar.Open + bar.High + bar.Low) / 4), nil
 	}
+}
 
-	low, err := strconv.ParseFloat(candle.Cand.Low, 64)
-	if err != nil {
-		return 0, err
+// algo passes the current price of market to its strategy, conditions are
+// evaluated on the closed candles fed by closeCandle.
+func (r *Robot) algo(m domain.Market, candle domain.Candle, q Quote) []domain.Order {
+	r.trades[m].muxTrade.Lock()
+	r.trades[m].pos.last = (q.Sell + q.Buy) / 2
+	r.trades[m].paperPos.last = r.trades[m].pos.last
+	res := r.trades[m].strategy.Candle(&r.trades[m].book, candle, q)
+	linked := r.trades[m].book.Cancelled()
+	r.trades[m].muxTrade.Unlock()
+
+	if len(res) > 0 || len(linked) > 0 {
+		r.save(m, r.trades[m])
 	}
 
-	return (close + open + high + low) / 4, nil
-}
+	for _, typ := range linked {
+		r.logger.Infof("%v: %v orders cancelled by OCO", m, typ)
+		r.notify.Notify(m, fmt.Sprintf("%v: %v: %v", CancelOCOBot, m, typ))
+
+		r.trades[m].muxExchange.Lock()
+		r.cancelLinked(context.Background(), m, r.trades[m], typ)
+		r.trades[m].muxExchange.Unlock()
+	}
 
-func (r *Robot) algo(m domain.Market, v float64) []domain.Order {
-	var res []domain.Order
+	return res
+}
 
+// closeCandle feeds candle closed by a new one to conditions of market.
+func (r *Robot) closeCandle(m domain.Market, candle domain.Candle, source string) {
 	r.trades[m].muxTrade.Lock()
-	ts := time.Now()
-	if r.trades[m].sellActive && v >= float64(r.trades[m].sellPrice) {
-		res = append(res, domain.Order{
-			Time:   &ts,
-			Market: string(m),
-			Typ:    "sell",
-			Price:  v,
-			Size:   int(r.trades[m].sellSize),
-		})
-		r.trades[m].sellActive = false
-	}
-
-	if r.trades[m].buyActive && v <= float64(r.trades[m].buyPrice) {
-		res = append(res, domain.Order{
-			Time:   &ts,
-			Market: string(m),
-			Typ:    "buy",
-			Price:  v,
-			Size:   int(r.trades[m].buySize),
-		})
-		r.trades[m].buyActive = false
+	err := r.trades[m].book.close(candle, source)
+	r.trades[m].muxTrade.Unlock()
+
+	if err != nil {
+		r.logger.Errorf("closeCandle: %v: Fail to convert price to float64: %v", m, err)
 	}
+}
+
+// fill passes executed order to the strategy of the market.
+func (r *Robot) fill(m domain.Market, order domain.Order) {
+	r.trades[m].muxTrade.Lock()
+	r.trades[m].strategy.Fill(&r.trades[m].book, order)
 	r.trades[m].muxTrade.Unlock()
+}
 
-	return res
+// triggered reports whether order of type typ fires at price v. Fixed orders
+// compare v with price, trailing ones move their best price first and fire
+// when v retraces from it by the trailing distance.
+func triggered(trail *domain.Trailing, typ string, v float64, price float64) bool {
+	if trail == nil {
+		if typ == "sell" {
+			return v >= price
+		}
+		return v <= price
+	}
+
+	if trail.Best == 0 || (typ == "sell" && v > trail.Best) || (typ == "buy" && v < trail.Best) {
+		trail.Best = v
+		return false
+	}
+
+	if typ == "sell" {
+		return v <= trail.Level(typ)
+	}
+	return v >= trail.Level(typ)
 }
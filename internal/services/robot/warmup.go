@@ -0,0 +1,98 @@
+package robot
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/cgriceld/crypto-trade-bot/internal/domain"
+)
+
+// DefaultWarmUp is the number of closed candles conditions of a market are
+// prefilled with on start.
+const DefaultWarmUp = 200
+
+// SetWarmUp sets the number of candles markets are prefilled with on start,
+// 0 disables warm-up.
+func (r *Robot) SetWarmUp(n int) {
+	r.muxAll.Lock()
+	r.warmUp = n
+	r.muxAll.Unlock()
+}
+
+// prefill feeds conditions of triggers of market with candle history, so that
+// they don't wait for the live feed to collect it. Failure only delays
+// the conditions, so it is logged.
+func (r *Robot) prefill(ctx context.Context, m domain.Market) {
+	r.muxAll.RLock()
+	n := r.warmUp
+	r.muxAll.RUnlock()
+	if n <= 0 {
+		return
+	}
+
+	r.trades[m].muxTrade.RLock()
+	feed := r.trades[m].candleFeed()
+	r.trades[m].muxTrade.RUnlock()
+
+	candles, source, err := r.history(ctx, m, feed.Interval, n, time.Now())
+	if err != nil {
+		r.logger.Warnf("prefill: %v: Fail to get candle history: %v", m, err)
+		return
+	}
+
+	r.trades[m].muxTrade.Lock()
+	// history candles are closed, so they go the same way as live ones
+	for _, c := range candles {
+		_ = r.trades[m].book.close(c, feed.Source)
+	}
+	r.trades[m].muxTrade.Unlock()
+
+	r.logger.Infof("%v: Conditions are warmed up with %v %v candles from %v", m, len(candles), feed.Interval, source)
+}
+
+// history returns up to n candles of market with interval closed before now,
+// oldest first, and where they were taken from. Stored candles are used if
+// there are no gaps in them, otherwise candles are fetched from Kraken.
+func (r *Robot) history(ctx context.Context, m domain.Market, interval string, n int, now time.Time) ([]domain.Candle, string, error) {
+	d := domain.IntervalDuration(interval)
+	if d == 0 {
+		return nil, "", fmt.Errorf("%v: %v", WrongFeed, interval)
+	}
+	// the current candle comes from the live feed
+	to := now.Truncate(d)
+	from := to.Add(-time.Duration(n) * d)
+
+	stored, err := r.repo.GetCandles(ctx, domain.CandleFilter{Market: string(m), Interval: interval, From: &from, To: &to,
+		Limit: n, Desc: true})
+	if err != nil {
+		r.logger.Warnf("history: %v: Fail to read stored candles: %v", m, err)
+	}
+	if err == nil && len(stored) == n && stored[0].Time.Equal(to.Add(-d)) {
+		return reversed(stored), "database", nil
+	}
+
+	fetched, err := r.kraken.History(ctx, m, interval, from, to)
+	if err != nil {
+		if len(stored) > 0 {
+			r.logger.Warnf("history: %v: %v, stored candles are used", m, err)
+			return reversed(stored), "database", nil
+		}
+		return nil, "", err
+	}
+	if len(fetched) > n {
+		fetched = fetched[len(fetched)-n:]
+	}
+
+	return fetched, "Kraken", nil
+}
+
+// reversed converts candles sorted newest first to Kraken candles, oldest first.
+func reversed(records []domain.CandleRecord) []domain.Candle {
+	res := make([]domain.Candle, len(records))
+	for i, v := range records {
+		res[len(records)-1-i] = v.Candle()
+	}
+
+	return res
+}
@@ -0,0 +1,211 @@
+package indicators
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	WrongCondition = errors.New("Wrong condition")
+)
+
+// MaxPeriod is the longest period of indicators, SMA and Bollinger Bands keep
+// the whole period of candles.
+const MaxPeriod = 1000
+
+// operators are checked in order, so that ">=" is not taken for ">".
+var operators = []string{"crosses_above", "crosses_below", ">=", "<=", ">", "<"}
+
+// operand is a side of condition: candle price, a constant or an indicator.
+type operand struct {
+	price bool
+	ind   Indicator
+	value func() float64
+	ready func() bool
+}
+
+// Condition compares two operands on every candle, e.g. "rsi(14) > 70" or
+// "price crosses_above ema(20)", operator is separated by spaces. Operands are:
+//
+//	price                                         - trigger price of the candle
+//	number                                        - a constant
+//	sma(n), ema(n), rsi(n), atr(n)
+//	bb_upper(n,k), bb_middle(n,k), bb_lower(n,k)  - Bollinger Bands
+//	macd(fast,slow,signal), macd_signal(...), macd_hist(...)
+//
+// Periods are whole numbers up to MaxPeriod.
+type Condition struct {
+	expr  string
+	op    string
+	left  operand
+	right operand
+
+	// differences of left and right operands on the last two candles
+	prev, cur           float64
+	prevReady, curReady bool
+}
+
+// Parse parses condition expression, see Condition.
+func Parse(expr string) (*Condition, error) {
+	expr = strings.Join(strings.Fields(expr), " ")
+
+	for _, op := range operators {
+		parts := strings.SplitN(expr, " "+op+" ", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		left, err := parseOperand(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v: %v", WrongCondition, expr, err)
+		}
+		right, err := parseOperand(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v: %v", WrongCondition, expr, err)
+		}
+
+		return &Condition{expr: expr, op: op, left: left, right: right}, nil
+	}
+
+	return nil, fmt.Errorf("%v: %v: no operator", WrongCondition, expr)
+}
+
+func parseOperand(s string) (operand, error) {
+	s = strings.ReplaceAll(s, " ", "")
+
+	if s == "price" {
+		return operand{price: true}, nil
+	}
+	if v, err := strconv.ParseFloat(s, 64); err == nil {
+		return operand{
+			value: func() float64 { return v },
+			ready: func() bool { return true },
+		}, nil
+	}
+
+	open := strings.Index(s, "(")
+	if open <= 0 || !strings.HasSuffix(s, ")") {
+		return operand{}, fmt.Errorf("unknown operand %v", s)
+	}
+	name := s[:open]
+
+	var args []float64
+	for _, a := range strings.Split(s[open+1:len(s)-1], ",") {
+		v, err := strconv.ParseFloat(a, 64)
+		if err != nil || v <= 0 {
+			return operand{}, fmt.Errorf("wrong argument of %v: %v", name, a)
+		}
+		args = append(args, v)
+	}
+
+	period := func(i int) int { return int(args[i]) }
+	nargs := map[string]int{
+		"sma": 1, "ema": 1, "rsi": 1, "atr": 1,
+		"bb_upper": 2, "bb_middle": 2, "bb_lower": 2,
+		"macd": 3, "macd_signal": 3, "macd_hist": 3,
+	}
+	n, ok := nargs[name]
+	if !ok {
+		return operand{}, fmt.Errorf("unknown indicator %v", name)
+	}
+	if len(args) != n {
+		return operand{}, fmt.Errorf("%v expects %v arguments", name, n)
+	}
+	for i, v := range args {
+		// the second argument of Bollinger Bands is a multiplier
+		if strings.HasPrefix(name, "bb_") && i == 1 {
+			continue
+		}
+		if v != float64(int(v)) || v > MaxPeriod {
+			return operand{}, fmt.Errorf("wrong period of %v: %v", name, v)
+		}
+	}
+
+	switch name {
+	case "sma":
+		return indicator(NewSMA(period(0))), nil
+	case "ema":
+		return indicator(NewEMA(period(0))), nil
+	case "rsi":
+		return indicator(NewRSI(period(0))), nil
+	case "atr":
+		return indicator(NewATR(period(0))), nil
+	case "bb_upper", "bb_middle", "bb_lower":
+		bb := NewBollinger(period(0), args[1])
+		op := indicator(bb)
+		if name == "bb_upper" {
+			op.value = bb.Upper
+		} else if name == "bb_lower" {
+			op.value = bb.Lower
+		}
+		return op, nil
+	default:
+		macd := NewMACD(period(0), period(1), period(2))
+		op := indicator(macd)
+		if name == "macd_signal" {
+			op.value, op.ready = macd.Signal, macd.SignalReady
+		} else if name == "macd_hist" {
+			op.value, op.ready = macd.Hist, macd.SignalReady
+		}
+		return op, nil
+	}
+}
+
+func indicator(ind Indicator) operand {
+	return operand{ind: ind, value: ind.Value, ready: ind.Ready}
+}
+
+func (o *operand) add(bar Bar) {
+	if o.ind != nil {
+		o.ind.Add(bar)
+	}
+}
+
+func (o *operand) get(price float64) (float64, bool) {
+	if o.price {
+		return price, true
+	}
+	return o.value(), o.ready()
+}
+
+// Update adds candle to indicators of condition, price is the trigger price
+// of the candle.
+func (c *Condition) Update(bar Bar, price float64) {
+	c.left.add(bar)
+	c.right.add(bar)
+
+	c.prev, c.prevReady = c.cur, c.curReady
+
+	l, lok := c.left.get(price)
+	r, rok := c.right.get(price)
+	c.cur, c.curReady = l-r, lok && rok
+}
+
+// Met reports whether condition holds on the last candle. Crossing requires
+// two candles with ready indicators.
+func (c *Condition) Met() bool {
+	if !c.curReady {
+		return false
+	}
+
+	switch c.op {
+	case ">":
+		return c.cur > 0
+	case "<":
+		return c.cur < 0
+	case ">=":
+		return c.cur >= 0
+	case "<=":
+		return c.cur <= 0
+	case "crosses_above":
+		return c.prevReady && c.prev <= 0 && c.cur > 0
+	default:
+		return c.prevReady && c.prev >= 0 && c.cur < 0
+	}
+}
+
+func (c *Condition) String() string {
+	return c.expr
+}
@@ -0,0 +1,82 @@
+package indicators
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type Parsed struct {
+	expr string
+	res  string
+	err  bool
+}
+
+func TestParse(t *testing.T) {
+	tests := []Parsed{
+		{"rsi(14) > 70", "rsi(14) > 70", false},
+		{"price   crosses_above ema(20)", "price crosses_above ema(20)", false},
+		{"bb_lower(20, 2.5) >= price", "bb_lower(20, 2.5) >= price", false},
+		{"macd_hist(12,26,9) < -1", "macd_hist(12,26,9) < -1", false},
+		{"rsi(14) above 70", "", true},
+		{"rsi(14)>70", "", true},
+		{"vwap(14) > 70", "", true},
+		{"sma(20,2) > price", "", true},
+		{"ema(2.5) > price", "", true},
+		{"atr(0) > 10", "", true},
+		{"sma(1000) > price", "sma(1000) > price", false},
+		{"sma(1001) > price", "", true},
+		{"macd(12,100000000,9) > 0", "", true},
+		{"price > close", "", true},
+	}
+
+	for _, test := range tests {
+		cond, err := Parse(test.expr)
+		if test.err {
+			if !assert.Error(t, err, test.expr) {
+				t.Fatal()
+			}
+			continue
+		}
+
+		if !assert.NoError(t, err, test.expr) || !assert.Equal(t, test.res, cond.String(), test.expr) {
+			t.Fatal()
+		}
+	}
+}
+
+type Conditions struct {
+	name   string
+	expr   string
+	bars   []Bar
+	prices []float64
+	met    []bool
+}
+
+func TestConditionMet(t *testing.T) {
+	tests := []Conditions{
+		{"Crosses above", "price crosses_above sma(2)", closes(10, 10, 10, 10),
+			[]float64{9, 9, 11, 12}, []bool{false, false, true, false}},
+		{"Crosses below", "price crosses_below sma(2)", closes(10, 10, 10),
+			[]float64{11, 11, 9}, []bool{false, false, true}},
+		{"Greater", "rsi(2) > 70", closes(1, 2, 3, 2),
+			[]float64{0, 0, 0, 0}, []bool{false, false, true, false}},
+		{"Constant", "price <= 100", closes(1, 1),
+			[]float64{100, 101}, []bool{true, false}},
+	}
+
+	for _, test := range tests {
+		cond, err := Parse(test.expr)
+		if !assert.NoError(t, err, test.name) {
+			t.Fatal()
+		}
+
+		for i, bar := range test.bars {
+			cond.Update(bar, test.prices[i])
+
+			if !assert.Equal(t, test.met[i], cond.Met(), "%v: bar %v", test.name, i) {
+				t.Fatal()
+			}
+		}
+	}
+}
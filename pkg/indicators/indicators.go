@@ -0,0 +1,299 @@
+// Package indicators implements technical indicators which are updated
+// incrementally, one candle at a time.
+package indicators
+
+import (
+	"math"
+	"strconv"
+
+	"github.com/cgriceld/crypto-trade-bot/internal/domain"
+)
+
+// Bar is a candle with parsed prices.
+type Bar struct {
+	Open  float64
+	High  float64
+	Low   float64
+	Close float64
+}
+
+// NewBar parses prices of Kraken candle.
+func NewBar(c domain.Candle) (Bar, error) {
+	var ohlc [4]float64
+	for i, v := range []string{c.Open, c.High, c.Low, c.Close} {
+		val, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return Bar{}, err
+		}
+		ohlc[i] = val
+	}
+
+	return Bar{Open: ohlc[0], High: ohlc[1], Low: ohlc[2], Close: ohlc[3]}, nil
+}
+
+// Indicator is updated with every new bar. Value is meaningless until Ready.
+type Indicator interface {
+	Add(bar Bar)
+	Value() float64
+	Ready() bool
+}
+
+// window keeps the last n values and their sum.
+type window struct {
+	values []float64
+	next   int
+	full   bool
+	sum    float64
+}
+
+func newWindow(n int) *window {
+	return &window{values: make([]float64, n)}
+}
+
+func (w *window) add(v float64) {
+	w.sum += v - w.values[w.next]
+	w.values[w.next] = v
+	w.next = (w.next + 1) % len(w.values)
+	if w.next == 0 {
+		w.full = true
+	}
+}
+
+func (w *window) mean() float64 {
+	return w.sum / float64(len(w.values))
+}
+
+// SMA is a simple moving average of close prices over n bars.
+type SMA struct {
+	w *window
+}
+
+func NewSMA(n int) *SMA {
+	return &SMA{w: newWindow(n)}
+}
+
+func (s *SMA) Add(bar Bar) {
+	s.w.add(bar.Close)
+}
+
+func (s *SMA) Value() float64 {
+	return s.w.mean()
+}
+
+func (s *SMA) Ready() bool {
+	return s.w.full
+}
+
+// ema is an exponential moving average of arbitrary values, seeded by
+// the simple average of the first n values.
+type ema struct {
+	n     int
+	count int
+	alpha float64
+	value float64
+}
+
+func newEMA(n int) *ema {
+	return &ema{n: n, alpha: 2 / float64(n+1)}
+}
+
+func (e *ema) add(v float64) {
+	e.count++
+	if e.count <= e.n {
+		e.value += v / float64(e.n)
+		return
+	}
+	e.value += e.alpha * (v - e.value)
+}
+
+func (e *ema) ready() bool {
+	return e.count >= e.n
+}
+
+// EMA is an exponential moving average of close prices over n bars.
+type EMA struct {
+	e *ema
+}
+
+func NewEMA(n int) *EMA {
+	return &EMA{e: newEMA(n)}
+}
+
+func (e *EMA) Add(bar Bar) {
+	e.e.add(bar.Close)
+}
+
+func (e *EMA) Value() float64 {
+	return e.e.value
+}
+
+func (e *EMA) Ready() bool {
+	return e.e.ready()
+}
+
+// wilder is Wilder's smoothing (RMA): the simple average of the first n
+// values, then avg = (avg*(n-1) + v) / n.
+type wilder struct {
+	n     int
+	count int
+	value float64
+}
+
+func (w *wilder) add(v float64) {
+	w.count++
+	if w.count <= w.n {
+		w.value += v / float64(w.n)
+		return
+	}
+	w.value = (w.value*float64(w.n-1) + v) / float64(w.n)
+}
+
+func (w *wilder) ready() bool {
+	return w.count >= w.n
+}
+
+// RSI is Wilder's relative strength index of close prices over n bars.
+type RSI struct {
+	prev  float64
+	first bool
+	gain  wilder
+	loss  wilder
+}
+
+func NewRSI(n int) *RSI {
+	return &RSI{first: true, gain: wilder{n: n}, loss: wilder{n: n}}
+}
+
+func (r *RSI) Add(bar Bar) {
+	if r.first {
+		r.prev, r.first = bar.Close, false
+		return
+	}
+
+	change := bar.Close - r.prev
+	r.prev = bar.Close
+	r.gain.add(math.Max(change, 0))
+	r.loss.add(math.Max(-change, 0))
+}
+
+func (r *RSI) Value() float64 {
+	if r.loss.value == 0 {
+		return 100
+	}
+	return 100 - 100/(1+r.gain.value/r.loss.value)
+}
+
+func (r *RSI) Ready() bool {
+	return r.gain.ready()
+}
+
+// ATR is Wilder's average true range over n bars.
+type ATR struct {
+	prev  float64
+	first bool
+	tr    wilder
+}
+
+func NewATR(n int) *ATR {
+	return &ATR{first: true, tr: wilder{n: n}}
+}
+
+func (a *ATR) Add(bar Bar) {
+	tr := bar.High - bar.Low
+	if !a.first {
+		tr = math.Max(tr, math.Max(math.Abs(bar.High-a.prev), math.Abs(bar.Low-a.prev)))
+	}
+	a.prev, a.first = bar.Close, false
+	a.tr.add(tr)
+}
+
+func (a *ATR) Value() float64 {
+	return a.tr.value
+}
+
+func (a *ATR) Ready() bool {
+	return a.tr.ready()
+}
+
+// Bollinger is Bollinger Bands of close prices: SMA over n bars (Value)
+// and bands k standard deviations above and below it.
+type Bollinger struct {
+	k float64
+	w *window
+}
+
+func NewBollinger(n int, k float64) *Bollinger {
+	return &Bollinger{k: k, w: newWindow(n)}
+}
+
+func (b *Bollinger) Add(bar Bar) {
+	b.w.add(bar.Close)
+}
+
+func (b *Bollinger) Value() float64 {
+	return b.w.mean()
+}
+
+func (b *Bollinger) Ready() bool {
+	return b.w.full
+}
+
+func (b *Bollinger) deviation() float64 {
+	mean := b.w.mean()
+
+	var sum float64
+	for _, v := range b.w.values {
+		sum += (v - mean) * (v - mean)
+	}
+
+	return math.Sqrt(sum / float64(len(b.w.values)))
+}
+
+func (b *Bollinger) Upper() float64 {
+	return b.Value() + b.k*b.deviation()
+}
+
+func (b *Bollinger) Lower() float64 {
+	return b.Value() - b.k*b.deviation()
+}
+
+// MACD is the difference of fast and slow EMAs of close prices (Value),
+// its EMA over signal bars (Signal) and their difference (Hist).
+type MACD struct {
+	fast   *ema
+	slow   *ema
+	signal *ema
+}
+
+func NewMACD(fast, slow, signal int) *MACD {
+	return &MACD{fast: newEMA(fast), slow: newEMA(slow), signal: newEMA(signal)}
+}
+
+func (m *MACD) Add(bar Bar) {
+	m.fast.add(bar.Close)
+	m.slow.add(bar.Close)
+	if m.Ready() {
+		m.signal.add(m.Value())
+	}
+}
+
+func (m *MACD) Value() float64 {
+	return m.fast.value - m.slow.value
+}
+
+func (m *MACD) Ready() bool {
+	return m.fast.ready() && m.slow.ready()
+}
+
+func (m *MACD) Signal() float64 {
+	return m.signal.value
+}
+
+func (m *MACD) Hist() float64 {
+	return m.Value() - m.signal.value
+}
+
+// SignalReady reports whether Signal and Hist are ready.
+func (m *MACD) SignalReady() bool {
+	return m.signal.ready()
+}
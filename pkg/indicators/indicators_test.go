@@ -0,0 +1,95 @@
+package indicators
+
+import (
+	"testing"
+
+	"github.com/cgriceld/crypto-trade-bot/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func closes(values ...float64) []Bar {
+	var res []Bar
+	for _, v := range values {
+		res = append(res, Bar{Open: v, High: v, Low: v, Close: v})
+	}
+
+	return res
+}
+
+type Indicators struct {
+	name  string
+	ind   Indicator
+	bars  []Bar
+	ready []bool
+	res   []float64
+}
+
+func TestIndicators(t *testing.T) {
+	tests := []Indicators{
+		{"SMA", NewSMA(3), closes(1, 2, 3, 4),
+			[]bool{false, false, true, true}, []float64{0, 0, 2, 3}},
+		{"EMA", NewEMA(3), closes(1, 2, 3, 4, 5),
+			[]bool{false, false, true, true, true}, []float64{0, 0, 2, 3, 4}},
+		{"RSI", NewRSI(2), closes(1, 2, 3, 2),
+			[]bool{false, false, true, true}, []float64{0, 0, 100, 50}},
+		{"ATR", NewATR(2), []Bar{{High: 10, Low: 8, Close: 9}, {High: 12, Low: 9, Close: 11}, {High: 11, Low: 10, Close: 10}},
+			[]bool{false, true, true}, []float64{0, 2.5, 1.75}},
+		{"Bollinger middle", NewBollinger(2, 2), closes(1, 3),
+			[]bool{false, true}, []float64{0, 2}},
+		{"MACD", NewMACD(1, 2, 2), closes(1, 2, 3, 6),
+			[]bool{false, true, true, true}, []float64{0, 0.5, 0.5, 7.0 / 6}},
+	}
+
+	for _, test := range tests {
+		for i, bar := range test.bars {
+			test.ind.Add(bar)
+
+			if !assert.Equal(t, test.ready[i], test.ind.Ready(), "%v: bar %v: ready", test.name, i) {
+				t.Fatal()
+			}
+			if test.ready[i] && !assert.InDelta(t, test.res[i], test.ind.Value(), 1e-9, "%v: bar %v", test.name, i) {
+				t.Fatal()
+			}
+		}
+	}
+}
+
+func TestBollingerBands(t *testing.T) {
+	bb := NewBollinger(2, 2)
+	for _, bar := range closes(1, 3) {
+		bb.Add(bar)
+	}
+
+	if !assert.InDelta(t, 4, bb.Upper(), 1e-9) || !assert.InDelta(t, 0, bb.Lower(), 1e-9) {
+		t.Fatal()
+	}
+}
+
+func TestMACDSignal(t *testing.T) {
+	macd := NewMACD(1, 2, 2)
+	for _, bar := range closes(1, 2, 3) {
+		macd.Add(bar)
+	}
+	if !assert.True(t, macd.SignalReady()) || !assert.InDelta(t, 0.5, macd.Signal(), 1e-9) {
+		t.Fatal()
+	}
+
+	macd.Add(closes(6)[0])
+	signal := 0.5 + 2.0/3*(7.0/6-0.5)
+	if !assert.InDelta(t, signal, macd.Signal(), 1e-9) || !assert.InDelta(t, 7.0/6-signal, macd.Hist(), 1e-9) {
+		t.Fatal()
+	}
+}
+
+func TestNewBar(t *testing.T) {
+	bar, err := NewBar(domain.Candle{Open: "1", High: "4", Low: "0.5", Close: "2"})
+	if !assert.NoError(t, err) || !assert.Equal(t, Bar{Open: 1, High: 4, Low: 0.5, Close: 2}, bar) {
+		t.Fatal()
+	}
+
+	_, err = NewBar(domain.Candle{Open: "1", High: "x", Low: "0.5", Close: "2"})
+	if !assert.Error(t, err) {
+		t.Fatal()
+	}
+}
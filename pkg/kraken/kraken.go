@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 
@@ -16,36 +17,45 @@ import (
 )
 
 const (
-	sendOrderEndpoint = "/api/v3/sendorder"
-	accountsEndpoint  = "/api/v3/accounts"
+	sendOrderEndpoint       = "/api/v3/sendorder"
+	editOrderEndpoint       = "/api/v3/editorder"
+	cancelOrderEndpoint     = "/api/v3/cancelorder"
+	cancelAllOrdersEndpoint = "/api/v3/cancelallorders"
+	openOrdersEndpoint      = "/api/v3/openorders"
+	openPositionsEndpoint   = "/api/v3/openpositions"
+	fillsEndpoint           = "/api/v3/fills"
+	accountsEndpoint        = "/api/v3/accounts"
 )
 
+// fillTime is the time format of Kraken fills.
+const fillTime = "2006-01-02T15:04:05.000Z"
+
 type Notifications interface {
 	Notify(m domain.Market, message string)
 }
 
-type Connection struct {
-	ws *websocket.Conn
-	wg sync.WaitGroup
-}
-
-type Conns map[domain.Market]*Connection
-
 type Kraken struct {
 	notify Notifications
 	logger log.Logger
 	urls   *domain.Urls
 	keys   *domain.API
 	client http.Client
-	muxAll sync.Mutex
-	conns  Conns
+
+	// shared websocket connection and markets subscribed on it
+	muxConnect sync.Mutex
+	muxWrite   sync.Mutex
+	muxWs      sync.RWMutex
+	ws         *websocket.Conn
+	stopChan   chan struct{}
+	subs       map[domain.Market]*subscription
+	wg         sync.WaitGroup
 }
 
 func New(logger log.Logger, notify Notifications, APIPublic string, APIPrivate string) *Kraken {
 	k := &Kraken{
 		notify: notify,
 		logger: logger,
-		conns:  make(Conns),
+		subs:   make(map[domain.Market]*subscription),
 	}
 
 	k.urls = domain.NewUrls()
@@ -58,17 +68,14 @@ func New(logger log.Logger, notify Notifications, APIPublic string, APIPrivate s
 	return k
 }
 
+// SetMarket does nothing, markets are added to the shared connection by Subscribe.
 func (k *Kraken) SetMarket(ctx context.Context, m domain.Market) {
-	k.muxAll.Lock()
-	_, ok := k.conns[m]
-	if !ok {
-		k.conns[m] = &Connection{}
-	}
-	k.muxAll.Unlock()
 }
 
-func (k *Kraken) makeRequest(method string, url string, endpoint string, query string) ([]byte, error) {
-	req, err := http.NewRequest(method, url, nil)
+// makeRequest sends authenticated request to private endpoint, it is
+// cancelled with ctx.
+func (k *Kraken) makeRequest(ctx context.Context, method string, url string, endpoint string, query string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("Fail to create request: %w", err)
 	}
@@ -92,42 +99,175 @@ func (k *Kraken) makeRequest(method string, url string, endpoint string, query s
 	return by, nil
 }
 
-func (k *Kraken) Stop(ctx context.Context, m domain.Market) {
-	if k.conns[m].ws != nil {
-		k.conns[m].ws.Close()
+func (k *Kraken) SendOrder(ctx context.Context, order domain.Order) (*domain.RespOrder, error) {
+	query := orderQuery(order)
+
+	res, err := k.makeRequest(ctx, http.MethodPost, k.urls.SendOrder+"?"+query, sendOrderEndpoint, query)
+	if err != nil {
+		return nil, err
+	}
+
+	var respOrder domain.RespOrder
+	err = json.Unmarshal(res, &respOrder)
+	if err != nil {
+		return nil, fmt.Errorf("Fail to decode response: %w", err)
+	}
+
+	return &respOrder, nil
+}
+
+// orderQuery builds sendorder query of order type. Market orders have no
+// price, stop and take profit orders are sent without limit price, so they
+// become market orders when triggered.
+func orderQuery(order domain.Order) string {
+	query := fmt.Sprintf("orderType=%v&symbol=%v&side=%v&size=%v", order.Kind(), order.Market, order.Typ, order.Size)
+	switch {
+	case order.Kind() == domain.OrderMarket:
+	case order.Stop():
+		query += fmt.Sprintf("&stopPrice=%v", order.StopPrice)
+		if order.TriggerSignal != "" {
+			query += "&triggerSignal=" + order.TriggerSignal
+		}
+	default:
+		query += fmt.Sprintf("&limitPrice=%v", order.Price)
+	}
+	if order.ReduceOnly {
+		query += "&reduceOnly=true"
+	}
+	if order.ClientID != "" {
+		query += "&cliOrdId=" + order.ClientID
 	}
 
-	k.conns[m].wg.Wait()
+	return query
 }
 
-func (k *Kraken) Start(m domain.Market) <-chan domain.CandleSub {
-	candles, stopChan := k.listenCandles(m)
+// EditOrder changes size and stop price of stop or take profit order with
+// orderID to the ones of order.
+func (k *Kraken) EditOrder(ctx context.Context, orderID string, order domain.Order) (*domain.RespEdit, error) {
+	query := fmt.Sprintf("orderId=%v&size=%v&stopPrice=%v", orderID, order.Size, order.StopPrice)
+
+	res, err := k.makeRequest(ctx, http.MethodPost, k.urls.EditOrder+"?"+query, editOrderEndpoint, query)
+	if err != nil {
+		return nil, fmt.Errorf("EditOrder: %w", err)
+	}
 
-	k.conns[m].wg.Add(1)
-	go k.keepAlive(m, stopChan)
+	var respEdit domain.RespEdit
+	if err = json.Unmarshal(res, &respEdit); err != nil {
+		return nil, fmt.Errorf("EditOrder: Fail to decode response: %w", err)
+	}
 
-	return candles
+	return &respEdit, nil
 }
 
-func (k *Kraken) SendOrder(order domain.Order) (*domain.RespOrder, error) {
-	query := fmt.Sprintf("orderType=ioc&symbol=%v&side=%v&size=%v&limitPrice=%v", order.Market, order.Typ, order.Size, order.Price)
+// CancelOrder cancels order with orderID.
+func (k *Kraken) CancelOrder(ctx context.Context, orderID string) (*domain.RespCancel, error) {
+	query := "order_id=" + orderID
 
-	res, err := k.makeRequest(http.MethodPost, k.urls.SendOrder+"?"+query, sendOrderEndpoint, query)
+	res, err := k.makeRequest(ctx, http.MethodPost, k.urls.CancelOrder+"?"+query, cancelOrderEndpoint, query)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("CancelOrder: %w", err)
 	}
 
-	var respOrder domain.RespOrder
-	err = json.Unmarshal(res, &respOrder)
+	var respCancel domain.RespCancel
+	if err = json.Unmarshal(res, &respCancel); err != nil {
+		return nil, fmt.Errorf("CancelOrder: Fail to decode response: %w", err)
+	}
+
+	return &respCancel, nil
+}
+
+// CancelAllOrders cancels all open orders of market, or of all markets if m
+// is empty.
+func (k *Kraken) CancelAllOrders(ctx context.Context, m domain.Market) (*domain.CancelAllStatus, error) {
+	var query string
+	if m != "" {
+		query = "symbol=" + string(m)
+	}
+
+	var resp struct {
+		Status domain.CancelAllStatus `json:"cancelStatus"`
+	}
+	if err := k.call(ctx, http.MethodPost, k.urls.CancelAllOrders, cancelAllOrdersEndpoint, query, &resp); err != nil {
+		return nil, fmt.Errorf("CancelAllOrders: %w", err)
+	}
+
+	return &resp.Status, nil
+}
+
+// OpenOrders returns orders of the account resting in the order book.
+func (k *Kraken) OpenOrders(ctx context.Context) ([]domain.OpenOrder, error) {
+	var resp struct {
+		Orders []domain.OpenOrder `json:"openOrders"`
+	}
+	if err := k.call(ctx, http.MethodGet, k.urls.OpenOrders, openOrdersEndpoint, "", &resp); err != nil {
+		return nil, fmt.Errorf("OpenOrders: %w", err)
+	}
+
+	return resp.Orders, nil
+}
+
+// OpenPositions returns open positions of the account.
+func (k *Kraken) OpenPositions(ctx context.Context) ([]domain.OpenPosition, error) {
+	var resp struct {
+		Positions []domain.OpenPosition `json:"openPositions"`
+	}
+	if err := k.call(ctx, http.MethodGet, k.urls.OpenPositions, openPositionsEndpoint, "", &resp); err != nil {
+		return nil, fmt.Errorf("OpenPositions: %w", err)
+	}
+
+	return resp.Positions, nil
+}
+
+// Fills returns the last 100 fills of the account before time before, the last
+// 100 fills if it's nil.
+func (k *Kraken) Fills(ctx context.Context, before *time.Time) ([]domain.Fill, error) {
+	var query string
+	if before != nil {
+		query = "lastFillTime=" + before.UTC().Format(fillTime)
+	}
+
+	var resp struct {
+		Fills []domain.Fill `json:"fills"`
+	}
+	if err := k.call(ctx, http.MethodGet, k.urls.Fills, fillsEndpoint, query, &resp); err != nil {
+		return nil, fmt.Errorf("Fills: %w", err)
+	}
+
+	return resp.Fills, nil
+}
+
+// call sends request to private endpoint and decodes successful response
+// to resp, Kraken error is returned as domain.UnsuccessfulResponse.
+func (k *Kraken) call(ctx context.Context, method string, url string, endpoint string, query string, resp interface{}) error {
+	if query != "" {
+		url += "?" + query
+	}
+
+	res, err := k.makeRequest(ctx, method, url, endpoint, query)
 	if err != nil {
-		return nil, fmt.Errorf("Fail to decode response: %w", err)
+		return err
 	}
 
-	return &respOrder, nil
+	var status struct {
+		Result string `json:"result"`
+		Error  string `json:"error"`
+	}
+	if err = json.Unmarshal(res, &status); err != nil {
+		return fmt.Errorf("Fail to decode response: %w", err)
+	}
+	if status.Result != "success" {
+		return fmt.Errorf("%w: %s", domain.UnsuccessfulResponse, status.Error)
+	}
+	if err = json.Unmarshal(res, resp); err != nil {
+		return fmt.Errorf("Fail to decode response: %w", err)
+	}
+
+	return nil
 }
 
+// Accounts returns all accounts of the user whatever their type is.
 func (k *Kraken) Accounts(ctx context.Context) (*domain.AccountsResp, error) {
-	res, err := k.makeRequest(http.MethodGet, k.urls.Accounts, accountsEndpoint, "")
+	res, err := k.makeRequest(ctx, http.MethodGet, k.urls.Accounts, accountsEndpoint, "")
 	if err != nil {
 		return nil, fmt.Errorf("Accounts: %w", err)
 	}
@@ -137,16 +277,92 @@ func (k *Kraken) Accounts(ctx context.Context) (*domain.AccountsResp, error) {
 		return nil, fmt.Errorf("Accounts: Fail to decode response: %w", err)
 	}
 	if wallet.Result != "success" {
-		return nil, fmt.Errorf("Accounts: Unsuccessful response: %s", wallet.Error)
+		return nil, fmt.Errorf("Accounts: %w: %s", domain.UnsuccessfulResponse, wallet.Error)
 	}
 
 	acc := &domain.AccountsResp{
-		Fi_xbtusd: wallet.Accounts.Fi_xbtusd.Aux.Af,
-		Fi_bchusd: wallet.Accounts.Fi_bchusd.Aux.Af,
-		Fi_ethusd: wallet.Accounts.Fi_ethusd.Aux.Af,
-		Fi_ltcusd: wallet.Accounts.Fi_ltcusd.Aux.Af,
-		Fi_xrpusd: wallet.Accounts.Fi_xrpusd.Aux.Af,
-		Fv_xrpxbt: wallet.Accounts.Fv_xrpxbt.Aux.Af,
+		ServerTime: wallet.ServerTime,
+		Accounts:   make(map[string]domain.Account, len(wallet.Accounts)),
+	}
+	for name, funds := range wallet.Accounts {
+		acc.Accounts[name] = funds.Account()
 	}
+
 	return acc, nil
 }
+
+// Instruments returns contracts listed on Kraken from the public API, symbols
+// are in lower case as markets of the robot.
+func (k *Kraken) Instruments(ctx context.Context) ([]domain.Instrument, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, k.urls.Instruments, nil)
+	if err != nil {
+		return nil, fmt.Errorf("Instruments: Fail to create request: %w", err)
+	}
+
+	res, err := k.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Instruments: Fail to send request: %w", err)
+	}
+	defer res.Body.Close()
+
+	var resp struct {
+		Result      string              `json:"result"`
+		Instruments []domain.Instrument `json:"instruments"`
+		Error       string              `json:"error"`
+	}
+	if err = json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("Instruments: Fail to decode response: %w", err)
+	}
+	if resp.Result != "success" {
+		return nil, fmt.Errorf("Instruments: Unsuccessful response: %s", resp.Error)
+	}
+
+	for i := range resp.Instruments {
+		resp.Instruments[i].Symbol = strings.ToLower(resp.Instruments[i].Symbol)
+	}
+
+	return resp.Instruments, nil
+}
+
+// History returns candles of market with interval in time range [from, to)
+// from the public charts API, oldest first.
+func (k *Kraken) History(ctx context.Context, m domain.Market, interval string, from time.Time, to time.Time) ([]domain.Candle, error) {
+	url := fmt.Sprintf("%v/%v/%v?from=%d&to=%d", k.urls.Charts, strings.ToUpper(string(m)), interval, from.Unix(), to.Unix())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("History: Fail to create request: %w", err)
+	}
+
+	res, err := k.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("History: Fail to send request: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("History: Unsuccessful response: %v", res.Status)
+	}
+
+	// volume is a string in charts API
+	var chart struct {
+		Candles []struct {
+			domain.Candle
+			Volume json.Number `json:"volume"`
+		} `json:"candles"`
+	}
+	if err = json.NewDecoder(res.Body).Decode(&chart); err != nil {
+		return nil, fmt.Errorf("History: Fail to decode response: %w", err)
+	}
+
+	var candles []domain.Candle
+	for _, v := range chart.Candles {
+		c := v.Candle
+		c.Volume, _ = v.Volume.Float64()
+		if c.Time < float64(from.UnixMilli()) || c.Time >= float64(to.UnixMilli()) {
+			continue
+		}
+		candles = append(candles, c)
+	}
+
+	return candles, nil
+}
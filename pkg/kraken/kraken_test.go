@@ -7,8 +7,8 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"os"
-	"reflect"
 	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -39,29 +39,17 @@ func TestMain(m *testing.M) {
 	os.Exit(code)
 }
 
-type SetMarket struct {
-	name   string
-	market domain.Market
-	res    Connection
-}
-
 func TestSetMarket(t *testing.T) {
-	tests := []SetMarket{
-		{"First set", "pi_ethusd", Connection{}},
-	}
+	kraken.SetMarket(context.Background(), "pi_ethusd")
 
-	for _, test := range tests {
-		kraken.SetMarket(context.Background(), test.market)
-
-		if !reflect.DeepEqual(*kraken.conns[test.market], test.res) {
-			t.Fatalf("%v: Expect: %v, Got: %v", test.name, test.res, *kraken.conns[test.market])
-		}
+	// markets are subscribed on the shared connection by Subscribe only
+	if !assert.Empty(t, kraken.subs) || !assert.Nil(t, kraken.ws) {
+		t.Fatal()
 	}
 }
 
 var (
 	upgrader      = websocket.Upgrader{}
-	subMessage    string
 	candlesSample = []domain.CandleSub{
 		{Cand: domain.Candle{
 			Time:  42.2,
@@ -87,103 +75,139 @@ var (
 	}
 )
 
-type Subscribed struct {
-	name string
-	mess string
-	res  int
+// exchange is Kraken websocket: it acknowledges subscriptions (pi_bad
+// is unknown product) and sends candlesSample to every subscribed product.
+type exchange struct {
+	conns int32
 }
 
-func subscribe(w http.ResponseWriter, r *http.Request) {
+func (e *exchange) serve(w http.ResponseWriter, r *http.Request) {
 	c, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		return
 	}
 	defer c.Close()
+	atomic.AddInt32(&e.conns, 1)
 
-	sub := &domain.Subscribe{
-		Event: subMessage,
-	}
+	_ = c.WriteJSON(message{Event: "info"})
+	for {
+		var sub domain.Subscribe
+		if err = c.ReadJSON(&sub); err != nil {
+			return
+		}
+		if sub.Event != "subscribe" {
+			continue
+		}
 
-	for i := 0; i < 2; i++ {
-		err = c.WriteJSON(sub)
-		if err != nil {
-			break
+		product := strings.ToUpper(sub.Products[0])
+		if product == "PI_BAD" {
+			_ = c.WriteJSON(message{Event: "error", Mess: "Invalid product id"})
+			continue
+		}
+		_ = c.WriteJSON(message{Event: "subscribed", Feed: sub.Feed, Products: []string{product}})
+		for _, v := range candlesSample {
+			candle := v.Cand
+			_ = c.WriteJSON(message{Feed: sub.Feed, Product: product, Candle: &candle})
 		}
 	}
 }
 
 func TestSubscribe(t *testing.T) {
-	tests := []Subscribed{
-		{"Subscribed", "subscribed", 0},
-		{"Not Subscribed", "error", http.StatusBadRequest},
+	tests := []struct {
+		name   string
+		market domain.Market
+		res    int
+	}{
+		{"Subscribed", "pi_ethusd", 0},
+		{"Not Subscribed", "pi_bad", http.StatusBadRequest},
 	}
 
-	s := httptest.NewServer(http.HandlerFunc(subscribe))
+	e := &exchange{}
+	s := httptest.NewServer(http.HandlerFunc(e.serve))
 	defer s.Close()
 
-	u := "ws" + strings.TrimPrefix(s.URL, "http")
-	kraken.urls.Ws = u
+	kraken.urls.Ws = "ws" + strings.TrimPrefix(s.URL, "http")
 
 	for _, test := range tests {
-		subMessage = test.mess
-
-		res, _ := kraken.Subscribe(context.Background(), domain.Market("pi_ethusd"))
+		res, _ := kraken.Subscribe(context.Background(), test.market, "")
 
-		if !assert.Equal(t, res, test.res, "%v: Expect: %v, Got: %v", test.name, test.res, res) {
+		if !assert.Equal(t, test.res, res, "%v: Expect: %v, Got: %v", test.name, test.res, res) {
 			t.Fatal()
 		}
 	}
-}
+	for _, test := range tests {
+		kraken.Stop(context.Background(), test.market)
+	}
 
-type ListenCandles struct {
-	name   string
-	market domain.Market
-	res    []domain.CandleSub
+	if !assert.Equal(t, int32(1), atomic.LoadInt32(&e.conns)) || !assert.Nil(t, kraken.ws) {
+		t.Fatal()
+	}
 }
 
-func sendCandles(w http.ResponseWriter, r *http.Request) {
-	c, err := upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		return
+func TestFanOut(t *testing.T) {
+	markets := []domain.Market{"pi_ethusd", "pi_xbtusd", "pi_ltcusd"}
+
+	e := &exchange{}
+	s := httptest.NewServer(http.HandlerFunc(e.serve))
+	defer s.Close()
+
+	kraken.urls.Ws = "ws" + strings.TrimPrefix(s.URL, "http")
+
+	for _, m := range markets {
+		if res, err := kraken.Subscribe(context.Background(), m, "5m"); !assert.NoError(t, err) || !assert.Equal(t, 0, res) {
+			t.Fatal()
+		}
 	}
-	defer c.Close()
 
-	for _, v := range candlesSample {
-		err = c.WriteJSON(v)
-		if err != nil {
-			break
+	// every market gets candles of its product only
+	for _, m := range markets {
+		candles := kraken.Start(m)
+
+		var res []domain.CandleSub
+		for len(res) < len(candlesSample) {
+			select {
+			case c := <-candles:
+				res = append(res, c)
+			case <-time.After(5 * time.Second):
+				t.Fatalf("%v: Expect: %v, Got: %v", m, candlesSample, res)
+			}
+		}
+		if !assert.Equal(t, candlesSample, res, "%v: Expect: %v, Got: %v", m, candlesSample, res) {
+			t.Fatal()
 		}
 	}
-}
 
-func TestListenCandles(t *testing.T) {
-	tests := []ListenCandles{
-		{"Listen", domain.Market("pi_ethusd"), candlesSample},
+	for _, m := range markets {
+		candles := kraken.Start(m)
+		kraken.Stop(context.Background(), m)
+		for range candles {
+		}
+	}
+
+	if !assert.Equal(t, int32(1), atomic.LoadInt32(&e.conns)) || !assert.Nil(t, kraken.ws) {
+		t.Fatal()
 	}
+}
 
-	s := httptest.NewServer(http.HandlerFunc(sendCandles))
+func TestDisconnectSubscribed(t *testing.T) {
+	e := &exchange{}
+	s := httptest.NewServer(http.HandlerFunc(e.serve))
 	defer s.Close()
 
-	u := "ws" + strings.TrimPrefix(s.URL, "http")
-	kraken.urls.Ws = u
+	kraken.urls.Ws = "ws" + strings.TrimPrefix(s.URL, "http")
 
-	for _, test := range tests {
-		kraken.conns[test.market].ws, _, _ = websocket.DefaultDialer.Dial(kraken.urls.Ws, http.Header{})
-		candles, stopChan := kraken.listenCandles(test.market)
-		var res []domain.CandleSub
-
-		go func() {
-			for candle := range candles {
-				res = append(res, candle)
-			}
-		}()
+	if res, err := kraken.Subscribe(context.Background(), "pi_ethusd", ""); !assert.NoError(t, err) || !assert.Equal(t, 0, res) {
+		t.Fatal()
+	}
 
-		for range stopChan {
-		}
+	// market subscribed after the last one is stopped keeps the connection
+	if !assert.False(t, kraken.disconnect()) || !assert.NotNil(t, kraken.ws) {
+		t.Fatal()
+	}
 
-		if !assert.Equal(t, test.res, res, "%v: Expect: %v, Got: %v", test.name, test.res, res) {
-			t.Fatal()
-		}
+	kraken.Stop(context.Background(), "pi_ethusd")
+	if !assert.Equal(t, int32(1), atomic.LoadInt32(&e.conns)) || !assert.Nil(t, kraken.ws) {
+		t.Fatal()
 	}
 }
 
@@ -194,11 +218,18 @@ func TestMakeRequest(t *testing.T) {
 	}))
 	defer ts.Close()
 
-	by, _ := kraken.makeRequest(http.MethodGet, ts.URL, "", "")
+	by, _ := kraken.makeRequest(context.Background(), http.MethodGet, ts.URL, "", "")
 
 	if !assert.Equal(t, by, []byte("Hi"), "%v: Expect: %v, Got: %v", "plain request", by, []byte("Hi")) {
 		t.Fatal()
 	}
+
+	// request is cancelled with its context
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := kraken.makeRequest(ctx, http.MethodGet, ts.URL, "", ""); !assert.ErrorIs(t, err, context.Canceled) {
+		t.Fatal()
+	}
 }
 
 var (
@@ -249,7 +280,7 @@ func TestSendOrder(t *testing.T) {
 	kraken.urls.SendOrder = ts.URL + "?"
 
 	for _, test := range tests {
-		res, _ := kraken.SendOrder(domain.Order{})
+		res, _ := kraken.SendOrder(context.Background(), domain.Order{})
 
 		if !assert.Equal(t, test.res, *res, "%v: Expect: %v, Got: %v", test.name, test.res, *res) {
 			t.Fatal()
@@ -257,88 +288,351 @@ func TestSendOrder(t *testing.T) {
 	}
 }
 
-func TestKeepAlive(t *testing.T) {
-	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		c, err := upgrader.Upgrade(w, r, nil)
-		if err != nil {
+func TestOrderQuery(t *testing.T) {
+	base := domain.Order{Market: "pi_xbtusd", Typ: "sell", Price: 57000.5, Size: 2}
+	with := func(exec domain.Execution) domain.Order {
+		order := base
+		order.Execution = exec
+		return order
+	}
+
+	tests := []struct {
+		name  string
+		order domain.Order
+		query string
+	}{
+		{"Default ioc", base, "orderType=ioc&symbol=pi_xbtusd&side=sell&size=2&limitPrice=57000.5"},
+		{"Limit", with(domain.Execution{OrderType: "lmt"}), "orderType=lmt&symbol=pi_xbtusd&side=sell&size=2&limitPrice=57000.5"},
+		{"Post only", with(domain.Execution{OrderType: "post", ReduceOnly: true}),
+			"orderType=post&symbol=pi_xbtusd&side=sell&size=2&limitPrice=57000.5&reduceOnly=true"},
+		{"Market", with(domain.Execution{OrderType: "mkt"}), "orderType=mkt&symbol=pi_xbtusd&side=sell&size=2"},
+		{"Stop", with(domain.Execution{OrderType: "stp", StopPrice: 56000}),
+			"orderType=stp&symbol=pi_xbtusd&side=sell&size=2&stopPrice=56000"},
+		{"Take profit", with(domain.Execution{OrderType: "take_profit", StopPrice: 59000, TriggerSignal: "last", ReduceOnly: true}),
+			"orderType=take_profit&symbol=pi_xbtusd&side=sell&size=2&stopPrice=59000&triggerSignal=last&reduceOnly=true"},
+	}
+
+	for _, test := range tests {
+		if !assert.Equal(t, test.query, orderQuery(test.order), test.name) {
+			t.Fatal()
+		}
+	}
+
+	base.ClientID = "bot-1"
+	if !assert.Equal(t, "orderType=ioc&symbol=pi_xbtusd&side=sell&size=2&limitPrice=57000.5&cliOrdId=bot-1", orderQuery(base)) {
+		t.Fatal()
+	}
+}
+
+func TestEditCancelOrder(t *testing.T) {
+	var queries []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.Path+"?"+r.URL.RawQuery)
+		if r.URL.Path == "/edit" {
+			_, _ = w.Write([]byte(`{"result":"success","editStatus":{"status":"edited","orderId":"e1"}}`))
 			return
 		}
-		defer c.Close()
+		_, _ = w.Write([]byte(`{"result":"success","cancelStatus":{"status":"cancelled","order_id":"e1"}}`))
 	}))
-	defer s.Close()
+	defer ts.Close()
+	kraken.urls.EditOrder = ts.URL + "/edit"
+	kraken.urls.CancelOrder = ts.URL + "/cancel"
+
+	order := domain.Order{Size: 3, Execution: domain.Execution{OrderType: "stp", StopPrice: 55500}}
+	edit, err := kraken.EditOrder(context.Background(), "e1", order)
+	if !assert.NoError(t, err) || !assert.Equal(t, domain.EditStatus{OrderID: "e1", Stat: "edited"}, edit.Status) {
+		t.Fatal()
+	}
+
+	cancel, err := kraken.CancelOrder(context.Background(), "e1")
+	if !assert.NoError(t, err) || !assert.Equal(t, domain.CancelStatus{OrderID: "e1", Stat: "cancelled"}, cancel.Status) {
+		t.Fatal()
+	}
+
+	expect := []string{"/edit?orderId=e1&size=3&stopPrice=55500", "/cancel?order_id=e1"}
+	if !assert.Equal(t, expect, queries) {
+		t.Fatal()
+	}
+}
+
+func TestAccountCalls(t *testing.T) {
+	var queries []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.Method+" "+r.URL.Path+"?"+r.URL.RawQuery)
+		switch r.URL.Path {
+		case "/openorders":
+			_, _ = w.Write([]byte(`{"result":"success","openOrders":[{"order_id":"o1","symbol":"pi_ethusd",` +
+				`"side":"sell","orderType":"stop","stopPrice":2900,"filledSize":0,"unfilledSize":2,"reduceOnly":true,` +
+				`"triggerSignal":"mark","status":"untouched","receivedTime":"2021-05-30T10:00:00.000Z"}]}`))
+		case "/openpositions":
+			_, _ = w.Write([]byte(`{"result":"success","openPositions":[{"symbol":"pi_ethusd","side":"long",` +
+				`"price":3000.5,"size":2,"fillTime":"2021-05-30T09:00:00.000Z"}]}`))
+		case "/fills":
+			_, _ = w.Write([]byte(`{"result":"success","fills":[{"fill_id":"f1","symbol":"pi_ethusd","side":"buy",` +
+				`"order_id":"o0","size":2,"price":3000.5,"fillTime":"2021-05-30T09:00:00.000Z","fillType":"taker"}]}`))
+		case "/cancelall":
+			_, _ = w.Write([]byte(`{"result":"success","cancelStatus":{"status":"cancelled",` +
+				`"cancelledOrders":[{"order_id":"o1"}]}}`))
+		default:
+			_, _ = w.Write([]byte(`{"result":"error","error":"apiLimitExceeded"}`))
+		}
+	}))
+	defer ts.Close()
+	urls := kraken.urls
+	defer func() { kraken.urls = urls }()
+	kraken.urls.OpenOrders = ts.URL + "/openorders"
+	kraken.urls.OpenPositions = ts.URL + "/openpositions"
+	kraken.urls.Fills = ts.URL + "/fills"
+	kraken.urls.CancelAllOrders = ts.URL + "/cancelall"
+
+	orders, err := kraken.OpenOrders(context.Background())
+	expectOrder := domain.OpenOrder{OrderID: "o1", Symbol: "pi_ethusd", Side: "sell", OrderType: "stop", StopPrice: 2900,
+		UnfilledSize: 2, ReduceOnly: true, TriggerSignal: "mark", Status: "untouched", Received: "2021-05-30T10:00:00.000Z"}
+	if !assert.NoError(t, err) || !assert.Equal(t, []domain.OpenOrder{expectOrder}, orders) {
+		t.Fatal()
+	}
+
+	positions, err := kraken.OpenPositions(context.Background())
+	expectPosition := domain.OpenPosition{Symbol: "pi_ethusd", Side: "long", Price: 3000.5, Size: 2,
+		FillTime: "2021-05-30T09:00:00.000Z"}
+	if !assert.NoError(t, err) || !assert.Equal(t, []domain.OpenPosition{expectPosition}, positions) {
+		t.Fatal()
+	}
+
+	before := time.Date(2021, 5, 30, 10, 0, 0, 0, time.UTC)
+	fills, err := kraken.Fills(context.Background(), &before)
+	expectFill := domain.Fill{FillID: "f1", Symbol: "pi_ethusd", Side: "buy", OrderID: "o0", Size: 2, Price: 3000.5,
+		FillTime: "2021-05-30T09:00:00.000Z", FillType: "taker"}
+	if !assert.NoError(t, err) || !assert.Equal(t, []domain.Fill{expectFill}, fills) {
+		t.Fatal()
+	}
+
+	cancel, err := kraken.CancelAllOrders(context.Background(), "pi_ethusd")
+	expectCancel := domain.CancelAllStatus{Stat: "cancelled", Orders: []domain.CancelledOrder{{OrderID: "o1"}}}
+	if !assert.NoError(t, err) || !assert.Equal(t, expectCancel, *cancel) {
+		t.Fatal()
+	}
+
+	kraken.urls.Fills = ts.URL + "/error"
+	_, err = kraken.Fills(context.Background(), nil)
+	if !assert.EqualError(t, err, "Fills: Unsuccessful response: apiLimitExceeded") ||
+		!assert.ErrorIs(t, err, domain.UnsuccessfulResponse) {
+		t.Fatal()
+	}
 
-	u := "ws" + strings.TrimPrefix(s.URL, "http")
-	kraken.urls.Ws = u
+	expect := []string{"GET /openorders?", "GET /openpositions?", "GET /fills?lastFillTime=2021-05-30T10:00:00.000Z",
+		"POST /cancelall?symbol=pi_ethusd", "GET /error?"}
+	if !assert.Equal(t, expect, queries) {
+		t.Fatal()
+	}
+}
 
+func TestKeepAlive(t *testing.T) {
 	stopChan := make(chan struct{})
 	go func() {
-		time.Sleep(time.Second * 5)
-		stopChan <- struct{}{}
+		time.Sleep(time.Second)
 		close(stopChan)
 	}()
 
-	market := domain.Market("pi_ethusd")
-
-	kraken.conns[market].wg.Add(1)
-	kraken.keepAlive(market, stopChan)
+	kraken.wg.Add(1)
+	kraken.keepAlive(stopChan)
 }
 
 func TestAccounts(t *testing.T) {
-	send := domain.Wallet{
-		Result: "success",
-		Accounts: domain.Markets{
-			Fi_xbtusd: domain.Funds{
-				Aux: domain.Auxiliary{
-					Af: 42.0,
-				},
-			},
-			Fi_bchusd: domain.Funds{
-				Aux: domain.Auxiliary{
-					Af: 42.0,
-				},
-			},
-			Fi_ethusd: domain.Funds{
-				Aux: domain.Auxiliary{
-					Af: 42.0,
-				},
-			},
-			Fi_ltcusd: domain.Funds{
-				Aux: domain.Auxiliary{
-					Af: 42.0,
-				},
-			},
-			Fi_xrpusd: domain.Funds{
-				Aux: domain.Auxiliary{
-					Af: 42.0,
-				},
-			},
-			Fv_xrpxbt: domain.Funds{
-				Aux: domain.Auxiliary{
-					Af: 42.0,
-				},
-			},
-		},
-	}
+	send := `{"result":"success","serverTime":"2021-12-01T13:37:00.000Z","accounts":{` +
+		`"cash":{"type":"cashAccount","balances":{"xbt":0.5}},` +
+		`"fi_xbtusd":{"type":"marginAccount","currency":"xbt","balances":{"xbt":1.5,"fi_xbtusd_211231":-2},` +
+		`"auxiliary":{"usd":0,"pv":1.6,"pnl":0.1,"af":1.2,"funding":0.01},"marginRequirements":{"im":0.4,"mm":0.2,"lt":0.1,"tt":0.05}},` +
+		`"fi_solusd":{"type":"marginAccount","currency":"sol","balances":{"sol":10},"auxiliary":{"pv":10,"af":10}},` +
+		`"flex":{"type":"multiCollateralMarginAccount","currencies":{"USD":{"quantity":1000,"value":1000},` +
+		`"XBT":{"quantity":0.1,"value":5700}},"initialMargin":300,"maintenanceMargin":150,"portfolioValue":6750,` +
+		`"pnl":50,"unrealizedFunding":-1.5,"availableMargin":6400}}}`
 
 	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		coded, _ := json.Marshal(send)
-		_, _ = w.Write(coded)
+		_, _ = w.Write([]byte(send))
 	}))
 	defer s.Close()
 
 	kraken.urls.Accounts = s.URL
-	res, _ := kraken.Accounts(context.Background())
+	res, err := kraken.Accounts(context.Background())
 
 	testRes := domain.AccountsResp{
-		Fi_xbtusd: 42.0,
-		Fi_bchusd: 42.0,
-		Fi_ethusd: 42.0,
-		Fi_ltcusd: 42.0,
-		Fi_xrpusd: 42.0,
-		Fv_xrpxbt: 42.0,
+		ServerTime: "2021-12-01T13:37:00.000Z",
+		Accounts: map[string]domain.Account{
+			"cash": {Type: domain.CashAccount, Balances: map[string]float64{"xbt": 0.5}},
+			"fi_xbtusd": {Type: domain.MarginAccount, Currency: "xbt",
+				Balances:       map[string]float64{"xbt": 1.5, "fi_xbtusd_211231": -2},
+				Margin:         &domain.Margin{Initial: 0.4, Maintenance: 0.2, Liquidation: 0.1, Termination: 0.05},
+				PortfolioValue: 1.6, AvailableFunds: 1.2, PnL: 0.1, UnrealizedFunding: 0.01},
+			"fi_solusd": {Type: domain.MarginAccount, Currency: "sol", Balances: map[string]float64{"sol": 10},
+				PortfolioValue: 10, AvailableFunds: 10},
+			"flex": {Type: domain.FlexAccount, Balances: map[string]float64{"USD": 1000, "XBT": 0.1},
+				Margin:         &domain.Margin{Initial: 300, Maintenance: 150},
+				PortfolioValue: 6750, AvailableFunds: 6400, PnL: 50, UnrealizedFunding: -1.5},
+		},
+	}
+
+	if !assert.NoError(t, err) || !assert.Equal(t, testRes, *res, "%v: Expect: %v, Got: %v", "base test", testRes, *res) {
+		t.Fatal()
 	}
+}
 
-	if !assert.Equal(t, testRes, *res, "%v: Expect: %v, Got: %v", "base test", testRes, *res) {
+func TestInstruments(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"result":"success","instruments":[` +
+			`{"symbol":"PI_XBTUSD","type":"futures_inverse","tradeable":true,"tickSize":0.5,"contractSize":1,` +
+			`"contractValueTradePrecision":0,"maxPositionSize":1000000},` +
+			`{"symbol":"in_xbtusd","type":"spot index","tradeable":false}]}`))
+	}))
+	defer s.Close()
+
+	kraken.urls.Instruments = s.URL
+	res, err := kraken.Instruments(context.Background())
+
+	expect := []domain.Instrument{
+		{Symbol: "pi_xbtusd", Type: "futures_inverse", Tradeable: true, TickSize: 0.5, ContractSize: 1, MaxPositionSize: 1000000},
+		{Symbol: "in_xbtusd", Type: "spot index"},
+	}
+	if !assert.NoError(t, err) || !assert.Equal(t, expect, res) {
+		t.Fatal()
+	}
+}
+
+func TestHistory(t *testing.T) {
+	from := time.Date(2021, 12, 1, 13, 0, 0, 0, time.UTC)
+	to := from.Add(2 * time.Minute)
+
+	var path string
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.String()
+		_, _ = w.Write([]byte(`{"candles":[` +
+			`{"time":1638363540000,"open":"56900","high":"56950","low":"56880","close":"56940","volume":"3"},` +
+			`{"time":1638363600000,"open":"56940","high":"57010","low":"56930","close":"56980.5","volume":"12"},` +
+			`{"time":1638363660000,"open":"56980.5","high":"57000","low":"56970","close":"56990","volume":0},` +
+			`{"time":1638363720000,"open":"56990","high":"56990","low":"56990","close":"56990","volume":"1"}],` +
+			`"more_candles":false}`))
+	}))
+	defer s.Close()
+
+	kraken.urls.Charts = s.URL
+	res, err := kraken.History(context.Background(), "pi_xbtusd", "1m", from, to)
+
+	expect := []domain.Candle{
+		{Time: 1638363600000, Open: "56940", High: "57010", Low: "56930", Close: "56980.5", Volume: 12},
+		{Time: 1638363660000, Open: "56980.5", High: "57000", Low: "56970", Close: "56990"},
+	}
+	if !assert.NoError(t, err) || !assert.Equal(t, "/PI_XBTUSD/1m?from=1638363600&to=1638363720", path) ||
+		!assert.Equal(t, expect, res, "Expect: %v, Got: %v", expect, res) {
 		t.Fatal()
 	}
+
+	s.Close()
+	_, err = kraken.History(context.Background(), "pi_xbtusd", "1m", from, to)
+	if !assert.Error(t, err) {
+		t.Fatal()
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	for attempt := 1; attempt <= 40; attempt++ {
+		d := reconnectMax
+		if attempt < 7 {
+			d = reconnectMin << (attempt - 1)
+		}
+
+		res := backoff(attempt)
+		if !assert.True(t, res >= d/2 && res <= d, "%v: Expect: [%v, %v], Got: %v", attempt, d/2, d, res) {
+			t.Fatal()
+		}
+	}
+}
+
+// flaky is Kraken websocket which breaks the first connection after a candle
+// and sends a candle 3 minutes later on the next one.
+type flaky struct {
+	conns   int32
+	started chan struct{}
+}
+
+func (f *flaky) serve(w http.ResponseWriter, r *http.Request) {
+	c, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer c.Close()
+	n := atomic.AddInt32(&f.conns, 1)
+
+	var sub domain.Subscribe
+	if err = c.ReadJSON(&sub); err != nil {
+		return
+	}
+	product := strings.ToUpper(sub.Products[0])
+	_ = c.WriteJSON(message{Event: "subscribed", Feed: sub.Feed, Products: []string{product}})
+
+	candle := domain.Candle{Time: 1638363600000, Open: "1", High: "1", Low: "1", Close: "1"}
+	if n > 1 {
+		candle.Time += 3 * 60000
+	}
+	_ = c.WriteJSON(message{Feed: sub.Feed, Product: product, Candle: &candle})
+
+	// abnormal closure of the first connection
+	if n == 1 {
+		<-f.started
+		return
+	}
+	for {
+		if _, _, err = c.ReadMessage(); err != nil {
+			return
+		}
+	}
+}
+
+func TestReconnect(t *testing.T) {
+	min := reconnectMin
+	reconnectMin = 10 * time.Millisecond
+	defer func() { reconnectMin = min }()
+
+	storage := NewTgMock(logger, 0, "")
+	k := New(logger, storage, "", "")
+
+	f := &flaky{started: make(chan struct{})}
+	s := httptest.NewServer(http.HandlerFunc(f.serve))
+	defer s.Close()
+	k.urls.Ws = "ws" + strings.TrimPrefix(s.URL, "http")
+
+	m := domain.Market("pi_xbtusd")
+	if _, err := k.Subscribe(context.Background(), m, "1m"); !assert.NoError(t, err) {
+		t.Fatal()
+	}
+	candles := k.Start(m)
+	close(f.started)
+
+	// candles keep coming to the same channel after reconnection
+	var res []float64
+	for len(res) < 2 {
+		select {
+		case c := <-candles:
+			res = append(res, c.Cand.Time)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expect: 2 candles, Got: %v", res)
+		}
+	}
+	k.Stop(context.Background(), m)
+
+	expect := []string{
+		StartListen + ": pi_xbtusd",
+		LostWs,
+		RestoreWs + ": after 1 attempts",
+		MissedCandles + ": pi_xbtusd: 2 candles since 2021-12-01T13:00:00Z",
+		StopListen + ": pi_xbtusd",
+	}
+	if !assert.Equal(t, []float64{1638363600000, 1638363780000}, res) || !assert.Equal(t, int32(2), atomic.LoadInt32(&f.conns)) ||
+		!assert.Len(t, storage.mess, len(expect)) {
+		t.Fatal()
+	}
+	for i, v := range expect {
+		if !assert.True(t, strings.HasPrefix(storage.mess[i], v), "Expect: %v, Got: %v", v, storage.mess[i]) {
+			t.Fatal()
+		}
+	}
 }
@@ -1,6 +1,8 @@
 package kraken
 
 import (
+	"sync"
+
 	"github.com/cgriceld/crypto-trade-bot/internal/domain"
 
 	"github.com/cgriceld/crypto-trade-bot/pkg/log"
@@ -15,6 +17,7 @@ type InMemory []string
 type messStorage struct {
 	logger log.Logger
 	mess   InMemory
+	mux    sync.Mutex
 	id     int
 	url    string
 }
@@ -28,5 +31,7 @@ func NewTgMock(logger log.Logger, id int, url string) *messStorage {
 }
 
 func (tg *messStorage) Notify(m domain.Market, message string) {
+	tg.mux.Lock()
 	tg.mess = append(tg.mess, message)
+	tg.mux.Unlock()
 }
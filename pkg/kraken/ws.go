@@ -2,8 +2,11 @@ package kraken
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"math/rand"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/cgriceld/crypto-trade-bot/internal/domain"
@@ -12,69 +15,274 @@ import (
 )
 
 const (
-	pingPeriod     = (pongWait * 9) / 10
-	pongWait       = 60 * time.Second
-	writeWait      = 10 * time.Second
-	wsRetryTimeout = 5 * time.Second
-	wsRetryTime    = 3
+	pingPeriod  = (pongWait * 9) / 10
+	pongWait    = 60 * time.Second
+	writeWait   = 10 * time.Second
+	wsRetryTime = 3
+	// candlesBuffer is the number of candles a market may lag behind the
+	// connection before its candles are dropped.
+	candlesBuffer = 256
+)
+
+// Reconnection delay doubles with every attempt from reconnectMin up to
+// reconnectMax, see backoff.
+var (
+	reconnectMin = time.Second
+	reconnectMax = time.Minute
 )
 
 const (
-	StopListen  = "⚠️ Stop subscription on market"
-	StartListen = "✅ Start subscription on market"
+	StopListen    = "⚠️ Stop subscription on market"
+	StartListen   = "✅ Start subscription on market"
+	LostWs        = "🔌 Websocket connection is lost, reconnecting"
+	RetryWs       = "🔌 Fail to restore websocket connection"
+	RestoreWs     = "✅ Websocket connection is restored"
+	MissedCandles = "⚠️ Missed candles on market"
 )
 
-func (k *Kraken) Subscribe(ctx context.Context, m domain.Market) (int, error) {
-	var resp *http.Response
-	var err error
+// subscription is a market subscribed to candles on the shared connection.
+type subscription struct {
+	feed    string
+	candles chan domain.CandleSub
+	acks    chan error
+	started bool
+	// time of the last candle and whether the connection was restored since it
+	interval time.Duration
+	last     float64
+	gap      bool
+}
 
-	k.SetMarket(ctx, m)
-	for i := 0; i < wsRetryTime; i++ {
-		k.conns[m].ws, resp, err = websocket.DefaultDialer.Dial(k.urls.Ws, http.Header{})
-		if err == nil {
-			break
-		}
-		k.logger.Warnf("Retry to establish websocket connection: %v: %v: %v", m, resp.StatusCode, err)
-		time.Sleep(wsRetryTimeout)
+// message is any message of the websocket: event, its acknowledgement or
+// a candle of a product.
+type message struct {
+	Event    string         `json:"event"`
+	Mess     string         `json:"message"`
+	Feed     string         `json:"feed"`
+	Product  string         `json:"product_id"`
+	Products []string       `json:"product_ids"`
+	Candle   *domain.Candle `json:"candle"`
+}
+
+// key is the market of product, Kraken returns product ids in upper case.
+func key(product string) domain.Market {
+	return domain.Market(strings.ToLower(product))
+}
+
+// Subscribe subscribes to candles of market with interval (see domain.Intervals),
+// 1m if empty. All markets share one websocket connection, it is established
+// by the first subscription.
+func (k *Kraken) Subscribe(ctx context.Context, m domain.Market, interval string) (int, error) {
+	if interval == "" {
+		interval = domain.DefaultInterval
 	}
-	if err != nil {
-		return http.StatusInternalServerError, fmt.Errorf("Fail to establish websocket connection: %v: %v: %v", m, resp.StatusCode, err)
+
+	if err := k.connect(); err != nil {
+		return http.StatusInternalServerError, fmt.Errorf("Fail to establish websocket connection: %v: %v", m, err)
 	}
 
-	sub := &domain.Subscribe{
-		Event:    "subscribe",
-		Feed:     "candles_trade_1m",
-		Products: []string{string(m)},
+	sub := &subscription{
+		feed:     "candles_trade_" + interval,
+		candles:  make(chan domain.CandleSub, candlesBuffer),
+		acks:     make(chan error, 1),
+		interval: domain.IntervalDuration(interval),
 	}
+	k.muxWs.Lock()
+	k.subs[key(string(m))] = sub
+	k.muxWs.Unlock()
 
-	k.conns[m].ws.SetWriteDeadline(time.Now().Add(writeWait))
-	err = k.conns[m].ws.WriteJSON(sub)
+	err := k.write(&domain.Subscribe{
+		Event:    "subscribe",
+		Feed:     sub.feed,
+		Products: []string{string(m)},
+	})
 	if err != nil {
 		return http.StatusInternalServerError, fmt.Errorf("Fail to send subscribtion request: %v: %w", m, err)
 	}
 
-	k.conns[m].ws.SetReadDeadline(time.Now().Add(pongWait))
-	for i := 0; i < 2; i++ {
-		err = k.conns[m].ws.ReadJSON(sub)
+	select {
+	case err = <-sub.acks:
 		if err != nil {
-			return http.StatusInternalServerError, fmt.Errorf("Fail to read subscribtion response: %v: %w", m, err)
+			return http.StatusBadRequest, fmt.Errorf("Fail to subscribe: %v: %v", m, err)
 		}
-	}
-	if sub.Event != "subscribed" {
-		return http.StatusBadRequest, fmt.Errorf("Fail to subscribe: %v: %s", m, sub.Mess)
+	case <-time.After(pongWait):
+		return http.StatusInternalServerError, fmt.Errorf("Fail to read subscribtion response: %v: timeout", m)
+	case <-ctx.Done():
+		return http.StatusInternalServerError, fmt.Errorf("Fail to read subscribtion response: %v: %w", m, ctx.Err())
 	}
 
 	return 0, nil
 }
 
-func (k *Kraken) keepAlive(m domain.Market, stopChan <-chan struct{}) {
+// Start returns candles of subscribed market, the channel is closed when
+// the market is stopped. If the connection is lost, the channel stays open
+// and candles keep coming to it after reconnection.
+func (k *Kraken) Start(m domain.Market) <-chan domain.CandleSub {
+	k.muxWs.Lock()
+	sub, ok := k.subs[key(string(m))]
+	if !ok {
+		k.muxWs.Unlock()
+		candles := make(chan domain.CandleSub)
+		close(candles)
+		return candles
+	}
+	sub.started = true
+	k.muxWs.Unlock()
+
+	k.notify.Notify(m, fmt.Sprintf("%v: %v", StartListen, m))
+
+	return sub.candles
+}
+
+// Stop unsubscribes market and closes its candles. The connection is closed
+// with the last subscription.
+func (k *Kraken) Stop(ctx context.Context, m domain.Market) {
+	k.muxWs.Lock()
+	sub, ok := k.subs[key(string(m))]
+	if !ok {
+		k.muxWs.Unlock()
+		return
+	}
+	delete(k.subs, key(string(m)))
+	close(sub.candles)
+	last := len(k.subs) == 0
+	k.muxWs.Unlock()
+
+	if sub.started {
+		k.notify.Notify(m, fmt.Sprintf("%v: %v", StopListen, m))
+	}
+
+	// a market may be subscribed meanwhile, then the connection is kept
+	if last && k.disconnect() {
+		return
+	}
+
+	err := k.write(&domain.Subscribe{
+		Event:    "unsubscribe",
+		Feed:     sub.feed,
+		Products: []string{string(m)},
+	})
+	if err != nil {
+		k.logger.Warnf("Stop: %v: Fail to unsubscribe: %v", m, err)
+	}
+}
+
+// dial establishes a new websocket connection.
+func (k *Kraken) dial() (*websocket.Conn, error) {
+	ws, resp, err := websocket.DefaultDialer.Dial(k.urls.Ws, http.Header{})
+	if err != nil {
+		// resp is nil unless the handshake failed
+		if resp != nil {
+			return nil, fmt.Errorf("%v: %w", resp.StatusCode, err)
+		}
+		return nil, err
+	}
+
+	return ws, nil
+}
+
+// backoff returns delay before reconnection attempt (starting from 1):
+// exponential with jitter, so that clients don't reconnect all at once.
+func backoff(attempt int) time.Duration {
+	d := reconnectMax
+	if attempt < 32 && reconnectMin<<(attempt-1) < reconnectMax {
+		d = reconnectMin << (attempt - 1)
+	}
+
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// connect establishes the shared connection unless it is already established,
+// and starts reading it.
+func (k *Kraken) connect() error {
+	k.muxConnect.Lock()
+	defer k.muxConnect.Unlock()
+
+	k.muxWs.RLock()
+	// the connection may be being restored
+	connected := k.stopChan != nil
+	k.muxWs.RUnlock()
+	if connected {
+		return nil
+	}
+
+	var ws *websocket.Conn
+	var err error
+	for i := 1; i <= wsRetryTime; i++ {
+		if ws, err = k.dial(); err == nil {
+			break
+		}
+		k.logger.Warnf("Retry to establish websocket connection: %v", err)
+		if i < wsRetryTime {
+			time.Sleep(backoff(i))
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	stopChan := make(chan struct{})
+	k.muxWs.Lock()
+	k.ws = ws
+	k.stopChan = stopChan
+	k.muxWs.Unlock()
+
+	k.wg.Add(2)
+	go k.listen(ws, stopChan)
+	go k.keepAlive(stopChan)
+
+	return nil
+}
+
+// disconnect closes the shared connection and waits until it isn't read,
+// unless some market is subscribed. Reports whether the connection is closed.
+func (k *Kraken) disconnect() bool {
+	k.muxConnect.Lock()
+	defer k.muxConnect.Unlock()
+
+	k.muxWs.Lock()
+	if len(k.subs) > 0 {
+		k.muxWs.Unlock()
+		return false
+	}
+	ws := k.ws
+	if k.stopChan != nil {
+		close(k.stopChan)
+		k.stopChan = nil
+	}
+	k.ws = nil
+	k.muxWs.Unlock()
+
+	if ws != nil {
+		ws.Close()
+	}
+	k.wg.Wait()
+
+	return true
+}
+
+// write sends v to the shared connection, gorilla websocket supports only
+// one concurrent writer.
+func (k *Kraken) write(v interface{}) error {
+	k.muxWrite.Lock()
+	defer k.muxWrite.Unlock()
+
+	k.muxWs.RLock()
+	ws := k.ws
+	k.muxWs.RUnlock()
+	if ws == nil {
+		return errors.New("No websocket connection")
+	}
+
+	ws.SetWriteDeadline(time.Now().Add(writeWait))
+	return ws.WriteJSON(v)
+}
+
+func (k *Kraken) keepAlive(stopChan <-chan struct{}) {
 	ticker := time.NewTicker(pingPeriod)
 
 	defer func() {
 		ticker.Stop()
-		k.conns[m].ws.Close()
-
-		k.conns[m].wg.Done()
+		k.wg.Done()
 	}()
 
 	for {
@@ -82,52 +290,212 @@ func (k *Kraken) keepAlive(m domain.Market, stopChan <-chan struct{}) {
 		case <-stopChan:
 			return
 		case <-ticker.C:
-			k.conns[m].ws.SetWriteDeadline(time.Now().Add(writeWait))
-			if err := k.conns[m].ws.WriteMessage(websocket.PingMessage, nil); err != nil {
-				k.logger.Errorf("keepAlive: %v: Fail to send ping: %v", m, err)
+			k.muxWrite.Lock()
+			k.muxWs.RLock()
+			ws := k.ws
+			k.muxWs.RUnlock()
+			if ws != nil {
+				ws.SetWriteDeadline(time.Now().Add(writeWait))
+				if err := ws.WriteMessage(websocket.PingMessage, nil); err != nil {
+					k.logger.Errorf("keepAlive: Fail to send ping: %v", err)
+				}
 			}
+			k.muxWrite.Unlock()
 		}
 	}
 }
 
-func (k *Kraken) listenCandles(m domain.Market) (<-chan domain.CandleSub, <-chan struct{}) {
-	candles := make(chan domain.CandleSub)
-	stopChan := make(chan struct{})
-	var candle domain.CandleSub
-
-	k.conns[m].wg.Add(1)
-	go func() {
-		defer func() {
-			stopChan <- struct{}{}
-			close(stopChan)
-			close(candles)
-
-			k.notify.Notify(m, fmt.Sprintf("%v: %v", StopListen, m))
-			k.conns[m].wg.Done()
-		}()
-
-		k.notify.Notify(m, fmt.Sprintf("%v: %v", StartListen, m))
-
-		k.conns[m].ws.SetReadDeadline(time.Now().Add(pongWait))
-		k.conns[m].ws.SetPongHandler(func(string) error { k.conns[m].ws.SetReadDeadline(time.Now().Add(pongWait)); return nil })
-
-		for {
-			err := k.conns[m].ws.ReadJSON(&candle)
-			if err != nil {
-				k.logger.Warnf("listenCandles: %v: Stop listening on websocket: %v", m, err)
-				if websocket.IsCloseError(err, websocket.CloseAbnormalClosure) {
-					_, err := k.Subscribe(context.Background(), m)
-					if err != nil {
-						return
-					}
-					k.logger.Infof("listenCandles: %v: Restore webscoket connection", m)
-					continue
-				}
-				return
+// listen reads the shared connection and fans out candles to subscribed
+// markets by product id. Whatever breaks the connection (close frame of any
+// code, read timeout or network error), it is restored until the last market
+// is stopped.
+func (k *Kraken) listen(ws *websocket.Conn, stopChan <-chan struct{}) {
+	defer k.wg.Done()
+
+	for {
+		err := k.read(ws)
+
+		select {
+		// closed by the last Stop
+		case <-stopChan:
+			return
+		default:
+		}
+
+		k.logger.Warnf("listen: Websocket connection is lost: %v", err)
+		if ws = k.reconnect(ws, err, stopChan); ws == nil {
+			return
+		}
+	}
+}
+
+// read routes messages of ws until it fails.
+func (k *Kraken) read(ws *websocket.Conn) error {
+	ws.SetPongHandler(func(string) error { ws.SetReadDeadline(time.Now().Add(pongWait)); return nil })
+
+	for {
+		ws.SetReadDeadline(time.Now().Add(pongWait))
+
+		var msg message
+		if err := ws.ReadJSON(&msg); err != nil {
+			return err
+		}
+		k.route(msg)
+	}
+}
+
+func (k *Kraken) route(msg message) {
+	var missed []string
+
+	k.muxWs.Lock()
+	switch msg.Event {
+	case "subscribed":
+		for _, p := range msg.Products {
+			if sub, ok := k.subs[key(p)]; ok {
+				ack(sub, nil)
 			}
-			candles <- candle
 		}
-	}()
+	case "error":
+		// errors don't tell the product, so every pending subscription fails
+		for _, sub := range k.subs {
+			if !sub.started {
+				ack(sub, errors.New(msg.Mess))
+			}
+		}
+	case "":
+		if msg.Candle == nil {
+			break
+		}
+		// candles are buffered until the market is started
+		m := key(msg.Product)
+		sub, ok := k.subs[m]
+		if !ok || sub.feed != msg.Feed {
+			break
+		}
+		if n := sub.missed(msg.Candle.Time); n > 0 {
+			missed = append(missed, fmt.Sprintf("%v: %v: %v candles since %v", MissedCandles, m, n,
+				time.UnixMilli(int64(sub.last)).UTC().Format(time.RFC3339)))
+		}
+		if msg.Candle.Time > sub.last {
+			sub.last = msg.Candle.Time
+		}
+		select {
+		case sub.candles <- domain.CandleSub{Cand: *msg.Candle}:
+		default:
+			k.logger.Warnf("listen: %v: Candles are not read, candle is dropped", m)
+		}
+	}
+	k.muxWs.Unlock()
+
+	for _, v := range missed {
+		k.logger.Warnf("listen: %v", v)
+		k.notify.Notify(key(msg.Product), v)
+	}
+}
+
+// missed returns the number of candles missed before the first candle at time
+// ts after the connection was restored.
+func (s *subscription) missed(ts float64) int {
+	if !s.gap {
+		return 0
+	}
+	s.gap = false
+
+	step := float64(s.interval.Milliseconds())
+	if s.last == 0 || step == 0 || ts <= s.last {
+		return 0
+	}
+
+	return int((ts-s.last)/step) - 1
+}
+
+func ack(sub *subscription, err error) {
+	select {
+	case sub.acks <- err:
+	default:
+	}
+}
+
+// reconnect replaces lost connection ws with a new one and subscribes all
+// markets again, retrying with backoff. Returns nil if the last market was
+// stopped meanwhile.
+func (k *Kraken) reconnect(ws *websocket.Conn, cause error, stopChan <-chan struct{}) *websocket.Conn {
+	ws.Close()
+
+	k.muxWs.Lock()
+	if k.ws == ws {
+		k.ws = nil
+	}
+	for _, sub := range k.subs {
+		sub.gap = true
+	}
+	k.muxWs.Unlock()
+
+	lost := time.Now()
+	k.notify.Notify("", fmt.Sprintf("%v: %v", LostWs, cause))
+
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-stopChan:
+			return nil
+		case <-time.After(backoff(attempt)):
+		}
+
+		next, err := k.resubscribe(stopChan)
+		if err == nil {
+			k.logger.Infof("listen: Websocket connection is restored after %v attempts", attempt)
+			k.notify.Notify("", fmt.Sprintf("%v: after %v attempts, %v offline", RestoreWs, attempt,
+				time.Since(lost).Round(time.Second)))
+			return next
+		}
+		if err == errStopped {
+			return nil
+		}
+
+		k.logger.Warnf("listen: Fail to restore websocket connection, attempt %v: %v", attempt, err)
+		// 1st, 2nd, 4th, 8th... attempts, not to flood the chat during a long outage
+		if attempt&(attempt-1) == 0 {
+			k.notify.Notify("", fmt.Sprintf("%v: attempt %v: %v", RetryWs, attempt, err))
+		}
+	}
+}
+
+var errStopped = errors.New("Websocket connection is closed")
+
+// resubscribe dials a new connection and subscribes all markets on it.
+func (k *Kraken) resubscribe(stopChan <-chan struct{}) (*websocket.Conn, error) {
+	next, err := k.dial()
+	if err != nil {
+		return nil, err
+	}
+
+	k.muxWs.Lock()
+	select {
+	case <-stopChan:
+		k.muxWs.Unlock()
+		next.Close()
+		return nil, errStopped
+	default:
+	}
+	k.ws = next
+	subs := make(map[domain.Market]string)
+	for m, sub := range k.subs {
+		subs[m] = sub.feed
+	}
+	k.muxWs.Unlock()
+
+	for m, feed := range subs {
+		err = k.write(&domain.Subscribe{Event: "subscribe", Feed: feed, Products: []string{string(m)}})
+		if err != nil {
+			k.muxWs.Lock()
+			if k.ws == next {
+				k.ws = nil
+			}
+			k.muxWs.Unlock()
+			next.Close()
+			return nil, fmt.Errorf("Fail to send subscribtion request: %v: %w", m, err)
+		}
+	}
 
-	return candles, stopChan
+	return next, nil
 }
@@ -0,0 +1,141 @@
+package simulator
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/cgriceld/crypto-trade-bot/internal/domain"
+)
+
+// Executor fills ioc orders in process at the order price moved against the
+// trader by Slippage percent and charges Fee percent of the order value.
+type Executor struct {
+	Slippage float64
+	Fee      float64
+}
+
+func (e *Executor) Fill(order domain.Order) domain.Order {
+	slip := order.Price * e.Slippage / 100
+	if order.Typ == "sell" {
+		order.Price -= slip
+	} else {
+		order.Price += slip
+	}
+	order.Fee = order.Price * float64(order.Size) * e.Fee / 100
+
+	return order
+}
+
+// Exchange replays candles to the robot and fills its orders with Executor
+// instead of Kraken.
+type Exchange struct {
+	executor Executor
+	candles  []domain.Candle
+	wg       sync.WaitGroup
+	muxFills sync.Mutex
+	fills    []domain.Order
+}
+
+func New(candles []domain.Candle, executor Executor) *Exchange {
+	return &Exchange{
+		executor: executor,
+		candles:  candles,
+	}
+}
+
+func (e *Exchange) SetMarket(ctx context.Context, m domain.Market) {
+}
+
+func (e *Exchange) Subscribe(ctx context.Context, m domain.Market, interval string) (int, error) {
+	return 0, nil
+}
+
+func (e *Exchange) Start(m domain.Market) <-chan domain.CandleSub {
+	candles := make(chan domain.CandleSub)
+
+	e.wg.Add(1)
+	go func() {
+		defer func() {
+			close(candles)
+			e.wg.Done()
+		}()
+
+		for _, c := range e.candles {
+			candles <- domain.CandleSub{Cand: c}
+		}
+	}()
+
+	return candles
+}
+
+// Stop waits until all candles are replayed.
+func (e *Exchange) Stop(ctx context.Context, m domain.Market) {
+	e.wg.Wait()
+}
+
+func (e *Exchange) SendOrder(ctx context.Context, order domain.Order) (*domain.RespOrder, error) {
+	fill := e.executor.Fill(order)
+
+	e.muxFills.Lock()
+	e.fills = append(e.fills, fill)
+	e.muxFills.Unlock()
+
+	return &domain.RespOrder{
+		Result: "success",
+		Status: domain.SendStatus{Stat: "placed"},
+	}, nil
+}
+
+// EditOrder accepts all changes, the robot doesn't keep orders on the
+// exchange in backtests.
+func (e *Exchange) EditOrder(ctx context.Context, orderID string, order domain.Order) (*domain.RespEdit, error) {
+	return &domain.RespEdit{Result: "success", Status: domain.EditStatus{OrderID: orderID, Stat: "edited"}}, nil
+}
+
+func (e *Exchange) CancelOrder(ctx context.Context, orderID string) (*domain.RespCancel, error) {
+	return &domain.RespCancel{Result: "success", Status: domain.CancelStatus{OrderID: orderID, Stat: "notFound"}}, nil
+}
+
+func (e *Exchange) CancelAllOrders(ctx context.Context, m domain.Market) (*domain.CancelAllStatus, error) {
+	return &domain.CancelAllStatus{Stat: "noOrdersToCancel"}, nil
+}
+
+// OpenOrders, OpenPositions and Fills return nothing, the account of backtests
+// is the report of executed orders.
+func (e *Exchange) OpenOrders(ctx context.Context) ([]domain.OpenOrder, error) {
+	return nil, nil
+}
+
+func (e *Exchange) OpenPositions(ctx context.Context) ([]domain.OpenPosition, error) {
+	return nil, nil
+}
+
+func (e *Exchange) Fills(ctx context.Context, before *time.Time) ([]domain.Fill, error) {
+	return nil, nil
+}
+
+func (e *Exchange) Accounts(ctx context.Context) (*domain.AccountsResp, error) {
+	return &domain.AccountsResp{Accounts: map[string]domain.Account{}}, nil
+}
+
+// Instruments returns nothing, so that backtests accept any market.
+func (e *Exchange) Instruments(ctx context.Context) ([]domain.Instrument, error) {
+	return nil, nil
+}
+
+// History returns no candles, there is no history before the replayed ones.
+func (e *Exchange) History(ctx context.Context, m domain.Market, interval string, from time.Time, to time.Time) ([]domain.Candle, error) {
+	return nil, nil
+}
+
+// Executed returns orders filled so far in the order of execution.
+func (e *Exchange) Executed() []domain.Order {
+	e.muxFills.Lock()
+	defer e.muxFills.Unlock()
+
+	res := make([]domain.Order, len(e.fills))
+	copy(res, e.fills)
+
+	return res
+}
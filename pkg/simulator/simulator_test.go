@@ -0,0 +1,59 @@
+package simulator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cgriceld/crypto-trade-bot/internal/domain"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type Fills struct {
+	name     string
+	executor Executor
+	order    domain.Order
+	res      domain.Order
+}
+
+func TestFill(t *testing.T) {
+	tests := []Fills{
+		{"No slippage", Executor{}, domain.Order{Typ: "buy", Price: 100, Size: 2},
+			domain.Order{Typ: "buy", Price: 100, Size: 2}},
+		{"Buy slippage", Executor{Slippage: 1, Fee: 0.5}, domain.Order{Typ: "buy", Price: 100, Size: 2},
+			domain.Order{Typ: "buy", Price: 101, Size: 2, Fee: 1.01}},
+		{"Sell slippage", Executor{Slippage: 1, Fee: 0.5}, domain.Order{Typ: "sell", Price: 100, Size: 2},
+			domain.Order{Typ: "sell", Price: 99, Size: 2, Fee: 0.99}},
+	}
+
+	for _, test := range tests {
+		res := test.executor.Fill(test.order)
+
+		if !assert.Equal(t, test.res, res, "%v: Expect: %v, Got: %v", test.name, test.res, res) {
+			t.Fatal()
+		}
+	}
+}
+
+func TestExchange(t *testing.T) {
+	candles := []domain.Candle{
+		{Time: 1, Close: "1", Open: "1", High: "1", Low: "1"},
+		{Time: 2, Close: "2", Open: "2", High: "2", Low: "2"},
+	}
+	e := New(candles, Executor{})
+	m := domain.Market("pi_ethusd")
+
+	var res []domain.Candle
+	for c := range e.Start(m) {
+		res = append(res, c.Cand)
+	}
+	e.Stop(context.Background(), m)
+
+	resp, _ := e.SendOrder(context.Background(), domain.Order{Typ: "sell", Price: 2, Size: 1})
+
+	if !assert.Equal(t, candles, res) ||
+		!assert.Equal(t, domain.RespOrder{Result: "success", Status: domain.SendStatus{Stat: "placed"}}, *resp) ||
+		!assert.Equal(t, []domain.Order{{Typ: "sell", Price: 2, Size: 1}}, e.Executed()) {
+		t.Fatal()
+	}
+}
@@ -7,4 +7,8 @@ export TgChatID=""
 export TgBotURL=""
 
 export port=":5000"
-export dsn=""
\ No newline at end of file
+export dsn=""
+
+export AutoResume="false"
+export SpoolFile="spool.jsonl"
+export WarmUp="200"